@@ -0,0 +1,142 @@
+package giopdf
+
+import (
+	"fmt"
+
+	"gioui.org/f32"
+	"github.com/andybalholm/giopdf/pdf"
+)
+
+// An AnnotationMode selects which of a page's annotations are drawn, based on
+// their flags.
+type AnnotationMode int
+
+const (
+	// ScreenAnnotations draws the annotations that are meant to be
+	// displayed on screen: all except those that are Hidden or NoView.
+	ScreenAnnotations AnnotationMode = iota
+
+	// PrintAnnotations draws the annotations that are meant to be
+	// printed: those that have the Print flag, unless they are Hidden.
+	PrintAnnotations
+
+	// NoAnnotations draws only the page's content.
+	NoAnnotations
+)
+
+// standardAnnotations is the set of annotation subtypes defined by the PDF
+// specification.
+var standardAnnotations = map[string]bool{
+	"Text": true, "Link": true, "FreeText": true, "Line": true,
+	"Square": true, "Circle": true, "Polygon": true, "PolyLine": true,
+	"Highlight": true, "Underline": true, "Squiggly": true, "StrikeOut": true,
+	"Stamp": true, "Caret": true, "Ink": true, "Popup": true,
+	"FileAttachment": true, "Sound": true, "Movie": true, "Widget": true,
+	"Screen": true, "PrinterMark": true, "TrapNet": true, "Watermark": true,
+	"3D": true, "Redact": true, "Projection": true, "RichMedia": true,
+}
+
+// renderAnnotations draws the annotations of page that are selected by mode,
+// using their normal appearance streams. Annotations without an appearance
+// stream are drawn by drawDefaultAppearance. An annotation that can't be
+// drawn doesn't stop the others from being drawn; the first error is
+// returned.
+func renderAnnotations(c *Canvas, page pdf.Page, mode AnnotationMode) error {
+	var firstErr error
+	annots := page.V.Key("Annots")
+	for i := 0; i < annots.Len(); i++ {
+		a := annots.Index(i)
+		if !annotationShown(a, mode) {
+			continue
+		}
+		var err error
+		if a.Key("AP").Key("N").IsNull() {
+			err = drawDefaultAppearance(c, a)
+		} else if ap := normalAppearance(a); ap.Kind() == pdf.Stream {
+			err = drawAppearance(c, a, ap)
+		}
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("error drawing %s annotation: %v", a.Key("Subtype").Name(), err)
+		}
+	}
+	return firstErr
+}
+
+// annotationShown reports whether the annotation a should be drawn in the
+// given mode, according to its flags.
+func annotationShown(a pdf.Value, mode AnnotationMode) bool {
+	flags := pdf.AnnotationFlags(a.Key("F").Int64())
+	if flags&pdf.AnnotHidden != 0 {
+		return false
+	}
+	if flags&pdf.AnnotInvisible != 0 && !standardAnnotations[a.Key("Subtype").Name()] {
+		return false
+	}
+	switch mode {
+	case ScreenAnnotations:
+		return flags&pdf.AnnotNoView == 0
+	case PrintAnnotations:
+		return flags&pdf.AnnotPrint != 0
+	}
+	return false
+}
+
+// normalAppearance returns the appearance stream that is used to draw the
+// annotation a. If the annotation has several appearance states (like a
+// check box), its AS entry selects one of them.
+func normalAppearance(a pdf.Value) pdf.Value {
+	n := a.Key("AP").Key("N")
+	if n.Kind() == pdf.Dict {
+		return n.Key(a.Key("AS").Name())
+	}
+	return n
+}
+
+// drawAppearance draws the appearance stream ap of the annotation a, using
+// the algorithm in section 12.5.5 of the PDF specification: the form's
+// bounding box, transformed by its matrix, is scaled and moved to fit the
+// annotation's rectangle.
+func drawAppearance(c *Canvas, a, ap pdf.Value) error {
+	rect, ok := rectangle(a.Key("Rect"))
+	if !ok || rect.Empty() {
+		return nil
+	}
+	bbox, ok := rectangle(ap.Key("BBox"))
+	if !ok {
+		return fmt.Errorf("appearance stream has no BBox")
+	}
+	matrix := f32.Affine2D{}
+	if m := ap.Key("Matrix"); m.Len() == 6 {
+		matrix = f32.NewAffine2D(m.Index(0).Float32(), m.Index(2).Float32(), m.Index(4).Float32(), m.Index(1).Float32(), m.Index(3).Float32(), m.Index(5).Float32())
+	}
+	box := transformRect(matrix, bbox)
+	if box.Dx() == 0 || box.Dy() == 0 {
+		return nil
+	}
+
+	sx := rect.Dx() / box.Dx()
+	sy := rect.Dy() / box.Dy()
+	level := len(c.stateStack)
+	c.Save()
+	defer c.restoreTo(level)
+	c.Transform(sx, 0, 0, sy, rect.Min.X-box.Min.X*sx, rect.Min.Y-box.Min.Y*sy)
+	return drawForm(c, ap, pdf.Value{}, 1)
+}
+
+// transformRect returns the bounding box of r after it is transformed by m.
+func transformRect(m f32.Affine2D, r f32.Rectangle) f32.Rectangle {
+	corners := [4]f32.Point{
+		m.Transform(r.Min),
+		m.Transform(f32.Pt(r.Max.X, r.Min.Y)),
+		m.Transform(r.Max),
+		m.Transform(f32.Pt(r.Min.X, r.Max.Y)),
+	}
+	b := f32.Rectangle{Min: corners[0], Max: corners[0]}
+	for _, p := range corners[1:] {
+		b.Min.X = min32(b.Min.X, p.X)
+		b.Min.Y = min32(b.Min.Y, p.Y)
+		b.Max.X = max32(b.Max.X, p.X)
+		b.Max.Y = max32(b.Max.Y, p.Y)
+	}
+	return b
+}
@@ -0,0 +1,401 @@
+package giopdf
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"gioui.org/f32"
+	"github.com/andybalholm/giopdf/pdf"
+	"github.com/benoitkugler/textlayout/fonts/simpleencodings"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// Many annotations are created without an appearance stream, on the
+// assumption that the viewer will generate one from the annotation's other
+// entries. drawDefaultAppearance does this for the common markup annotations.
+
+// highlightAlpha is the opacity of generated highlights. Viewers normally
+// draw highlights with the Multiply blend mode, so that the text shows
+// through; the Canvas can't do that, so they are drawn translucent instead.
+const highlightAlpha = 0.4
+
+// drawDefaultAppearance draws the annotation a, which has no appearance
+// stream, based on its type and its other entries. Annotation types that
+// don't have a generated appearance are skipped.
+func drawDefaultAppearance(c *Canvas, a pdf.Value) error {
+	level := len(c.stateStack)
+	c.Save()
+	defer c.restoreTo(level)
+
+	alpha := float32(1)
+	if ca := a.Key("CA"); !ca.IsNull() {
+		alpha = ca.Float32()
+	}
+	color, hasColor := annotationColor(a.Key("C"))
+	interior, hasInterior := annotationColor(a.Key("IC"))
+	width, dash := borderStyle(a)
+
+	c.SetRGBStrokeColor(color[0], color[1], color[2])
+	c.SetRGBFillColor(interior[0], interior[1], interior[2])
+	c.SetStrokeAlpha(alpha)
+	c.SetFillAlpha(alpha)
+	c.SetLineWidth(width)
+	c.SetDash(dash, 0)
+	stroke := hasColor && width > 0
+
+	switch subtype := a.Key("Subtype").Name(); subtype {
+	case "Highlight", "Underline", "StrikeOut":
+		if !hasColor {
+			return nil
+		}
+		c.SetRGBFillColor(color[0], color[1], color[2])
+		if subtype == "Highlight" {
+			c.SetFillAlpha(alpha * highlightAlpha)
+		}
+		for _, q := range quadPoints(a) {
+			// The points are in the order used by Acrobat (upper left,
+			// upper right, lower left, lower right), rather than the
+			// order described in the specification.
+			ul, ur, ll, lr := q[0], q[1], q[2], q[3]
+			switch subtype {
+			case "Highlight":
+				c.MoveTo(ul.X, ul.Y)
+				c.LineTo(ur.X, ur.Y)
+				c.LineTo(lr.X, lr.Y)
+				c.LineTo(ll.X, ll.Y)
+			case "Underline":
+				up := ul.Sub(ll).Mul(1.0 / 14)
+				quadPath(c, ll, lr, up)
+			case "StrikeOut":
+				up := ul.Sub(ll).Mul(1.0 / 14)
+				quadPath(c, ll.Add(ul.Sub(ll).Mul(0.5)).Sub(up.Mul(0.5)), lr.Add(ur.Sub(lr).Mul(0.5)).Sub(up.Mul(0.5)), up)
+			}
+			c.Fill()
+		}
+
+	case "Square", "Circle":
+		r, ok := innerRect(a, width)
+		if !ok || !stroke && !hasInterior {
+			return nil
+		}
+		if subtype == "Square" {
+			c.Rectangle(r.Min.X, r.Min.Y, r.Dx(), r.Dy())
+		} else {
+			ellipse(c, r)
+		}
+		paintPath(c, stroke, hasInterior)
+
+	case "Line":
+		l := a.Key("L")
+		if l.Len() != 4 || !stroke {
+			return nil
+		}
+		c.MoveTo(l.Index(0).Float32(), l.Index(1).Float32())
+		c.LineTo(l.Index(2).Float32(), l.Index(3).Float32())
+		c.Stroke()
+
+	case "Ink":
+		if !stroke {
+			return nil
+		}
+		c.SetLineCap(1)
+		c.SetLineJoin(1)
+		ink := a.Key("InkList")
+		for i := 0; i < ink.Len(); i++ {
+			path := ink.Index(i)
+			for j := 0; j+1 < path.Len(); j += 2 {
+				x, y := path.Index(j).Float32(), path.Index(j+1).Float32()
+				if j == 0 {
+					c.MoveTo(x, y)
+				} else {
+					c.LineTo(x, y)
+				}
+			}
+			c.Stroke()
+		}
+
+	case "FreeText":
+		return drawFreeText(c, a, width, alpha)
+	}
+	return nil
+}
+
+// annotationColor converts a color array (with 0, 1, 3 or 4 components, for
+// transparent, gray, RGB or CMYK) to RGB. It reports false for transparent or
+// invalid colors.
+func annotationColor(v pdf.Value) (rgb [3]float32, ok bool) {
+	switch v.Len() {
+	case 1:
+		g := v.Index(0).Float32()
+		return [3]float32{g, g, g}, true
+	case 3:
+		return [3]float32{v.Index(0).Float32(), v.Index(1).Float32(), v.Index(2).Float32()}, true
+	case 4:
+		k := 1 - v.Index(3).Float32()
+		for i := range rgb {
+			rgb[i] = (1 - v.Index(i).Float32()) * k
+		}
+		return rgb, true
+	}
+	return rgb, false
+}
+
+// borderStyle returns the width and dash pattern of an annotation's border,
+// from its BS dictionary or its older Border array.
+func borderStyle(a pdf.Value) (width float32, dash []float32) {
+	if bs := a.Key("BS"); bs.Kind() == pdf.Dict {
+		width = 1
+		if w := bs.Key("W"); !w.IsNull() {
+			width = w.Float32()
+		}
+		if bs.Key("S").Name() == "D" {
+			dash = []float32{3}
+			if d := bs.Key("D"); d.Len() > 0 {
+				dash = floats(d)
+			}
+		}
+		return width, dash
+	}
+	border := a.Key("Border")
+	if border.Len() < 3 {
+		return 1, nil
+	}
+	if border.Len() > 3 {
+		dash = floats(border.Index(3))
+	}
+	return border.Index(2).Float32(), dash
+}
+
+// floats returns the elements of the array v.
+func floats(v pdf.Value) []float32 {
+	f := make([]float32, v.Len())
+	for i := range f {
+		f[i] = v.Index(i).Float32()
+	}
+	return f
+}
+
+// quadPoints returns the quadrilaterals in a markup annotation's QuadPoints.
+func quadPoints(a pdf.Value) [][4]f32.Point {
+	qp := a.Key("QuadPoints")
+	var quads [][4]f32.Point
+	for i := 0; i+8 <= qp.Len(); i += 8 {
+		var q [4]f32.Point
+		for j := range q {
+			q[j] = f32.Pt(qp.Index(i+2*j).Float32(), qp.Index(i+2*j+1).Float32())
+		}
+		quads = append(quads, q)
+	}
+	return quads
+}
+
+// quadPath adds a parallelogram to c's path, with one side from p0 to p1,
+// and the other sides parallel to d.
+func quadPath(c *Canvas, p0, p1, d f32.Point) {
+	c.MoveTo(p0.X, p0.Y)
+	c.LineTo(p1.X, p1.Y)
+	c.LineTo(p1.X+d.X, p1.Y+d.Y)
+	c.LineTo(p0.X+d.X, p0.Y+d.Y)
+	c.ClosePath()
+}
+
+// innerRect returns the annotation's rectangle, reduced by the differences
+// in its RD entry and by half the border width, so that the border is drawn
+// inside Rect.
+func innerRect(a pdf.Value, width float32) (f32.Rectangle, bool) {
+	r, ok := rectangle(a.Key("Rect"))
+	if !ok {
+		return r, false
+	}
+	if rd := a.Key("RD"); rd.Len() == 4 {
+		r.Min.X += rd.Index(0).Float32()
+		r.Max.Y -= rd.Index(1).Float32()
+		r.Max.X -= rd.Index(2).Float32()
+		r.Min.Y += rd.Index(3).Float32()
+	}
+	r.Min = r.Min.Add(f32.Pt(width/2, width/2))
+	r.Max = r.Max.Sub(f32.Pt(width/2, width/2))
+	return r, r.Dx() > 0 && r.Dy() > 0
+}
+
+// ellipse adds the ellipse inscribed in r to c's path.
+func ellipse(c *Canvas, r f32.Rectangle) {
+	// The control points for approximating a quarter circle with a cubic
+	// Bézier curve are this fraction of the radius from the end points.
+	const k = 0.5523
+	cx, cy := (r.Min.X+r.Max.X)/2, (r.Min.Y+r.Max.Y)/2
+	rx, ry := r.Dx()/2, r.Dy()/2
+	c.MoveTo(cx+rx, cy)
+	c.CurveTo(cx+rx, cy+k*ry, cx+k*rx, cy+ry, cx, cy+ry)
+	c.CurveTo(cx-k*rx, cy+ry, cx-rx, cy+k*ry, cx-rx, cy)
+	c.CurveTo(cx-rx, cy-k*ry, cx-k*rx, cy-ry, cx, cy-ry)
+	c.CurveTo(cx+k*rx, cy-ry, cx+rx, cy-k*ry, cx+rx, cy)
+	c.ClosePath()
+}
+
+// paintPath fills and/or strokes the current path.
+func paintPath(c *Canvas, stroke, fill bool) {
+	switch {
+	case stroke && fill:
+		c.FillAndStroke()
+	case stroke:
+		c.Stroke()
+	case fill:
+		c.Fill()
+	default:
+		c.NoOpPaint()
+	}
+}
+
+// drawFreeText draws a FreeText annotation: its Contents, wrapped to fit its
+// rectangle, in the size and color given by its default appearance string
+// (DA), on a background of its color C. The text is drawn in Go Regular,
+// since the font named in DA belongs to the document's interactive form, and
+// it usually isn't embedded anyway.
+func drawFreeText(c *Canvas, a pdf.Value, width, alpha float32) error {
+	r, ok := innerRect(a, width)
+	if !ok {
+		return nil
+	}
+	size, textColor := parseDA(a.Key("DA").RawString())
+
+	if bg, ok := annotationColor(a.Key("C")); ok {
+		c.SetRGBFillColor(bg[0], bg[1], bg[2])
+		c.SetFillAlpha(alpha)
+		c.Rectangle(r.Min.X, r.Min.Y, r.Dx(), r.Dy())
+		c.Fill()
+	}
+	c.SetRGBStrokeColor(textColor[0], textColor[1], textColor[2])
+	c.SetRGBFillColor(textColor[0], textColor[1], textColor[2])
+	if width > 0 {
+		c.Rectangle(r.Min.X, r.Min.Y, r.Dx(), r.Dy())
+		c.Stroke()
+	}
+
+	font, err := freeTextFont()
+	if err != nil {
+		return fmt.Errorf("loading font: %v", err)
+	}
+	const padding = 2
+	lines := wrapText(font, a.Key("Contents").Text(), size, r.Dx()-2*padding)
+
+	c.Rectangle(r.Min.X, r.Min.Y, r.Dx(), r.Dy())
+	c.Clip()
+	c.NoOpPaint()
+	c.BeginText()
+	c.SetFont(font, size)
+	y := r.Max.Y - padding - size
+	for _, line := range lines {
+		x := r.Min.X + padding
+		switch a.Key("Q").Int() {
+		case 1:
+			x += (r.Dx() - 2*padding - textWidth(font, line, size)) / 2
+		case 2:
+			x += r.Dx() - 2*padding - textWidth(font, line, size)
+		}
+		c.SetTextMatrix(1, 0, 0, 1, x, y)
+		c.ShowText(line)
+		y -= size * 1.2
+	}
+	c.EndText()
+	return nil
+}
+
+// parseDA returns the font size and the text color from a default
+// appearance string, such as "/Helv 12 Tf 0 0 1 rg".
+func parseDA(da string) (size float32, color [3]float32) {
+	size = 12
+	cs := pdf.NewContentStream(strings.NewReader(da))
+	for {
+		args, op := cs.ReadInstruction()
+		if op == "" {
+			break
+		}
+		switch op {
+		case "Tf":
+			// A size of zero means auto-sizing, which is for form
+			// fields; use the default instead.
+			if len(args) == 2 && args[1].Float32() > 0 {
+				size = args[1].Float32()
+			}
+		case "g", "rg", "k":
+			color, _ = annotationColor(pdf.NewArray(args...))
+		}
+	}
+	return size, color
+}
+
+var (
+	freeTextFontOnce sync.Once
+	freeTextFontData *SimpleFont
+	freeTextFontErr  error
+)
+
+// freeTextFont returns Go Regular, with WinAnsiEncoding.
+func freeTextFont() (*SimpleFont, error) {
+	freeTextFontOnce.Do(func() {
+		freeTextFontData, freeTextFontErr = SimpleFontFromSFNT(goregular.TTF, simpleencodings.WinAnsi)
+		if freeTextFontErr != nil {
+			return
+		}
+		for b, r := range simpleencodings.WinAnsi.ByteToRune() {
+			freeTextFontData.Glyphs[b].Text = string(r)
+		}
+		freeTextFontData.Glyphs[' '].WordSpace = true
+	})
+	return freeTextFontData, freeTextFontErr
+}
+
+// winAnsiEncode converts s to WinAnsiEncoding, replacing characters that
+// can't be encoded with question marks.
+func winAnsiEncode(s string) string {
+	runeToByte := make(map[rune]byte)
+	for b, r := range simpleencodings.WinAnsi.ByteToRune() {
+		runeToByte[r] = b
+	}
+	var b strings.Builder
+	for _, r := range s {
+		if c, ok := runeToByte[r]; ok {
+			b.WriteByte(c)
+		} else {
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// textWidth returns the width of s (in the font's encoding) at the given size.
+func textWidth(font *SimpleFont, s string, size float32) float32 {
+	var w float32
+	for _, g := range font.ToGlyphs(s) {
+		w += g.Width
+	}
+	return w * size
+}
+
+// wrapText splits text into lines no wider than width, breaking lines at
+// spaces where possible, and at the newlines in text. The lines are returned
+// in the font's encoding.
+func wrapText(font *SimpleFont, text string, size, width float32) []string {
+	var lines []string
+	text = strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(text)
+	for _, para := range strings.Split(text, "\n") {
+		words := strings.Fields(winAnsiEncode(para))
+		if len(words) == 0 {
+			lines = append(lines, "")
+			continue
+		}
+		line := words[0]
+		for _, w := range words[1:] {
+			if textWidth(font, line+" "+w, size) > width {
+				lines = append(lines, line)
+				line = w
+			} else {
+				line += " " + w
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
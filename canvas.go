@@ -13,6 +13,9 @@ import (
 
 // A Canvas implements the PDF imaging model, drawing to a Gio operations list.
 // Most of its methods correspond directly to PDF page description operators.
+//
+// If the operations list is nil, nothing is drawn, but the graphics state is
+// still tracked; this is used for text extraction.
 type Canvas struct {
 	PathBuilder
 	graphicsState
@@ -21,6 +24,11 @@ type Canvas struct {
 	setClippingPath bool
 
 	ops *op.Ops
+
+	// textHandler, if it is not nil, is called for each glyph shown by
+	// ShowText, with a matrix mapping glyph space to the default coordinate
+	// space of the page.
+	textHandler func(g Glyph, m f32.Affine2D, vertical bool)
 }
 
 func NewCanvas(ops *op.Ops) *Canvas {
@@ -37,11 +45,17 @@ func NewCanvas(ops *op.Ops) *Canvas {
 }
 
 func (c *Canvas) fill() {
+	if c.ops == nil {
+		return
+	}
 	ps := toPathSpec(c.ops, c.Path, true)
 	paint.FillShape(c.ops, c.fillColor, clip.Outline{ps}.Op())
 }
 
 func (c *Canvas) stroke() {
+	if c.ops == nil {
+		return
+	}
 	var p [][]stroke.Segment
 	var contour []stroke.Segment
 	var pos, lastMove f32.Point
@@ -104,7 +118,7 @@ func segmentsToPathSpec(ops *op.Ops, outline [][]stroke.Segment) clip.PathSpec {
 }
 
 func (c *Canvas) finishPath() {
-	if c.setClippingPath {
+	if c.setClippingPath && c.ops != nil {
 		ps := toPathSpec(c.ops, c.Path, true)
 		cs := clip.Outline{ps}.Op().Push(c.ops)
 		c.clippingPaths = append(c.clippingPaths, cs)
@@ -168,6 +182,9 @@ func (c *Canvas) Save() {
 
 // Restore restores the graphics state, popping it off the stack.
 func (c *Canvas) Restore() {
+	if len(c.stateStack) == 0 {
+		return
+	}
 	// First pop off the TransformStack and clip.Stack entries that were saved since the last Save call.
 	for i := len(c.transforms) - 1; i >= 0; i-- {
 		c.transforms[i].Pop()
@@ -181,10 +198,38 @@ func (c *Canvas) Restore() {
 	c.stateStack = c.stateStack[:n]
 }
 
+// restoreTo restores saved graphics states until there are only n left on
+// the stack.
+func (c *Canvas) restoreTo(n int) {
+	for len(c.stateStack) > n {
+		c.Restore()
+	}
+}
+
+// restoreAll pops all the saved graphics states, and the transformations
+// and clipping paths that were pushed onto the operations list, so that the
+// list is left balanced even if the content stream was cut short or was
+// missing some Q operators.
+func (c *Canvas) restoreAll() {
+	c.restoreTo(0)
+	for i := len(c.transforms) - 1; i >= 0; i-- {
+		c.transforms[i].Pop()
+	}
+	for i := len(c.clippingPaths) - 1; i >= 0; i-- {
+		c.clippingPaths[i].Pop()
+	}
+	c.transforms = nil
+	c.clippingPaths = nil
+}
+
 // Transform changes the coordinate system according to the transformation
 // matrix specified.
 func (ca *Canvas) Transform(a, b, c, d, e, f float32) {
 	m := f32.NewAffine2D(a, c, e, b, d, f)
+	ca.ctm = ca.ctm.Mul(m)
+	if ca.ops == nil {
+		return
+	}
 	s := op.Affine(m).Push(ca.ops)
 	ca.transforms = append(ca.transforms, s)
 }
@@ -192,6 +237,9 @@ func (ca *Canvas) Transform(a, b, c, d, e, f float32) {
 // Image draws an image. The image is placed in the unit square of the user
 // coordinate system.
 func (c *Canvas) Image(img image.Image) {
+	if c.ops == nil {
+		return
+	}
 	io := paint.NewImageOp(img)
 	size := io.Size()
 	c.Save()
@@ -31,6 +31,8 @@ type Font struct {
 
 	cmap fonts.CmapSimple // see synthetizeCmap
 
+	cidToGID map[uint16]fonts.GID // see GlyphIndex
+
 	cidFontName string
 	charstrings [][]byte // indexed by glyph ID
 	fontName    []byte   // name from the Name INDEX
@@ -107,6 +109,27 @@ func (f *Font) GlyphName(glyph fonts.GID) string {
 	return out
 }
 
+// IsCIDFont reports whether f is a CID-keyed font.
+func (f *Font) IsCIDFont() bool { return f.fdSelect != nil }
+
+// GlyphIndex returns the glyph index for the glyph with the given CID.
+// For fonts that are not CID-keyed, the CID is used directly as the glyph
+// index.
+func (f *Font) GlyphIndex(cid uint16) (fonts.GID, bool) {
+	if f.fdSelect == nil {
+		return fonts.GID(cid), int(cid) < len(f.charstrings)
+	}
+	if f.cidToGID == nil {
+		// For CIDFonts, the charset maps glyph indexes to CIDs.
+		f.cidToGID = make(map[uint16]fonts.GID, len(f.charset))
+		for gid, c := range f.charset {
+			f.cidToGID[c] = fonts.GID(gid)
+		}
+	}
+	gid, ok := f.cidToGID[cid]
+	return gid, ok
+}
+
 // NumGlyphs returns the number of glyphs in this font.
 // It is also the maximum glyph index + 1.
 func (f *Font) NumGlyphs() int { return len(f.charstrings) }
@@ -0,0 +1,291 @@
+package giopdf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"gioui.org/f32"
+	"github.com/andybalholm/giopdf/cff"
+	"github.com/andybalholm/giopdf/cmap"
+	"github.com/andybalholm/giopdf/pdf"
+	"github.com/benoitkugler/textlayout/fonts"
+	"github.com/benoitkugler/textlayout/fonts/truetype"
+)
+
+// A CompositeFont is a font with a multi-byte encoding (a Type 0 font in PDF
+// terminology). The bytes of a string are decoded into CIDs, which select
+// glyphs from the font's descendant CIDFont.
+type CompositeFont struct {
+	cmap    *cmap.CMap
+	encoder pdf.TextEncoding // for the glyphs' Text
+
+	// loadGlyph loads the outlines for a CID. Metrics are filled in from
+	// the PDF font dictionary afterward.
+	loadGlyph func(cid int) (Glyph, error)
+	glyphs    map[int]Glyph
+
+	defaultWidth    float32
+	widths          map[int]float32
+	defaultVertical verticalMetrics
+	verticalMetrics map[int]verticalMetrics
+}
+
+// verticalMetrics holds a glyph's metrics for vertical writing, from the W2
+// and DW2 entries of a CIDFont dictionary. A zero value for hasPosition means
+// that the horizontal component of the position vector is half the glyph's
+// width.
+type verticalMetrics struct {
+	advance     float32
+	position    f32.Point
+	hasPosition bool
+}
+
+func (f *CompositeFont) Vertical() bool {
+	return f.cmap.WMode == 1
+}
+
+func (f *CompositeFont) ToGlyphs(s string) []Glyph {
+	var result []Glyph
+	for len(s) > 0 {
+		code, n, cid := f.cmap.Decode(s)
+		if n > len(s) {
+			n = len(s)
+		}
+		g := f.glyph(cid)
+		if f.encoder != nil {
+			g.Text = f.encoder.Decode(s[:n])
+		}
+		g.WordSpace = n == 1 && code == 32
+		result = append(result, g)
+		s = s[n:]
+	}
+	return result
+}
+
+// glyph returns the glyph for cid, loading it if necessary.
+func (f *CompositeFont) glyph(cid int) Glyph {
+	if g, ok := f.glyphs[cid]; ok {
+		return g
+	}
+
+	g, err := f.loadGlyph(cid)
+	if err != nil {
+		fmt.Printf("Error loading glyph for CID %d: %v\n", cid, err)
+	}
+
+	g.Width = f.defaultWidth
+	if w, ok := f.widths[cid]; ok {
+		g.Width = w
+	}
+
+	vm, ok := f.verticalMetrics[cid]
+	if !ok {
+		vm = f.defaultVertical
+	}
+	g.VerticalAdvance = vm.advance
+	g.Position = vm.position
+	if !vm.hasPosition {
+		g.Position.X = g.Width / 2
+	}
+
+	f.glyphs[cid] = g
+	return g
+}
+
+func compositeFontFromPDF(f pdf.Font) (*CompositeFont, error) {
+	font := &CompositeFont{
+		glyphs:          make(map[int]Glyph),
+		widths:          make(map[int]float32),
+		verticalMetrics: make(map[int]verticalMetrics),
+	}
+
+	var err error
+	font.cmap, err = f.CMap()
+	if err != nil {
+		return nil, fmt.Errorf("error loading CMap for %v: %v", f.V.Key("BaseFont"), err)
+	}
+
+	font.encoder = f.Encoder()
+
+	descendant := f.V.Key("DescendantFonts").Index(0)
+	if descendant.IsNull() {
+		return nil, fmt.Errorf("%v does not have a descendant font", f.V.Key("BaseFont"))
+	}
+
+	switch descendant.Key("Subtype").Name() {
+	case "CIDFontType0":
+		font.loadGlyph, err = cidGlyphsFromCFF(descendant)
+	case "CIDFontType2":
+		font.loadGlyph, err = cidGlyphsFromSFNT(descendant)
+	default:
+		err = fmt.Errorf("%v is an unsupported CIDFont type (%v)", f.V.Key("BaseFont"), descendant.Key("Subtype"))
+	}
+	if err != nil {
+		// The glyphs can't be drawn, but their metrics and text can still be
+		// used.
+		fmt.Println("Error loading glyphs:", err)
+		font.loadGlyph = func(cid int) (Glyph, error) { return Glyph{}, nil }
+	}
+
+	font.defaultWidth = 1
+	if dw := descendant.Key("DW"); !dw.IsNull() {
+		font.defaultWidth = dw.Float32() / 1000
+	}
+	readCIDWidths(descendant.Key("W"), font.widths)
+
+	font.defaultVertical = verticalMetrics{advance: -1, position: f32.Pt(0, 0.88)}
+	if dw2 := descendant.Key("DW2"); dw2.Len() == 2 {
+		font.defaultVertical.position.Y = dw2.Index(0).Float32() / 1000
+		font.defaultVertical.advance = dw2.Index(1).Float32() / 1000
+	}
+	readCIDVerticalMetrics(descendant.Key("W2"), font.verticalMetrics)
+
+	return font, nil
+}
+
+// maxCID is the largest CID; CIDs are 16-bit values.
+const maxCID = 65535
+
+// clampCIDs limits a range of CIDs from a W or W2 array to valid CIDs.
+// An inverted range comes back empty.
+func clampCIDs(first, last int) (int, int) {
+	if first < 0 {
+		first = 0
+	}
+	if last > maxCID {
+		last = maxCID
+	}
+	return first, last
+}
+
+// readCIDWidths reads the glyph widths from a CIDFont's W array. Each entry
+// is either "c [w1 w2 ... wn]" or "cFirst cLast w".
+func readCIDWidths(w pdf.Value, widths map[int]float32) {
+	for i := 0; i < w.Len(); {
+		first := w.Index(i).Int()
+		next := w.Index(i + 1)
+		if next.Kind() == pdf.Array {
+			for j := 0; j < next.Len() && first+j <= maxCID; j++ {
+				if first+j >= 0 {
+					widths[first+j] = next.Index(j).Float32() / 1000
+				}
+			}
+			i += 2
+			continue
+		}
+		first, last := clampCIDs(first, next.Int())
+		width := w.Index(i+2).Float32() / 1000
+		for cid := first; cid <= last; cid++ {
+			widths[cid] = width
+		}
+		i += 3
+	}
+}
+
+// readCIDVerticalMetrics reads the vertical metrics from a CIDFont's W2
+// array. Each entry is either "c [w1y vx vy ...]" or
+// "cFirst cLast w1y vx vy".
+func readCIDVerticalMetrics(w2 pdf.Value, metrics map[int]verticalMetrics) {
+	for i := 0; i < w2.Len(); {
+		first := w2.Index(i).Int()
+		next := w2.Index(i + 1)
+		if next.Kind() == pdf.Array {
+			for j := 0; j+2 < next.Len() && first+j/3 <= maxCID; j += 3 {
+				if first+j/3 < 0 {
+					continue
+				}
+				metrics[first+j/3] = verticalMetrics{
+					advance:     next.Index(j).Float32() / 1000,
+					position:    f32.Pt(next.Index(j+1).Float32()/1000, next.Index(j+2).Float32()/1000),
+					hasPosition: true,
+				}
+			}
+			i += 2
+			continue
+		}
+		first, last := clampCIDs(first, next.Int())
+		vm := verticalMetrics{
+			advance:     w2.Index(i+2).Float32() / 1000,
+			position:    f32.Pt(w2.Index(i+3).Float32()/1000, w2.Index(i+4).Float32()/1000),
+			hasPosition: true,
+		}
+		for cid := first; cid <= last; cid++ {
+			metrics[cid] = vm
+		}
+		i += 5
+	}
+}
+
+// cidGlyphsFromCFF returns a function to load glyphs from a CIDFontType0
+// font with embedded CFF data.
+func cidGlyphsFromCFF(descendant pdf.Value) (func(cid int) (Glyph, error), error) {
+	file := descendant.Key("FontDescriptor").Key("FontFile3")
+	if file.IsNull() {
+		return nil, fmt.Errorf("%v does not have embedded font data", descendant.Key("BaseFont"))
+	}
+	if subtype := file.Key("Subtype").Name(); subtype != "CIDFontType0C" && subtype != "Type1C" {
+		return nil, fmt.Errorf("%v has unsupported font data (%v)", descendant.Key("BaseFont"), subtype)
+	}
+	data, err := io.ReadAll(file.Reader())
+	if err != nil {
+		return nil, err
+	}
+	f, err := cff.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	fm := f32.NewAffine2D(f.FontMatrix[0], f.FontMatrix[2], f.FontMatrix[4], f.FontMatrix[1], f.FontMatrix[3], f.FontMatrix[5])
+
+	return func(cid int) (Glyph, error) {
+		gi, ok := f.GlyphIndex(uint16(cid))
+		if !ok {
+			return Glyph{}, nil
+		}
+		gd, err := f.LoadGlyph(gi)
+		if err != nil {
+			return Glyph{}, err
+		}
+		return Glyph{
+			Outlines: glyphOutline(fonts.GlyphOutline{Segments: gd.Outlines}, fm),
+		}, nil
+	}, nil
+}
+
+// cidGlyphsFromSFNT returns a function to load glyphs from a CIDFontType2
+// font with embedded TrueType data.
+func cidGlyphsFromSFNT(descendant pdf.Value) (func(cid int) (Glyph, error), error) {
+	file := descendant.Key("FontDescriptor").Key("FontFile2")
+	if file.IsNull() {
+		return nil, fmt.Errorf("%v does not have embedded font data", descendant.Key("BaseFont"))
+	}
+	data, err := io.ReadAll(file.Reader())
+	if err != nil {
+		return nil, err
+	}
+	f, err := truetype.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	// The CIDToGIDMap is either the name Identity or a stream of 2-byte
+	// glyph indexes, indexed by CID.
+	var cidToGID []byte
+	if m := descendant.Key("CIDToGIDMap"); m.Kind() == pdf.Stream {
+		cidToGID, err = io.ReadAll(m.Reader())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return func(cid int) (Glyph, error) {
+		gi := fonts.GID(cid)
+		if cidToGID != nil {
+			if 2*cid+1 >= len(cidToGID) {
+				return Glyph{}, nil
+			}
+			gi = fonts.GID(cidToGID[2*cid])<<8 | fonts.GID(cidToGID[2*cid+1])
+		}
+		return sfntGlyph(f, gi)
+	}, nil
+}
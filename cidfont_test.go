@@ -0,0 +1,112 @@
+package giopdf
+
+import (
+	"testing"
+
+	"gioui.org/f32"
+	"github.com/andybalholm/giopdf/cmap"
+	"github.com/andybalholm/giopdf/pdf"
+)
+
+func ints(n ...int64) []pdf.Value {
+	v := make([]pdf.Value, len(n))
+	for i, x := range n {
+		v[i] = pdf.NewInt(x)
+	}
+	return v
+}
+
+func TestReadCIDWidths(t *testing.T) {
+	w := pdf.NewArray(
+		pdf.NewInt(1), pdf.NewArray(ints(100, 200, 300)...),
+		pdf.NewInt(10), pdf.NewInt(12), pdf.NewInt(500),
+		// An inverted range is ignored.
+		pdf.NewInt(30), pdf.NewInt(20), pdf.NewInt(700),
+		// Ranges are limited to the 16-bit CIDs.
+		pdf.NewInt(65534), pdf.NewInt(2147483647), pdf.NewInt(800),
+		pdf.NewInt(-5), pdf.NewInt(-3), pdf.NewInt(900),
+	)
+	widths := make(map[int]float32)
+	readCIDWidths(w, widths)
+	want := map[int]float32{
+		1: 0.1, 2: 0.2, 3: 0.3,
+		10: 0.5, 11: 0.5, 12: 0.5,
+		65534: 0.8, 65535: 0.8,
+	}
+	if len(widths) != len(want) {
+		t.Errorf("got %d widths, want %d", len(widths), len(want))
+	}
+	for cid, x := range want {
+		if widths[cid] != x {
+			t.Errorf("CID %d: got width %v, want %v", cid, widths[cid], x)
+		}
+	}
+}
+
+func TestReadCIDVerticalMetrics(t *testing.T) {
+	w2 := pdf.NewArray(
+		pdf.NewInt(1), pdf.NewArray(ints(-1000, 500, 880, -900, 400, 800)...),
+		pdf.NewInt(10), pdf.NewInt(11), pdf.NewInt(-500), pdf.NewInt(250), pdf.NewInt(440),
+		pdf.NewInt(21), pdf.NewInt(20), pdf.NewInt(-500), pdf.NewInt(250), pdf.NewInt(440),
+	)
+	metrics := make(map[int]verticalMetrics)
+	readCIDVerticalMetrics(w2, metrics)
+	want := map[int]verticalMetrics{
+		1:  {advance: -1, position: f32.Pt(0.5, 0.88), hasPosition: true},
+		2:  {advance: -0.9, position: f32.Pt(0.4, 0.8), hasPosition: true},
+		10: {advance: -0.5, position: f32.Pt(0.25, 0.44), hasPosition: true},
+		11: {advance: -0.5, position: f32.Pt(0.25, 0.44), hasPosition: true},
+	}
+	if len(metrics) != len(want) {
+		t.Errorf("got %d entries, want %d", len(metrics), len(want))
+	}
+	for cid, vm := range want {
+		if got := metrics[cid]; got != vm {
+			t.Errorf("CID %d: got %+v, want %+v", cid, got, vm)
+		}
+	}
+
+	// A range that covers every CID stops at 65535.
+	metrics = make(map[int]verticalMetrics)
+	readCIDVerticalMetrics(pdf.NewArray(ints(0, 2147483647, -1000, 0, 0)...), metrics)
+	if len(metrics) != maxCID+1 {
+		t.Errorf("got %d entries, want %d", len(metrics), maxCID+1)
+	}
+}
+
+func TestCompositeFontVerticalPosition(t *testing.T) {
+	identity, err := cmap.Predefined("Identity-V")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &CompositeFont{
+		cmap:            identity,
+		loadGlyph:       func(cid int) (Glyph, error) { return Glyph{}, nil },
+		glyphs:          make(map[int]Glyph),
+		defaultWidth:    1,
+		widths:          map[int]float32{1: 0.6},
+		defaultVertical: verticalMetrics{advance: -1, position: f32.Pt(0, 0.88)},
+		verticalMetrics: map[int]verticalMetrics{
+			2: {advance: -0.5, position: f32.Pt(0.1, 0.7), hasPosition: true},
+		},
+	}
+	if !f.Vertical() {
+		t.Error("Identity-V font isn't vertical")
+	}
+	for _, c := range []struct {
+		cid     int
+		advance float32
+		pos     f32.Point
+	}{
+		// Without W2 entries, the X position is half the width.
+		{1, -1, f32.Pt(0.3, 0.88)},
+		{3, -1, f32.Pt(0.5, 0.88)},
+		// W2 gives the position explicitly.
+		{2, -0.5, f32.Pt(0.1, 0.7)},
+	} {
+		g := f.glyph(c.cid)
+		if g.VerticalAdvance != c.advance || g.Position != c.pos {
+			t.Errorf("CID %d: got advance %v, position %v; want %v, %v", c.cid, g.VerticalAdvance, g.Position, c.advance, c.pos)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package cmap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// The compact binary form of a CMap, used for the predefined CMaps, is a
+// sequence of unsigned varints and length-prefixed strings:
+//
+//	magic "CMAP1"
+//	Name, Registry, Ordering, name of UseCMap (strings)
+//	Supplement, WMode
+//	number of codespace ranges, then for each: n, lo (n bytes), hi (n bytes)
+//	number of CID ranges, then for each: n, lo delta, hi-lo, CID delta
+//	number of notdef ranges, in the same form as the CID ranges
+//
+// The ranges are sorted by code length and starting code. Each lo delta is
+// the difference from the previous range's lo (or from 0 when the code
+// length changes), and each CID delta is the zigzag-encoded difference from
+// the CID that would continue the previous range.
+const magic = "CMAP1"
+
+// MarshalBinary encodes m in the compact binary form used for predefined
+// CMaps. UseCMap is recorded by name only.
+func (m *CMap) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(magic)
+
+	var tmp [binary.MaxVarintLen64]byte
+	writeUint := func(x uint64) {
+		n := binary.PutUvarint(tmp[:], x)
+		buf.Write(tmp[:n])
+	}
+	writeString := func(s string) {
+		writeUint(uint64(len(s)))
+		buf.WriteString(s)
+	}
+	writeRanges := func(ranges []cidRange) {
+		writeUint(uint64(len(ranges)))
+		var prev cidRange
+		for _, r := range ranges {
+			if r.n != prev.n {
+				prev = cidRange{n: r.n}
+			}
+			writeUint(uint64(r.n))
+			writeUint(uint64(r.lo - prev.lo))
+			writeUint(uint64(r.hi - r.lo))
+			d := int64(r.cid) - int64(prev.cid+int(prev.hi-prev.lo)+1)
+			writeUint(uint64(d<<1) ^ uint64(d>>63))
+			prev = r
+		}
+	}
+
+	var useCMap string
+	if m.UseCMap != nil {
+		useCMap = m.UseCMap.Name
+	}
+	writeString(m.Name)
+	writeString(m.Registry)
+	writeString(m.Ordering)
+	writeString(useCMap)
+	writeUint(uint64(m.Supplement))
+	writeUint(uint64(m.WMode))
+
+	writeUint(uint64(len(m.codespace)))
+	for _, r := range m.codespace {
+		writeUint(uint64(r.n))
+		buf.Write(r.lo[:r.n])
+		buf.Write(r.hi[:r.n])
+	}
+
+	cids := append([]cidRange(nil), m.cids...)
+	sortRanges(cids)
+	writeRanges(cids)
+	notdefs := append([]cidRange(nil), m.notdefs...)
+	sortRanges(notdefs)
+	writeRanges(notdefs)
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a CMap encoded by MarshalBinary. If the encoded
+// CMap is based on another one, UnmarshalBinary loads it with Predefined.
+func (m *CMap) UnmarshalBinary(data []byte) error {
+	if !bytes.HasPrefix(data, []byte(magic)) {
+		return errors.New("cmap: invalid binary CMap")
+	}
+	r := bytes.NewReader(data[len(magic):])
+
+	var err error
+	readUint := func() int {
+		if err != nil {
+			return 0
+		}
+		var x uint64
+		x, err = binary.ReadUvarint(r)
+		return int(x)
+	}
+	readBytes := func(n int) []byte {
+		if err != nil {
+			return nil
+		}
+		if n > r.Len() {
+			err = io.ErrUnexpectedEOF
+			return nil
+		}
+		b := make([]byte, n)
+		r.Read(b)
+		return b
+	}
+	readString := func() string {
+		return string(readBytes(readUint()))
+	}
+	readRanges := func() []cidRange {
+		count := readUint()
+		if err != nil || count > r.Len() {
+			err = io.ErrUnexpectedEOF
+			return nil
+		}
+		ranges := make([]cidRange, count)
+		var prev cidRange
+		for i := range ranges {
+			n := readUint()
+			if n != prev.n {
+				prev = cidRange{n: n}
+			}
+			lo := prev.lo + uint32(readUint())
+			hi := lo + uint32(readUint())
+			z := uint64(readUint())
+			d := int64(z>>1) ^ -int64(z&1)
+			cid := int(int64(prev.cid+int(prev.hi-prev.lo)+1) + d)
+			ranges[i] = cidRange{n: n, lo: lo, hi: hi, cid: cid}
+			prev = ranges[i]
+		}
+		return ranges
+	}
+
+	m.Name = readString()
+	m.Registry = readString()
+	m.Ordering = readString()
+	useCMap := readString()
+	m.Supplement = readUint()
+	m.WMode = readUint()
+
+	n := readUint()
+	if err == nil && n > r.Len() {
+		err = io.ErrUnexpectedEOF
+	}
+	if err == nil {
+		m.codespace = make([]codespaceRange, n)
+	}
+	for i := range m.codespace {
+		cs := codespaceRange{n: readUint()}
+		if cs.n < 1 || cs.n > 4 {
+			return fmt.Errorf("cmap: invalid code length %d", cs.n)
+		}
+		copy(cs.lo[:], readBytes(cs.n))
+		copy(cs.hi[:], readBytes(cs.n))
+		m.codespace[i] = cs
+	}
+
+	m.cids = readRanges()
+	m.notdefs = readRanges()
+	if err != nil {
+		return fmt.Errorf("cmap: decoding %s: %v", m.Name, err)
+	}
+
+	if useCMap != "" {
+		m.UseCMap, err = Predefined(useCMap)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+// Package cmap implements CMaps, which map the character codes in the
+// strings shown with a composite font to CIDs.
+//
+// A CMap is either embedded in a PDF file as a stream, in which case it can be
+// read with Parse, or referred to by the name of one of the predefined CMaps
+// published by Adobe, in which case it can be loaded with Predefined.
+package cmap
+
+import "sort"
+
+// A CMap maps character codes to CIDs.
+type CMap struct {
+	Name string
+
+	// Registry, Ordering, and Supplement identify the character collection
+	// that the CIDs belong to (from the CIDSystemInfo dictionary).
+	Registry   string
+	Ordering   string
+	Supplement int
+
+	// WMode is the writing mode: 0 for horizontal, or 1 for vertical.
+	WMode int
+
+	// UseCMap is the CMap that this one is based on (from the usecmap
+	// operator or the UseCMap entry in a CMap stream dictionary), or nil.
+	// Mappings in UseCMap apply to codes that are not mapped by this CMap.
+	UseCMap *CMap
+
+	codespace []codespaceRange
+	cids      []cidRange
+	notdefs   []cidRange
+}
+
+// A codespaceRange is a range of valid character codes. The range applies
+// to each byte of the code separately: a code matches if each of its bytes is
+// between the corresponding bytes of lo and hi.
+type codespaceRange struct {
+	n      int
+	lo, hi [4]byte
+}
+
+func (r codespaceRange) contains(s string) bool {
+	for i := 0; i < r.n; i++ {
+		if s[i] < r.lo[i] || s[i] > r.hi[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// A cidRange maps n-byte character codes from lo through hi to consecutive
+// CIDs, starting with cid. (In a notdef range, all of the codes map to the
+// same CID.)
+type cidRange struct {
+	n      int
+	lo, hi uint32
+	cid    int
+}
+
+// sortRanges sorts ranges by code length and then by starting code, so that
+// they can be searched with findRange.
+func sortRanges(ranges []cidRange) {
+	sort.SliceStable(ranges, func(i, j int) bool {
+		if ranges[i].n != ranges[j].n {
+			return ranges[i].n < ranges[j].n
+		}
+		return ranges[i].lo < ranges[j].lo
+	})
+}
+
+// findRange returns the last range in the sorted slice ranges that contains
+// code (as an n-byte code), or nil if there is none.
+func findRange(ranges []cidRange, code uint32, n int) *cidRange {
+	i := sort.Search(len(ranges), func(i int) bool {
+		r := ranges[i]
+		return r.n > n || r.n == n && r.lo > code
+	})
+	// Ranges can overlap, so search backward from the last range that
+	// starts at or before code.
+	for i--; i >= 0 && ranges[i].n == n; i-- {
+		if ranges[i].lo <= code && code <= ranges[i].hi {
+			return &ranges[i]
+		}
+	}
+	return nil
+}
+
+// codeLength returns the length of the first character code in s, based on
+// the codespace ranges of m and its parents.
+func (m *CMap) codeLength(s string) int {
+	shortest := 0
+	for c := m; c != nil; c = c.UseCMap {
+		for _, r := range c.codespace {
+			if r.n <= len(s) && r.contains(s) {
+				return r.n
+			}
+			if shortest == 0 || r.n < shortest {
+				shortest = r.n
+			}
+		}
+	}
+	// The code doesn't match any codespace range; consume as many bytes as
+	// the shortest range would.
+	if shortest == 0 || shortest > len(s) {
+		return 1
+	}
+	return shortest
+}
+
+// Decode decodes the first character code in s, returning the code, its
+// length in bytes, and the corresponding CID. Codes that are not mapped
+// by the CMap produce CID 0, unless a notdef range says otherwise.
+func (m *CMap) Decode(s string) (code uint32, n int, cid int) {
+	n = m.codeLength(s)
+	for i := 0; i < n && i < len(s); i++ {
+		code = code<<8 | uint32(s[i])
+	}
+	return code, n, m.CID(code, n)
+}
+
+// CID returns the CID for an n-byte character code.
+func (m *CMap) CID(code uint32, n int) int {
+	for c := m; c != nil; c = c.UseCMap {
+		if r := findRange(c.cids, code, n); r != nil {
+			return r.cid + int(code-r.lo)
+		}
+	}
+	for c := m; c != nil; c = c.UseCMap {
+		if r := findRange(c.notdefs, code, n); r != nil {
+			return r.cid
+		}
+	}
+	return 0
+}
+
+// CIDs decodes all the character codes in s and returns their CIDs.
+func (m *CMap) CIDs(s string) []int {
+	var cids []int
+	for len(s) > 0 {
+		_, n, cid := m.Decode(s)
+		cids = append(cids, cid)
+		if n > len(s) {
+			break
+		}
+		s = s[n:]
+	}
+	return cids
+}
+
+// Codes returns the inverse of m: the character codes that map to each CID,
+// as big-endian byte strings, shortest first and then in increasing order.
+// Codes mapped by a CMap that m is based on are included unless m overrides
+// them. Notdef ranges are not included.
+func (m *CMap) Codes() map[int][]string {
+	codes := make(map[int][]string)
+	for c := m; c != nil; c = c.UseCMap {
+		for _, r := range c.cids {
+			for code := r.lo; code <= r.hi && code >= r.lo; code++ {
+				cid := r.cid + int(code-r.lo)
+				// The range may be overridden by a later one, or by
+				// one in the CMap that is based on this one.
+				if m.CID(code, r.n) == cid {
+					codes[cid] = append(codes[cid], codeString(code, r.n))
+				}
+			}
+		}
+	}
+	for cid, list := range codes {
+		sort.Slice(list, func(i, j int) bool {
+			if len(list[i]) != len(list[j]) {
+				return len(list[i]) < len(list[j])
+			}
+			return list[i] < list[j]
+		})
+		// Remove duplicates, from overlapping ranges.
+		j := 0
+		for i := range list {
+			if i == 0 || list[i] != list[j-1] {
+				list[j] = list[i]
+				j++
+			}
+		}
+		codes[cid] = list[:j]
+	}
+	return codes
+}
+
+// codeString returns code as an n-byte big-endian string.
+func codeString(code uint32, n int) string {
+	b := make([]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		b[i] = byte(code)
+		code >>= 8
+	}
+	return string(b)
+}
+
+func identity(name string, wmode int) *CMap {
+	return &CMap{
+		Name:     name,
+		Registry: "Adobe",
+		Ordering: "Identity",
+		WMode:    wmode,
+		codespace: []codespaceRange{
+			{n: 2, lo: [4]byte{0x00, 0x00}, hi: [4]byte{0xff, 0xff}},
+		},
+		cids: []cidRange{
+			{n: 2, lo: 0, hi: 0xffff, cid: 0},
+		},
+	}
+}
@@ -0,0 +1,154 @@
+package cmap
+
+import (
+	"reflect"
+	"testing"
+)
+
+const testCMap = `%!PS-Adobe-3.0 Resource-CMap
+/CIDInit /ProcSet findresource begin
+12 dict begin
+begincmap
+/CIDSystemInfo 3 dict dup begin
+  /Registry (Adobe) def
+  /Ordering (Japan1) def
+  /Supplement 2 def
+end def
+/CMapName /Test-V def
+/WMode 1 def
+/Identity-H usecmap
+2 begincodespacerange
+<00> <80>
+<8140> <9ffc>
+endcodespacerange
+1 beginnotdefrange
+<00> <1f> 231
+endnotdefrange
+2 begincidrange
+<20> <7e> 231
+<8140> <817e> 633
+endcidrange
+1 begincidchar
+<8150> 9000
+endcidchar
+endcmap
+CMapName currentdict /CMap defineresource pop
+end
+end
+`
+
+func TestParse(t *testing.T) {
+	m, err := Parse([]byte(testCMap))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Name != "Test-V" || m.Registry != "Adobe" || m.Ordering != "Japan1" || m.Supplement != 2 || m.WMode != 1 {
+		t.Errorf("wrong header: %+v", m)
+	}
+	if m.UseCMap == nil || m.UseCMap.Name != "Identity-H" {
+		t.Errorf("usecmap not resolved: %v", m.UseCMap)
+	}
+
+	cids := m.CIDs("A\x05\x81\x41\x81\x50\xa0\x01")
+	// A is in the 1-byte cidrange; 0x05 is in the notdef range; 0x8141 is in
+	// the 2-byte cidrange; 0x8150 is overridden by cidchar; 0xa001 is
+	// outside the codespace, but matches Identity-H.
+	want := []int{231 + 'A' - 0x20, 231, 634, 9000, 0xa001}
+	if !reflect.DeepEqual(cids, want) {
+		t.Errorf("got CIDs %v, want %v", cids, want)
+	}
+
+	b, err := m.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m2 := new(CMap)
+	if err := m2.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	sortRanges(m.cids)
+	if !reflect.DeepEqual(m, m2) {
+		t.Errorf("round trip through binary form:\ngot  %+v\nwant %+v", m2, m)
+	}
+}
+
+func TestPredefined(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		ordering string
+		wmode    int
+		code     string
+		want     []int
+	}{
+		{"UniGB-UCS2-H", "GB1", 0, "\x4e\x00", []int{4162}},
+		{"GBK-EUC-H", "GB1", 0, "A\xd2\xbb", []int{846, 4162}},
+		{"ETen-B5-H", "CNS1", 0, "\xa4\x40", []int{595}},
+		{"UniCNS-UTF16-H", "CNS1", 0, "\x4e\x00", []int{595}},
+		{"90ms-RKSJ-H", "Japan1", 0, "\x81\x40 A", []int{633, 231, 264}},
+		{"90ms-RKSJ-V", "Japan1", 1, "\x81\x40\x81\x43", []int{633, 8268}},
+		{"UniJIS-UTF16-H", "Japan1", 0, "\x4e\x00\xd8\x40\xdc\x0b", []int{1200, 13839}},
+		{"KSCms-UHC-H", "Korea1", 0, "\xb0\xa1", []int{1086}},
+		{"UniKS-UCS2-H", "Korea1", 0, "\xac\x00", []int{1086}},
+	} {
+		m, err := Predefined(c.name)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if m.Name != c.name || m.Registry != "Adobe" || m.Ordering != c.ordering || m.WMode != c.wmode {
+			t.Errorf("%s: wrong header: %+v", c.name, m)
+		}
+		if got := m.CIDs(c.code); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got CIDs %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestParseUsePredefined(t *testing.T) {
+	m, err := Parse([]byte(`/CIDInit /ProcSet findresource begin
+12 dict begin
+begincmap
+/90ms-RKSJ-H usecmap
+/CMapName /Test-RKSJ-V def
+/WMode 1 def
+1 begincidchar
+<8143> 8268
+endcidchar
+endcmap
+end
+end
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.UseCMap == nil || m.UseCMap.Name != "90ms-RKSJ-H" {
+		t.Fatalf("usecmap not resolved: %v", m.UseCMap)
+	}
+	if got, want := m.CIDs("\x81\x40\x81\x43"), []int{633, 8268}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got CIDs %v, want %v", got, want)
+	}
+}
+
+func TestCodes(t *testing.T) {
+	m, err := Predefined("UniJIS-UCS2-H")
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes := m.Codes()
+	// U+4E00 and the Kangxi radical U+2F00 share a CID.
+	if got, want := codes[1200], []string{"\x2f\x00", "\x4e\x00"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("codes for CID 1200: got %q, want %q", got, want)
+	}
+	// The V CMap overrides some codes of the H CMap that it is based on.
+	v, err := Predefined("UniJIS-UCS2-V")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vcodes := v.Codes()
+	if got, want := vcodes[7887], []string{"\x30\x01"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("vertical codes for CID 7887: got %q, want %q", got, want)
+	}
+	if got := vcodes[634]; len(got) != 0 {
+		t.Errorf("vertical codes for CID 634: got %q, want none", got)
+	}
+}
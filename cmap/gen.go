@@ -0,0 +1,82 @@
+//go:build ignore
+
+// gen.go converts Adobe's CMap resources to the compact form that is embedded
+// in the cmap package.
+//
+// Usage:
+//
+//	go run gen.go -o predefined path/to/cmap-resources
+//
+// where cmap-resources is a checkout of
+// https://github.com/adobe-type-tools/cmap-resources.
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/andybalholm/giopdf/cmap"
+)
+
+var outDir = flag.String("o", "predefined", "directory to write the CMaps to")
+
+// useCMapPattern matches the usecmap operator. The CMaps are converted
+// separately, so the parent CMap is recorded only by name.
+var useCMapPattern = regexp.MustCompile(`/([^\s/]+)\s+usecmap`)
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 1 {
+		log.Fatal("usage: go run gen.go [-o dir] path/to/cmap-resources")
+	}
+
+	files, err := filepath.Glob(filepath.Join(flag.Arg(0), "*", "CMap", "*"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		log.Fatal(err)
+	}
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		var parent string
+		if m := useCMapPattern.FindSubmatchIndex(data); m != nil {
+			parent = string(data[m[2]:m[3]])
+			data = append(data[:m[0]:m[0]], data[m[1]:]...)
+		}
+
+		m, err := cmap.Parse(data)
+		if err != nil {
+			log.Printf("skipping %s: %v", file, err)
+			continue
+		}
+		if m.Name == "" {
+			m.Name = filepath.Base(file)
+		}
+		if parent != "" {
+			m.UseCMap = &cmap.CMap{Name: parent}
+		}
+
+		b, err := m.MarshalBinary()
+		if err != nil {
+			log.Fatal(err)
+		}
+		var buf bytes.Buffer
+		w, _ := flate.NewWriter(&buf, flate.BestCompression)
+		w.Write(b)
+		w.Close()
+		if err := os.WriteFile(filepath.Join(*outDir, m.Name), buf.Bytes(), 0644); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package cmap
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	tk "github.com/benoitkugler/pstokenizer"
+)
+
+// Parse parses the PostScript source of a CMap, as found in an embedded CMap
+// stream or a CMap resource file. CMaps named with the usecmap operator are
+// loaded with Predefined.
+func Parse(data []byte) (*CMap, error) {
+	m := new(CMap)
+	t := tk.NewTokenizer(data)
+	var stack []tk.Token
+
+	// pop removes the top n tokens from the stack and returns them in their
+	// original order.
+	pop := func(n int) ([]tk.Token, error) {
+		if len(stack) < n {
+			return nil, errors.New("cmap: stack underflow")
+		}
+		args := stack[len(stack)-n:]
+		stack = stack[:len(stack)-n]
+		return args, nil
+	}
+
+	for {
+		tok, err := t.NextToken()
+		if err != nil {
+			return nil, fmt.Errorf("cmap: %v", err)
+		}
+		if tok.Kind == tk.EOF {
+			break
+		}
+		if tok.Kind == tk.EndDic || tok.Kind == tk.EndArray {
+			// Replace the dictionary or array with a placeholder, so that it
+			// takes up one place on the stack. The only dictionary whose
+			// contents matter is CIDSystemInfo.
+			start := tk.StartDic
+			if tok.Kind == tk.EndArray {
+				start = tk.StartArray
+			}
+			i := len(stack) - 1
+			for i >= 0 && stack[i].Kind != start {
+				i--
+			}
+			if i < 0 {
+				return nil, fmt.Errorf("cmap: unexpected %v", tok.Kind)
+			}
+			if start == tk.StartDic {
+				for j := i + 1; j+1 < len(stack); j += 2 {
+					if stack[j].Kind == tk.Name {
+						m.setKey(string(stack[j].Value), stack[j+1])
+					}
+				}
+			}
+			stack = append(stack[:i], tk.Token{Kind: start})
+			continue
+		}
+		if tok.Kind != tk.Other {
+			stack = append(stack, tok)
+			continue
+		}
+
+		switch op := string(tok.Value); op {
+		case "def":
+			args, err := pop(2)
+			if err != nil {
+				return nil, err
+			}
+			if args[0].Kind == tk.Name {
+				m.setKey(string(args[0].Value), args[1])
+			}
+
+		case "usecmap":
+			args, err := pop(1)
+			if err != nil {
+				return nil, err
+			}
+			m.UseCMap, err = Predefined(string(args[0].Value))
+			if err != nil {
+				return nil, err
+			}
+
+		case "begincodespacerange", "begincidrange", "begincidchar", "beginnotdefrange", "beginnotdefchar", "beginbfrange", "beginbfchar":
+			// The count is redundant, since the section is terminated by the
+			// corresponding end operator.
+			if len(stack) > 0 && stack[len(stack)-1].Kind == tk.Integer {
+				stack = stack[:len(stack)-1]
+			}
+			stack = append(stack, tok)
+
+		case "endcodespacerange":
+			args, err := popSection(&stack, "begincodespacerange", 2)
+			if err != nil {
+				return nil, err
+			}
+			for i := 0; i < len(args); i += 2 {
+				lo, hi := args[i].Value, args[i+1].Value
+				if len(lo) == 0 || len(lo) > 4 || len(lo) != len(hi) {
+					return nil, fmt.Errorf("cmap: bad codespace range <%x> <%x>", lo, hi)
+				}
+				r := codespaceRange{n: len(lo)}
+				copy(r.lo[:], lo)
+				copy(r.hi[:], hi)
+				m.codespace = append(m.codespace, r)
+			}
+
+		case "endcidrange", "endnotdefrange":
+			args, err := popSection(&stack, "begin"+op[3:], 3)
+			if err != nil {
+				return nil, err
+			}
+			for i := 0; i < len(args); i += 3 {
+				r, err := makeRange(args[i].Value, args[i+1].Value, args[i+2])
+				if err != nil {
+					return nil, err
+				}
+				if op == "endcidrange" {
+					m.cids = append(m.cids, r)
+				} else {
+					m.notdefs = append(m.notdefs, r)
+				}
+			}
+
+		case "endcidchar", "endnotdefchar":
+			args, err := popSection(&stack, "begin"+op[3:], 2)
+			if err != nil {
+				return nil, err
+			}
+			for i := 0; i < len(args); i += 2 {
+				r, err := makeRange(args[i].Value, args[i].Value, args[i+1])
+				if err != nil {
+					return nil, err
+				}
+				if op == "endcidchar" {
+					m.cids = append(m.cids, r)
+				} else {
+					m.notdefs = append(m.notdefs, r)
+				}
+			}
+
+		case "endbfrange", "endbfchar":
+			// Mappings to Unicode belong in ToUnicode CMaps, which are handled
+			// by the pdf package.
+			if _, err := popSection(&stack, "begin"+op[3:], 1); err != nil {
+				return nil, err
+			}
+
+		default:
+			// Operators like begincmap, findresource, defineresource, begin,
+			// end, and dict don't affect the mapping.
+		}
+	}
+
+	sortRanges(m.cids)
+	sortRanges(m.notdefs)
+	return m, nil
+}
+
+// popSection pops the operands of a section (such as begincidrange ...
+// endcidrange) off the stack, and checks that their number is a multiple of
+// stride.
+func popSection(stack *[]tk.Token, begin string, stride int) ([]tk.Token, error) {
+	s := *stack
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i].Kind == tk.Other && string(s[i].Value) == begin {
+			args := s[i+1:]
+			*stack = s[:i]
+			if len(args)%stride != 0 {
+				return nil, fmt.Errorf("cmap: wrong number of operands for %s", begin)
+			}
+			return args, nil
+		}
+	}
+	return nil, fmt.Errorf("cmap: missing %s", begin)
+}
+
+// makeRange makes a cidRange from the operands of cidrange or cidchar.
+func makeRange(lo, hi []byte, cid tk.Token) (cidRange, error) {
+	if len(lo) == 0 || len(lo) > 4 || len(lo) != len(hi) {
+		return cidRange{}, fmt.Errorf("cmap: bad code range <%x> <%x>", lo, hi)
+	}
+	c, err := cid.Int()
+	if err != nil || cid.Kind != tk.Integer {
+		return cidRange{}, fmt.Errorf("cmap: bad CID %q", cid.Value)
+	}
+	r := cidRange{n: len(lo), cid: c}
+	for i := range lo {
+		r.lo = r.lo<<8 | uint32(lo[i])
+		r.hi = r.hi<<8 | uint32(hi[i])
+	}
+	if r.hi < r.lo {
+		return cidRange{}, fmt.Errorf("cmap: bad code range <%x> <%x>", lo, hi)
+	}
+	return r, nil
+}
+
+// setKey handles a def operator, which may set one of the CMap's properties.
+func (m *CMap) setKey(key string, val tk.Token) {
+	switch key {
+	case "CMapName":
+		m.Name = string(val.Value)
+	case "Registry":
+		m.Registry = string(val.Value)
+	case "Ordering":
+		m.Ordering = string(val.Value)
+	case "Supplement":
+		m.Supplement, _ = strconv.Atoi(string(val.Value))
+	case "WMode":
+		m.WMode, _ = strconv.Atoi(string(val.Value))
+	}
+}
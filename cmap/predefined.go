@@ -0,0 +1,62 @@
+package cmap
+
+import (
+	"compress/flate"
+	"embed"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// To regenerate the predefined CMaps, set CMAP_RESOURCES to the path of a
+// checkout of https://github.com/adobe-type-tools/cmap-resources and run
+// go generate.
+//
+//go:generate go run gen.go -o predefined $CMAP_RESOURCES
+
+// The predefined CMaps are stored in the compact binary form produced by
+// MarshalBinary, compressed with DEFLATE. They are generated from Adobe's
+// CMap resources (https://github.com/adobe-type-tools/cmap-resources) by
+// gen.go.
+//
+//go:embed predefined
+var predefinedFiles embed.FS
+
+var (
+	predefinedMu    sync.Mutex
+	predefinedCMaps = map[string]*CMap{
+		"Identity-H": identity("Identity-H", 0),
+		"Identity-V": identity("Identity-V", 1),
+	}
+)
+
+// Predefined returns the predefined CMap with the specified name, such as
+// "Identity-H" or "UniJIS-UTF16-H". The returned CMap is shared, and must
+// not be modified.
+func Predefined(name string) (*CMap, error) {
+	predefinedMu.Lock()
+	m, ok := predefinedCMaps[name]
+	predefinedMu.Unlock()
+	if ok {
+		return m, nil
+	}
+
+	f, err := predefinedFiles.Open("predefined/" + name)
+	if err != nil {
+		return nil, fmt.Errorf("cmap: unknown predefined CMap %q", name)
+	}
+	defer f.Close()
+	data, err := io.ReadAll(flate.NewReader(f))
+	if err != nil {
+		return nil, fmt.Errorf("cmap: reading predefined CMap %q: %v", name, err)
+	}
+	m = new(CMap)
+	if err := m.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+
+	predefinedMu.Lock()
+	predefinedCMaps[name] = m
+	predefinedMu.Unlock()
+	return m, nil
+}
@@ -0,0 +1,444 @@
+package giopdf
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"gioui.org/f32"
+	"github.com/andybalholm/giopdf/pdf"
+)
+
+// A TextChar is a character (or a short sequence of characters, such as a
+// ligature) shown by one glyph. Coordinates are in the default user space of
+// the page.
+type TextChar struct {
+	Text   string
+	Origin f32.Point
+
+	// Dir is a unit vector in the writing direction.
+	Dir f32.Point
+
+	// Size is the font size, scaled by the transformations in effect.
+	Size float32
+
+	// Advance is the distance from Origin to the end of the glyph, along Dir.
+	Advance float32
+
+	Bounds f32.Rectangle
+}
+
+// A TextWord is a sequence of characters without space between them.
+type TextWord struct {
+	Text   string
+	Chars  []TextChar
+	Bounds f32.Rectangle
+}
+
+// A TextLine is a sequence of words on a common baseline.
+type TextLine struct {
+	Words  []TextWord
+	Dir    f32.Point
+	Bounds f32.Rectangle
+}
+
+// Text returns the words of l, separated by spaces.
+func (l TextLine) Text() string {
+	words := make([]string, len(l.Words))
+	for i, w := range l.Words {
+		words[i] = w.Text
+	}
+	return strings.Join(words, " ")
+}
+
+// A TextBlock is a group of adjacent lines, such as a paragraph or a column.
+type TextBlock struct {
+	Lines  []TextLine
+	Bounds f32.Rectangle
+}
+
+// Text returns the lines of b, separated by newlines.
+func (b TextBlock) Text() string {
+	lines := make([]string, len(b.Lines))
+	for i, l := range b.Lines {
+		lines[i] = l.Text()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// PageText is the text of a page, grouped into blocks in reading order.
+type PageText struct {
+	Blocks []TextBlock
+}
+
+// String returns the text of the page as plain text, with a blank line
+// between blocks.
+func (t *PageText) String() string {
+	blocks := make([]string, len(t.Blocks))
+	for i, b := range t.Blocks {
+		blocks[i] = b.Text()
+	}
+	return strings.Join(blocks, "\n\n")
+}
+
+// ExtractText extracts the text from a page, by interpreting its content
+// stream with the same text state as RenderPage. The characters are grouped
+// into words, lines, and blocks, based on their positions.
+//
+// If the page is malformed, ExtractText returns an error along with the text
+// found before the error, so the text may be partial.
+func ExtractText(page pdf.Page) (*PageText, error) {
+	var chars []TextChar
+	c := NewCanvas(nil)
+	c.textHandler = func(g Glyph, m f32.Affine2D, vertical bool) {
+		chars = append(chars, makeTextChar(g, m, vertical))
+	}
+	err := renderPage(c, page, NoAnnotations)
+	return layoutText(chars), err
+}
+
+// makeTextChar converts a glyph to a TextChar, given the matrix that maps
+// glyph space to page space.
+func makeTextChar(g Glyph, m f32.Affine2D, vertical bool) TextChar {
+	tc := TextChar{Text: g.Text}
+	origin := m.Transform(f32.Pt(0, 0))
+	up := m.Transform(f32.Pt(0, 1)).Sub(origin)
+	tc.Size = length(up)
+
+	if vertical {
+		tc.Origin = m.Transform(g.Position)
+		tc.Dir = normalize(up.Mul(-1))
+		tc.Advance = -g.VerticalAdvance * tc.Size
+	} else {
+		tc.Origin = origin
+		tc.Dir = normalize(m.Transform(f32.Pt(1, 0)).Sub(origin))
+		tc.Advance = g.Width * length(m.Transform(f32.Pt(1, 0)).Sub(origin))
+	}
+
+	// The glyph's box, roughly from the descender to the ascender.
+	for i, p := range []f32.Point{{X: 0, Y: -0.2}, {X: g.Width, Y: -0.2}, {X: 0, Y: 0.8}, {X: g.Width, Y: 0.8}} {
+		p = m.Transform(p)
+		if i == 0 {
+			tc.Bounds = f32.Rectangle{Min: p, Max: p}
+			continue
+		}
+		tc.Bounds = union(tc.Bounds, f32.Rectangle{Min: p, Max: p})
+	}
+	return tc
+}
+
+// union returns the smallest rectangle that contains both a and b. Unlike
+// f32.Rectangle.Union, it doesn't ignore empty rectangles, since the bounds
+// of a space character may have no width.
+func union(a, b f32.Rectangle) f32.Rectangle {
+	return f32.Rectangle{
+		Min: f32.Pt(min32(a.Min.X, b.Min.X), min32(a.Min.Y, b.Min.Y)),
+		Max: f32.Pt(max32(a.Max.X, b.Max.X), max32(a.Max.Y, b.Max.Y)),
+	}
+}
+
+func length(p f32.Point) float32 {
+	return float32(math.Hypot(float64(p.X), float64(p.Y)))
+}
+
+func normalize(p f32.Point) f32.Point {
+	l := length(p)
+	if l == 0 {
+		return f32.Pt(1, 0)
+	}
+	return p.Mul(1 / l)
+}
+
+// A layoutChar is a TextChar with its position expressed in the coordinate
+// system of its writing direction: along is the distance in the writing
+// direction, and across is the distance perpendicular to it, increasing
+// toward the top of the line (so that earlier lines have greater values).
+type layoutChar struct {
+	TextChar
+	along, across float32
+}
+
+// A layoutLine is a line (or a segment of a line) under construction.
+type layoutLine struct {
+	chars                []layoutChar
+	dir                  f32.Point
+	alongMin, alongMax   float32
+	acrossMin, acrossMax float32
+	baseline, size       float32
+	block                int
+}
+
+// layoutText groups chars into words, lines, and blocks.
+func layoutText(chars []TextChar) *PageText {
+	// Group the characters by writing direction, rounded to the nearest
+	// degree, so that rotated text is laid out in its own coordinate system.
+	byDir := make(map[int][]layoutChar)
+	var dirs []int
+	for _, c := range chars {
+		if c.Size == 0 {
+			continue
+		}
+		angle := int(math.Round(math.Atan2(float64(c.Dir.Y), float64(c.Dir.X))*180/math.Pi)) % 360
+		if angle < 0 {
+			angle += 360
+		}
+		if _, ok := byDir[angle]; !ok {
+			dirs = append(dirs, angle)
+		}
+		byDir[angle] = append(byDir[angle], layoutChar{TextChar: c})
+	}
+	// The most common direction comes first.
+	sort.SliceStable(dirs, func(i, j int) bool {
+		return len(byDir[dirs[i]]) > len(byDir[dirs[j]])
+	})
+
+	result := new(PageText)
+	for _, angle := range dirs {
+		rad := float64(angle) * math.Pi / 180
+		dir := f32.Pt(float32(math.Cos(rad)), float32(math.Sin(rad)))
+		normal := f32.Pt(-dir.Y, dir.X)
+		cs := byDir[angle]
+		for i := range cs {
+			cs[i].along = dot(cs[i].Origin, dir)
+			cs[i].across = dot(cs[i].Origin, normal)
+		}
+		lines := findLines(cs, dir)
+		result.Blocks = append(result.Blocks, findBlocks(lines)...)
+	}
+	return result
+}
+
+func dot(a, b f32.Point) float32 {
+	return a.X*b.X + a.Y*b.Y
+}
+
+// findLines groups characters with a common baseline into lines, and splits
+// the lines where there are gaps wide enough to be between columns.
+func findLines(cs []layoutChar, dir f32.Point) []*layoutLine {
+	sort.SliceStable(cs, func(i, j int) bool {
+		return cs[i].across > cs[j].across
+	})
+
+	var rows [][]layoutChar
+	var baseline, size float32
+	for _, c := range cs {
+		n := len(rows)
+		if n > 0 && abs(c.across-baseline) < 0.5*min32(c.Size, size) {
+			rows[n-1] = append(rows[n-1], c)
+			continue
+		}
+		rows = append(rows, []layoutChar{c})
+		baseline, size = c.across, c.Size
+	}
+
+	var lines []*layoutLine
+	for _, row := range rows {
+		sort.SliceStable(row, func(i, j int) bool {
+			return row[i].along < row[j].along
+		})
+		var line *layoutLine
+		for _, c := range row {
+			if line != nil {
+				prev := line.chars[len(line.chars)-1]
+				// Skip characters drawn twice at the same place, as is
+				// sometimes done to make fake bold text.
+				if c.Text == prev.Text && abs(c.along-prev.along) < 0.1*c.Size && abs(c.across-prev.across) < 0.1*c.Size {
+					continue
+				}
+				if c.along-line.alongMax > 2*max32(c.Size, line.size) {
+					line = nil
+				}
+			}
+			if line == nil {
+				line = &layoutLine{
+					dir:       dir,
+					alongMin:  c.along,
+					alongMax:  c.along,
+					acrossMin: c.across,
+					acrossMax: c.across,
+					baseline:  c.across,
+				}
+				lines = append(lines, line)
+			}
+			line.chars = append(line.chars, c)
+			line.alongMin = min32(line.alongMin, c.along)
+			line.alongMax = max32(line.alongMax, c.along+c.Advance)
+			line.acrossMin = min32(line.acrossMin, c.across-0.2*c.Size)
+			line.acrossMax = max32(line.acrossMax, c.across+0.8*c.Size)
+			line.size = max32(line.size, c.Size)
+		}
+	}
+	return lines
+}
+
+// findBlocks groups lines into blocks, and sorts the blocks into reading
+// order.
+func findBlocks(lines []*layoutLine) []TextBlock {
+	// Lines are sorted from top to bottom. A line joins the block of the
+	// nearest line above it that overlaps it horizontally and is close enough
+	// vertically.
+	var blocks [][]*layoutLine
+	for i, l := range lines {
+		l.block = -1
+		for j := i - 1; j >= 0; j-- {
+			above := lines[j]
+			gap := above.baseline - l.baseline
+			if gap > 2*max32(l.size, above.size) {
+				break
+			}
+			last := blocks[above.block][len(blocks[above.block])-1]
+			if gap > 0 && last == above && overlaps(l.alongMin, l.alongMax, above.alongMin, above.alongMax) {
+				l.block = above.block
+				break
+			}
+		}
+		if l.block == -1 {
+			l.block = len(blocks)
+			blocks = append(blocks, nil)
+		}
+		blocks[l.block] = append(blocks[l.block], l)
+	}
+
+	type extent struct {
+		alongMin, alongMax, acrossMin, acrossMax float32
+	}
+	extents := make([]extent, len(blocks))
+	for i, b := range blocks {
+		e := extent{b[0].alongMin, b[0].alongMax, b[0].acrossMin, b[0].acrossMax}
+		for _, l := range b[1:] {
+			e.alongMin = min32(e.alongMin, l.alongMin)
+			e.alongMax = max32(e.alongMax, l.alongMax)
+			e.acrossMin = min32(e.acrossMin, l.acrossMin)
+			e.acrossMax = max32(e.acrossMax, l.acrossMax)
+		}
+		extents[i] = e
+	}
+
+	// Block a comes before block b if it is above b and they overlap
+	// horizontally, or if it is to the left of b and they overlap vertically.
+	// Blocks are output in an order consistent with that relation, preferring
+	// the topmost and then the leftmost block when there is a choice.
+	before := func(a, b extent) bool {
+		const eps = 1
+		if overlaps(a.alongMin, a.alongMax, b.alongMin, b.alongMax) && a.acrossMin >= b.acrossMax-eps {
+			return true
+		}
+		return overlaps(a.acrossMin, a.acrossMax, b.acrossMin, b.acrossMax) && a.alongMax <= b.alongMin+eps
+	}
+	done := make([]bool, len(blocks))
+	var result []TextBlock
+	for n := 0; n < len(blocks); n++ {
+		best := -1
+		for i := range blocks {
+			if done[i] {
+				continue
+			}
+			ready := true
+			for j := range blocks {
+				if j != i && !done[j] && before(extents[j], extents[i]) {
+					ready = false
+					break
+				}
+			}
+			if !ready {
+				continue
+			}
+			if best == -1 || extents[i].acrossMax > extents[best].acrossMax ||
+				extents[i].acrossMax == extents[best].acrossMax && extents[i].alongMin < extents[best].alongMin {
+				best = i
+			}
+		}
+		if best == -1 {
+			// The relation has a cycle; just take the first remaining block.
+			for i := range blocks {
+				if !done[i] {
+					best = i
+					break
+				}
+			}
+		}
+		done[best] = true
+		// A block whose lines are all blank has no words to show.
+		if b := makeBlock(blocks[best]); len(b.Lines) > 0 {
+			result = append(result, b)
+		}
+	}
+	return result
+}
+
+func overlaps(aMin, aMax, bMin, bMax float32) bool {
+	return aMin < bMax && bMin < aMax
+}
+
+// makeBlock converts a block's lines to a TextBlock, splitting them into
+// words.
+func makeBlock(lines []*layoutLine) TextBlock {
+	var b TextBlock
+	for _, l := range lines {
+		tl := makeLine(l)
+		if len(tl.Words) == 0 {
+			continue
+		}
+		b.Lines = append(b.Lines, tl)
+		if len(b.Lines) == 1 {
+			b.Bounds = tl.Bounds
+		} else {
+			b.Bounds = union(b.Bounds, tl.Bounds)
+		}
+	}
+	return b
+}
+
+// makeLine splits a line into words, at space characters and at gaps between
+// characters.
+func makeLine(l *layoutLine) TextLine {
+	tl := TextLine{Dir: l.dir}
+	var word *TextWord
+	var end float32
+	for _, c := range l.chars {
+		if strings.TrimSpace(c.Text) == "" && c.Text != "" {
+			word = nil
+			continue
+		}
+		if word != nil && c.along-end > 0.15*c.Size {
+			word = nil
+		}
+		if word == nil {
+			tl.Words = append(tl.Words, TextWord{Bounds: c.Bounds})
+			word = &tl.Words[len(tl.Words)-1]
+		}
+		word.Text += c.Text
+		word.Chars = append(word.Chars, c.TextChar)
+		word.Bounds = union(word.Bounds, c.Bounds)
+		end = c.along + c.Advance
+	}
+	for i, w := range tl.Words {
+		if i == 0 {
+			tl.Bounds = w.Bounds
+		} else {
+			tl.Bounds = union(tl.Bounds, w.Bounds)
+		}
+	}
+	return tl
+}
+
+func abs(x float32) float32 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func min32(a, b float32) float32 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max32(a, b float32) float32 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,153 @@
+package giopdf
+
+import (
+	"strings"
+	"testing"
+
+	"gioui.org/f32"
+)
+
+// textRun returns the characters of s, shown starting at origin in the
+// direction dir, with each character half as wide as the font size.
+func textRun(s string, origin, dir f32.Point, size float32) []TextChar {
+	normal := f32.Pt(-dir.Y, dir.X)
+	var chars []TextChar
+	p := origin
+	for _, r := range s {
+		c := TextChar{Text: string(r), Origin: p, Dir: dir, Size: size, Advance: size / 2}
+		end := p.Add(dir.Mul(size / 2))
+		for i, q := range []f32.Point{
+			p.Add(normal.Mul(-0.2 * size)), end.Add(normal.Mul(-0.2 * size)),
+			p.Add(normal.Mul(0.8 * size)), end.Add(normal.Mul(0.8 * size)),
+		} {
+			if i == 0 {
+				c.Bounds = f32.Rectangle{Min: q, Max: q}
+			} else {
+				c.Bounds = union(c.Bounds, f32.Rectangle{Min: q, Max: q})
+			}
+		}
+		chars = append(chars, c)
+		p = end
+	}
+	return chars
+}
+
+// lines returns the characters of a block of horizontal text, with one line
+// per string, 12 points apart.
+func lines(x, y float32, text ...string) []TextChar {
+	var chars []TextChar
+	for i, s := range text {
+		chars = append(chars, textRun(s, f32.Pt(x, y-12*float32(i)), f32.Pt(1, 0), 10)...)
+	}
+	return chars
+}
+
+func blockTexts(t *PageText) []string {
+	var texts []string
+	for _, b := range t.Blocks {
+		texts = append(texts, b.Text())
+	}
+	return texts
+}
+
+func TestLayoutText(t *testing.T) {
+	right, up, down := f32.Pt(1, 0), f32.Pt(0, 1), f32.Pt(0, -1)
+	for _, c := range []struct {
+		name  string
+		chars []TextChar
+		want  []string
+	}{
+		{
+			name:  "words",
+			chars: textRun("Hello, world", f32.Pt(72, 700), right, 10),
+			want:  []string{"Hello, world"},
+		},
+		{
+			// Words are also separated by gaps, without a space character.
+			name:  "gap",
+			chars: append(textRun("Hello", f32.Pt(72, 700), right, 10), textRun("world", f32.Pt(100, 700), right, 10)...),
+			want:  []string{"Hello world"},
+		},
+		{
+			name: "shuffled",
+			chars: func() []TextChar {
+				cs := lines(72, 700, "first line", "second line")
+				for i, j := 0, len(cs)-1; i < j; i, j = i+1, j-1 {
+					cs[i], cs[j] = cs[j], cs[i]
+				}
+				return cs
+			}(),
+			want: []string{"first line\nsecond line"},
+		},
+		{
+			name:  "fake bold",
+			chars: append(textRun("Bold", f32.Pt(72, 700), right, 10), textRun("Bold", f32.Pt(72.3, 700), right, 10)...),
+			want:  []string{"Bold"},
+		},
+		{
+			name:  "paragraphs",
+			chars: append(lines(72, 700, "one", "two"), lines(72, 640, "three", "four")...),
+			want:  []string{"one\ntwo", "three\nfour"},
+		},
+		{
+			// The right column is drawn first, but the left one is read
+			// first.
+			name:  "columns",
+			chars: append(lines(320, 700, "right a", "right b", "right c"), lines(72, 700, "left a", "left b", "left c")...),
+			want:  []string{"left a\nleft b\nleft c", "right a\nright b\nright c"},
+		},
+		{
+			// A heading spanning both columns comes before them.
+			name: "heading",
+			chars: append(append(lines(72, 700, "left a", "left b"), lines(320, 700, "right a", "right b")...),
+				lines(72, 730, "Heading across both columns of the page")...),
+			want: []string{"Heading across both columns of the page", "left a\nleft b", "right a\nright b"},
+		},
+		{
+			// Text running up the margin is laid out separately from the
+			// main text. The tops of its lines face left.
+			name: "rotated",
+			chars: append(append(lines(72, 700, "main text", "more"), textRun("margin", f32.Pt(30, 400), up, 10)...),
+				textRun("note", f32.Pt(42, 400), up, 10)...),
+			want: []string{"main text\nmore", "margin\nnote"},
+		},
+		{
+			// Vertical text runs down the page, with the columns read
+			// from right to left.
+			name: "vertical",
+			chars: append(append(textRun("日本語", f32.Pt(500, 700), down, 10), textRun("縦書き", f32.Pt(488, 700), down, 10)...),
+				textRun("次段", f32.Pt(500, 500), down, 10)...),
+			want: []string{"日本語\n縦書き", "次段"},
+		},
+		{
+			name:  "blank",
+			chars: append(textRun("   ", f32.Pt(72, 700), right, 10), lines(72, 600, "text")...),
+			want:  []string{"text"},
+		},
+	} {
+		got := blockTexts(layoutText(c.chars))
+		if strings.Join(got, "|") != strings.Join(c.want, "|") {
+			t.Errorf("%s: got %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestLayoutTextBounds(t *testing.T) {
+	// The block starts with a line of spaces, which isn't part of it.
+	chars := append(textRun("  ", f32.Pt(72, 712), f32.Pt(1, 0), 10), lines(72, 700, "abcd", "ab")...)
+	text := layoutText(chars)
+	if len(text.Blocks) != 1 || len(text.Blocks[0].Lines) != 2 {
+		t.Fatalf("got %q, want one block with two lines", blockTexts(text))
+	}
+	want := f32.Rectangle{Min: f32.Pt(72, 686), Max: f32.Pt(92, 708)}
+	if b := text.Blocks[0].Bounds; b != want {
+		t.Errorf("got bounds %v, want %v", b, want)
+	}
+	line := text.Blocks[0].Lines[1]
+	if len(line.Words) != 1 || line.Words[0].Bounds != (f32.Rectangle{Min: f32.Pt(72, 686), Max: f32.Pt(82, 696)}) {
+		t.Errorf("got words %+v", line.Words)
+	}
+	if line.Dir != f32.Pt(1, 0) {
+		t.Errorf("got direction %v", line.Dir)
+	}
+}
@@ -22,12 +22,30 @@ import (
 type Glyph struct {
 	Outlines []PathElement
 	Width    float32
+
+	// Position is the glyph's position vector: the offset from the origin
+	// used in horizontal writing to the origin used in vertical writing.
+	// VerticalAdvance is the vertical displacement to the next glyph; it is
+	// normally negative, since vertical text runs from top to bottom.
+	// They are only used by fonts with a vertical writing mode.
+	Position        f32.Point
+	VerticalAdvance float32
+
+	// Text is the Unicode text that the glyph represents, if it is known.
+	Text string
+
+	// WordSpace is true if the glyph was selected by the single-byte
+	// character code 32, so that word spacing applies to it.
+	WordSpace bool
 }
 
 // A Font converts text strings to slices of Glyphs, so that they can be
 // displayed.
 type Font interface {
 	ToGlyphs(s string) []Glyph
+
+	// Vertical reports whether the font uses vertical writing mode.
+	Vertical() bool
 }
 
 // A SimpleFont is a font with a simple 8-bit encoding.
@@ -43,6 +61,10 @@ func (f *SimpleFont) ToGlyphs(s string) []Glyph {
 	return result
 }
 
+func (f *SimpleFont) Vertical() bool {
+	return false
+}
+
 func scalePoint(p fixed.Point26_6, ppem fixed.Int26_6) f32.Point {
 	return f32.Pt(float32(p.X)/float32(ppem), -float32(p.Y)/float32(ppem))
 }
@@ -55,10 +77,6 @@ func SimpleFontFromSFNT(data []byte, enc simpleencodings.Encoding) (*SimpleFont,
 		return nil, err
 	}
 
-	ppem := f.Upem()
-	scale := 1 / float32(ppem)
-	fm := f32.Affine2D{}.Scale(f32.Pt(0, 0), f32.Pt(scale, scale))
-
 	var GIDEncoding [256]fonts.GID
 
 	if enc != (simpleencodings.Encoding{}) {
@@ -118,17 +136,9 @@ func SimpleFontFromSFNT(data []byte, enc simpleencodings.Encoding) (*SimpleFont,
 	simple := new(SimpleFont)
 
 	for i, gi := range GIDEncoding {
-		var g Glyph
-		g.Width = f.HorizontalAdvance(gi) * scale
-
-		gd := f.GlyphData(gi, ppem, ppem)
-		switch gd := gd.(type) {
-		case fonts.GlyphOutline:
-			g.Outlines = glyphOutline(gd, fm)
-		case fonts.GlyphSVG:
-			g.Outlines = glyphOutline(gd.Outline, fm)
-		case fonts.GlyphBitmap:
-			return nil, errors.New("bitmap fonts not supported")
+		g, err := sfntGlyph(f, gi)
+		if err != nil {
+			return nil, err
 		}
 		simple.Glyphs[i] = g
 	}
@@ -136,6 +146,27 @@ func SimpleFontFromSFNT(data []byte, enc simpleencodings.Encoding) (*SimpleFont,
 	return simple, nil
 }
 
+// sfntGlyph loads glyph gi from f.
+func sfntGlyph(f *truetype.Font, gi fonts.GID) (Glyph, error) {
+	ppem := f.Upem()
+	scale := 1 / float32(ppem)
+	fm := f32.Affine2D{}.Scale(f32.Pt(0, 0), f32.Pt(scale, scale))
+
+	var g Glyph
+	g.Width = f.HorizontalAdvance(gi) * scale
+
+	gd := f.GlyphData(gi, ppem, ppem)
+	switch gd := gd.(type) {
+	case fonts.GlyphOutline:
+		g.Outlines = glyphOutline(gd, fm)
+	case fonts.GlyphSVG:
+		g.Outlines = glyphOutline(gd.Outline, fm)
+	case fonts.GlyphBitmap:
+		return Glyph{}, errors.New("bitmap fonts not supported")
+	}
+	return g, nil
+}
+
 func getEncoding(e pdf.Value) (simpleencodings.Encoding, error) {
 	switch e.Kind() {
 	case pdf.Null:
@@ -298,6 +329,10 @@ func glyphOutline(outline fonts.GlyphOutline, fm f32.Affine2D) []PathElement {
 }
 
 func importPDFFont(f pdf.Font) (font Font, err error) {
+	if f.V.Key("Subtype").Name() == "Type0" {
+		return compositeFontFromPDF(f)
+	}
+
 	enc, err := getEncoding(f.V.Key("Encoding"))
 	if err != nil {
 		return nil, err
@@ -346,16 +381,47 @@ func importPDFFont(f pdf.Font) (font Font, err error) {
 		return nil, err
 	}
 
-	// Glyph widths from the font dictionary override widths from the font itself.
 	if simple, ok := font.(*SimpleFont); ok {
-		firstChar := f.V.Key("FirstChar").Int()
-		lastChar := f.V.Key("LastChar").Int()
-		widths := f.V.Key("Widths")
-
-		for i := firstChar; i <= lastChar; i++ {
-			simple.Glyphs[i].Width = widths.Index(i-firstChar).Float32() / 1000
-		}
+		applySimpleFontDict(simple, f)
 	}
 
 	return font, nil
 }
+
+// applySimpleFontDict sets the widths and text of a simple font's glyphs from
+// the PDF font dictionary.
+func applySimpleFontDict(simple *SimpleFont, f pdf.Font) {
+	// Glyph widths from the font dictionary override widths from the font itself.
+	firstChar := f.V.Key("FirstChar").Int()
+	lastChar := f.V.Key("LastChar").Int()
+	widths := f.V.Key("Widths")
+
+	for i := firstChar; i <= lastChar && i < 256; i++ {
+		simple.Glyphs[i].Width = widths.Index(i-firstChar).Float32() / 1000
+	}
+
+	enc := f.Encoder()
+	for i := range simple.Glyphs {
+		simple.Glyphs[i].Text = enc.Decode(string([]byte{byte(i)}))
+	}
+	simple.Glyphs[' '].WordSpace = true
+}
+
+// fallbackFont returns a font with no outlines, but with the metrics and text
+// from the font dictionary, for when the font program can't be loaded. This
+// keeps the text position correct, and lets the text be extracted.
+func fallbackFont(f pdf.Font) Font {
+	if f.V.Key("Subtype").Name() == "Type0" {
+		return nil
+	}
+	font := new(SimpleFont)
+	missing := float32(0.5)
+	if mw := f.V.Key("FontDescriptor").Key("MissingWidth"); !mw.IsNull() {
+		missing = mw.Float32() / 1000
+	}
+	for i := range font.Glyphs {
+		font.Glyphs[i].Width = missing
+	}
+	applySimpleFontDict(font, f)
+	return font
+}
@@ -6,6 +6,7 @@ require (
 	gioui.org v0.0.0-20220131180029-7204632c39d4
 	gioui.org/x v0.0.0-20211230193557-0484e0de5e4d
 	github.com/andybalholm/stroke v0.0.0-20220303015302-9e53fa01d432
+	github.com/benoitkugler/pstokenizer v1.0.0
 	github.com/benoitkugler/textlayout v0.0.9
 	golang.org/x/image v0.0.0-20211028202545-6944b10bf410
 )
@@ -13,7 +14,6 @@ require (
 require (
 	gioui.org/cpu v0.0.0-20210817075930-8d6a761490d2 // indirect
 	gioui.org/shader v1.0.6 // indirect
-	github.com/benoitkugler/pstokenizer v1.0.0 // indirect
 	golang.org/x/exp/shiny v0.0.0-20220218215659-3a4dbed63ffe // indirect
 	golang.org/x/sys v0.0.0-20211019181941-9d821ace8654 // indirect
 	golang.org/x/text v0.3.7 // indirect
@@ -0,0 +1,260 @@
+// Actions and destinations.
+
+package pdf
+
+import (
+	"math"
+	"net/url"
+)
+
+// A Destination is a place in a document to go to, such as the target of a
+// link: a page, and how to display it.
+type Destination struct {
+	// Page is the page number, starting at 1, as for Reader.Page.
+	// It is 0 if the page can't be found. For a destination in another
+	// file (from a GoToR action), it is the page number in that file.
+	Page int
+
+	// View is how the page is displayed: "XYZ", "Fit", "FitH", "FitV",
+	// "FitR", "FitB", "FitBH" or "FitBV" (see PDF 32000-1:2008, section
+	// 12.3.2.2).
+	View string
+
+	// The parameters of the view, in default user space units (and for
+	// XYZ, Zoom as a factor). The ones that don't apply to View are zero.
+	// The ones that are null in the file, meaning that the current value
+	// should be kept, are NaN.
+	Left, Bottom, Right, Top, Zoom float64
+
+	// Name is the name of the destination, if it was given by name.
+	Name string
+}
+
+// An Action is something to do when a link is clicked, an outline item is
+// chosen, or another event happens (PDF 32000-1:2008, section 12.6).
+type Action struct {
+	// Type is the type of action, such as "URI", "GoTo", "GoToR",
+	// "Launch" or "Named". Other types of action have only their V field
+	// filled in.
+	Type string
+
+	// URI is the address for a URI action.
+	URI string
+
+	// Dest is the destination of a GoTo or GoToR action.
+	Dest Destination
+
+	// File is the file to open for a GoToR or Launch action.
+	File string
+
+	// NewWindow reports whether a GoToR or Launch action opens the file
+	// in a new window.
+	NewWindow bool
+
+	// Name is the name of a Named action, such as "NextPage", "PrevPage",
+	// "FirstPage" or "LastPage".
+	Name string
+
+	// Next is the list of actions to do after this one.
+	Next []Action
+
+	// V is the action dictionary.
+	V Value
+}
+
+// maxActionChain limits the length of a chain of actions, which guards
+// against cycles in the Next entries.
+const maxActionChain = 100
+
+// A destResolver resolves destinations, which may refer to pages by their
+// page objects, and to named destinations by name.
+type destResolver struct {
+	r     *Reader
+	pages map[objptr]int // page numbers, by page object
+}
+
+func newDestResolver(r *Reader) *destResolver {
+	return &destResolver{r: r}
+}
+
+// pageNumber returns the number of the page object v, or 0 if it isn't a
+// page of the document.
+func (d *destResolver) pageNumber(v Value) int {
+	if !v.indirect || d.r == nil {
+		return 0
+	}
+	if d.pages == nil {
+		d.pages = make(map[objptr]int)
+		for i, p := range d.r.Pages() {
+			if _, dup := d.pages[p.V.ptr]; !dup {
+				d.pages[p.V.ptr] = i + 1
+			}
+		}
+	}
+	return d.pages[v.ptr]
+}
+
+// namedDest looks up a named destination. Names are used as keys in the
+// catalog's Dests dictionary (since PDF 1.1), and strings as keys in the
+// Dests name tree (since PDF 1.2).
+func (d *destResolver) namedDest(key Value) Value {
+	if d.r == nil {
+		return Value{}
+	}
+	root := d.r.Trailer().Key("Root")
+	var dest Value
+	switch key.Kind() {
+	case Name:
+		dest = root.Key("Dests").Key(key.Name())
+	case String:
+		dest = NameTree{root.Key("Names").Key("Dests")}.Lookup(key.RawString())
+	}
+	// The destination may be in a dictionary, as the D entry.
+	if dest.Kind() == Dict {
+		dest = dest.Key("D")
+	}
+	return dest
+}
+
+// dest resolves the destination v, which is a destination array, or the
+// name of a destination.
+func (d *destResolver) dest(v Value) Destination {
+	var name string
+	switch v.Kind() {
+	case Name:
+		name = v.Name()
+		v = d.namedDest(v)
+	case String:
+		name = v.Text()
+		v = d.namedDest(v)
+	}
+	dest := Destination{Name: name}
+	if v.Kind() != Array || v.Len() < 2 {
+		return dest
+	}
+
+	page := v.Index(0)
+	if page.Kind() == Integer {
+		// A page in another file, numbered from 0.
+		dest.Page = page.Int() + 1
+	} else {
+		dest.Page = d.pageNumber(page)
+	}
+
+	dest.View = v.Index(1).Name()
+	param := func(i int) float64 {
+		p := v.Index(i)
+		if p.Kind() != Integer && p.Kind() != Real {
+			return math.NaN()
+		}
+		return p.Float64()
+	}
+	switch dest.View {
+	case "XYZ":
+		dest.Left, dest.Top, dest.Zoom = param(2), param(3), param(4)
+	case "FitH", "FitBH":
+		dest.Top = param(2)
+	case "FitV", "FitBV":
+		dest.Left = param(2)
+	case "FitR":
+		dest.Left, dest.Bottom, dest.Right, dest.Top = param(2), param(3), param(4), param(5)
+	}
+	return dest
+}
+
+// action converts the action dictionary v to an Action.
+func (d *destResolver) action(v Value) Action {
+	seen := make(map[objptr]bool)
+	if v.indirect {
+		seen[v.ptr] = true
+	}
+	return d.actionChain(v, seen)
+}
+
+func (d *destResolver) actionChain(v Value, seen map[objptr]bool) Action {
+	a := Action{Type: v.Key("S").Name(), V: v}
+	switch a.Type {
+	case "URI":
+		a.URI = v.Key("URI").RawString()
+		if d.r != nil {
+			if base := d.r.Trailer().Key("Root").Key("URI").Key("Base").RawString(); base != "" {
+				a.URI = resolveURI(base, a.URI)
+			}
+		}
+	case "GoTo":
+		a.Dest = d.dest(v.Key("D"))
+	case "GoToR":
+		a.File = fileSpecName(v.Key("F"))
+		// The destination is in the other file, so only its page
+		// number can be used, not a page object or a name in this
+		// file.
+		dest := v.Key("D")
+		switch dest.Kind() {
+		case Name:
+			a.Dest.Name = dest.Name()
+		case String:
+			a.Dest.Name = dest.Text()
+		default:
+			a.Dest = (&destResolver{}).dest(dest)
+		}
+		a.NewWindow = v.Key("NewWindow").Bool()
+	case "Launch":
+		f := v.Key("F")
+		if f.IsNull() {
+			f = v.Key("Win").Key("F")
+		}
+		a.File = fileSpecName(f)
+		a.NewWindow = v.Key("NewWindow").Bool()
+	case "Named":
+		a.Name = v.Key("N").Name()
+	}
+
+	var next []Value
+	switch n := v.Key("Next"); n.Kind() {
+	case Dict:
+		next = append(next, n)
+	case Array:
+		for i := 0; i < n.Len(); i++ {
+			next = append(next, n.Index(i))
+		}
+	}
+	for _, n := range next {
+		if n.indirect {
+			if seen[n.ptr] || len(seen) >= maxActionChain {
+				continue
+			}
+			seen[n.ptr] = true
+		}
+		a.Next = append(a.Next, d.actionChain(n, seen))
+	}
+	return a
+}
+
+// resolveURI resolves uri relative to base, as specified by the URI
+// dictionary in the document catalog. Absolute URIs are returned unchanged.
+func resolveURI(base, uri string) string {
+	b, err := url.Parse(base)
+	if err != nil {
+		return uri
+	}
+	u, err := url.Parse(uri)
+	if err != nil || u.IsAbs() {
+		return uri
+	}
+	return b.ResolveReference(u).String()
+}
+
+// fileSpecName returns the file name from a file specification, which is
+// either a string, or a dictionary with the name in its UF or F entry.
+func fileSpecName(v Value) string {
+	switch v.Kind() {
+	case String:
+		return v.Text()
+	case Dict:
+		if uf := v.Key("UF"); uf.Kind() == String {
+			return uf.Text()
+		}
+		return v.Key("F").Text()
+	}
+	return ""
+}
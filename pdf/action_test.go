@@ -0,0 +1,162 @@
+package pdf
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDestinations(t *testing.T) {
+	r, _ := newTestReader(t, nil, func(w *Writer) Value {
+		root, pages := addPages(w, nil, nil, nil)
+		return w.Add(NewDict(map[string]Value{
+			"Type":  NewName("Catalog"),
+			"Pages": root,
+			"Dests": NewDict(map[string]Value{
+				"chap1": NewArray(pages[1], NewName("Fit")),
+			}),
+			"Names": NewDict(map[string]Value{
+				"Dests": NewDict(map[string]Value{
+					"Names": NewArray(
+						NewString("sec2"), NewDict(map[string]Value{
+							"D": NewArray(pages[2], NewName("FitH"), NewInt(500)),
+						}),
+					),
+				}),
+			}),
+			"Test": NewArray(
+				NewArray(pages[0], NewName("XYZ"), Value{}, NewInt(700), Value{}),
+				NewArray(pages[2], NewName("XYZ"), NewInt(72), NewReal(700.5), NewReal(1.5)),
+				NewArray(pages[1], NewName("FitR"), NewInt(1), NewInt(2), NewInt(3), NewInt(4)),
+				NewArray(pages[0], NewName("FitBV"), NewInt(36)),
+				NewName("chap1"),
+				NewString("sec2"),
+				NewString("missing"),
+				NewArray(NewInt(4), NewName("Fit")),
+				NewArray(NewName("Fit")),
+			),
+		}))
+	})
+
+	nan := math.NaN()
+	want := []Destination{
+		{Page: 1, View: "XYZ", Left: nan, Top: 700, Zoom: nan},
+		{Page: 3, View: "XYZ", Left: 72, Top: 700.5, Zoom: 1.5},
+		{Page: 2, View: "FitR", Left: 1, Bottom: 2, Right: 3, Top: 4},
+		{Page: 1, View: "FitBV", Left: 36},
+		{Page: 2, View: "Fit", Name: "chap1"},
+		{Page: 3, View: "FitH", Top: 500, Name: "sec2"},
+		{Name: "missing"},
+		// A page number is for a page in another file, counting from 0.
+		{Page: 5, View: "Fit"},
+		{},
+	}
+	same := func(a, b float64) bool {
+		return a == b || math.IsNaN(a) && math.IsNaN(b)
+	}
+	d := newDestResolver(r)
+	tests := r.Trailer().Key("Root").Key("Test")
+	for i, w := range want {
+		got := d.dest(tests.Index(i))
+		if got.Page != w.Page || got.View != w.View || got.Name != w.Name ||
+			!same(got.Left, w.Left) || !same(got.Bottom, w.Bottom) || !same(got.Right, w.Right) ||
+			!same(got.Top, w.Top) || !same(got.Zoom, w.Zoom) {
+			t.Errorf("%d: got %+v, want %+v", i, got, w)
+		}
+	}
+}
+
+func TestActions(t *testing.T) {
+	r, _ := newTestReader(t, nil, func(w *Writer) Value {
+		root, pages := addPages(w, nil, nil)
+
+		// Two actions that are each other's Next, and one that is its
+		// own.
+		a, b, self := w.Alloc(), w.Alloc(), w.Alloc()
+		w.Set(a, NewDict(map[string]Value{
+			"S":    NewName("Named"),
+			"N":    NewName("NextPage"),
+			"Next": b,
+		}))
+		w.Set(b, NewDict(map[string]Value{
+			"S":    NewName("URI"),
+			"URI":  NewString("help/index.html"),
+			"Next": NewArray(a),
+		}))
+		w.Set(self, NewDict(map[string]Value{
+			"S":    NewName("Named"),
+			"N":    NewName("FirstPage"),
+			"Next": NewArray(self, self),
+		}))
+
+		return w.Add(NewDict(map[string]Value{
+			"Type":  NewName("Catalog"),
+			"Pages": root,
+			"URI":   NewDict(map[string]Value{"Base": NewString("https://example.com/docs/")}),
+			"Test": NewArray(
+				a,
+				self,
+				NewDict(map[string]Value{"S": NewName("GoTo"), "D": NewArray(pages[1], NewName("Fit"))}),
+				NewDict(map[string]Value{
+					"S":         NewName("GoToR"),
+					"F":         NewDict(map[string]Value{"Type": NewName("Filespec"), "F": NewString("other.pdf")}),
+					"D":         NewArray(NewInt(0), NewName("FitH"), NewInt(100)),
+					"NewWindow": NewBool(true),
+				}),
+				NewDict(map[string]Value{"S": NewName("GoToR"), "F": NewString("other.pdf"), "D": NewString("intro")}),
+				NewDict(map[string]Value{"S": NewName("Launch"), "Win": NewDict(map[string]Value{"F": NewString("app.exe")})}),
+				NewDict(map[string]Value{"S": NewName("URI"), "URI": NewString("mailto:someone@example.com")}),
+				NewDict(map[string]Value{"S": NewName("JavaScript"), "JS": NewString("app.alert(1)")}),
+			),
+		}))
+	})
+
+	d := newDestResolver(r)
+	tests := r.Trailer().Key("Root").Key("Test")
+	action := func(i int) Action { return d.action(tests.Index(i)) }
+
+	a := action(0)
+	if a.Type != "Named" || a.Name != "NextPage" || len(a.Next) != 1 {
+		t.Fatalf("got %+v", a)
+	}
+	if b := a.Next[0]; b.Type != "URI" || b.URI != "https://example.com/docs/help/index.html" || len(b.Next) != 0 {
+		t.Errorf("got Next %+v", b)
+	}
+	if a := action(1); a.Name != "FirstPage" || len(a.Next) != 0 {
+		t.Errorf("action with itself as Next: got %+v", a)
+	}
+	if a := action(2); a.Type != "GoTo" || a.Dest.Page != 2 || a.Dest.View != "Fit" {
+		t.Errorf("GoTo: got %+v", a)
+	}
+	if a := action(3); a.File != "other.pdf" || !a.NewWindow || a.Dest.Page != 1 || a.Dest.View != "FitH" || a.Dest.Top != 100 {
+		t.Errorf("GoToR: got %+v", a)
+	}
+	if a := action(4); a.File != "other.pdf" || a.NewWindow || a.Dest.Name != "intro" || a.Dest.Page != 0 {
+		t.Errorf("GoToR with a named destination: got %+v", a)
+	}
+	if a := action(5); a.Type != "Launch" || a.File != "app.exe" {
+		t.Errorf("Launch: got %+v", a)
+	}
+	if a := action(6); a.URI != "mailto:someone@example.com" {
+		t.Errorf("absolute URI: got %q", a.URI)
+	}
+	if a := action(7); a.Type != "JavaScript" || a.V.Key("JS").RawString() != "app.alert(1)" {
+		t.Errorf("JavaScript: got %+v", a)
+	}
+}
+
+func TestResolveURI(t *testing.T) {
+	for _, c := range []struct {
+		base, uri, want string
+	}{
+		{"https://example.com/docs/", "a/b.html", "https://example.com/docs/a/b.html"},
+		{"https://example.com/docs/index.html", "../x.html", "https://example.com/x.html"},
+		{"https://example.com/docs/", "/top.html", "https://example.com/top.html"},
+		{"https://example.com/docs/", "http://other.org/", "http://other.org/"},
+		{"https://example.com/docs/", "#frag", "https://example.com/docs/#frag"},
+		{"%zz", "a.html", "a.html"},
+	} {
+		if got := resolveURI(c.base, c.uri); got != c.want {
+			t.Errorf("resolveURI(%q, %q) = %q, want %q", c.base, c.uri, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+// Annotations.
+
+package pdf
+
+import (
+	"time"
+)
+
+// AnnotationFlags are the flags in an annotation's F entry, which control
+// how it is displayed and printed (PDF 32000-1:2008, section 12.5.3).
+type AnnotationFlags uint32
+
+const (
+	AnnotInvisible AnnotationFlags = 1 << iota
+	AnnotHidden
+	AnnotPrint
+	AnnotNoZoom
+	AnnotNoRotate
+	AnnotNoView
+	AnnotReadOnly
+	AnnotLocked
+	AnnotToggleNoView
+	AnnotLockedContents
+)
+
+// An Annotation is an object associated with a location on a page, such as
+// a link, a comment, a highlight, or a form field.
+type Annotation struct {
+	Subtype  string // such as "Link", "Text", "Highlight" or "Widget"
+	Rect     Rect   // the location on the page, in default user space
+	Contents string // the text, or a description of the annotation
+	Name     string // the annotation name (NM), unique on the page
+	Author   string // the author of a comment (the T entry)
+	Subject  string
+	Flags    AnnotationFlags
+
+	Modified time.Time // zero if it isn't known
+	Created  time.Time // zero if it isn't known
+
+	// Popup is the index (in the slice returned by Page.Annotations)
+	// of the Popup annotation that shows this annotation's text, or -1.
+	// Parent is the reverse: for a Popup annotation, the index of the
+	// annotation it belongs to, or -1. InReplyTo is the index of the
+	// annotation that this one replies to, or -1.
+	Popup, Parent, InReplyTo int
+
+	// Action is what happens when the annotation is activated, such as
+	// when a link is clicked. It is nil if the annotation has no action.
+	Action *Action
+
+	// V is the annotation dictionary.
+	V Value
+}
+
+// Annotations returns the annotations of the page, in the order in which
+// they are drawn.
+func (p Page) Annotations() []Annotation {
+	annots := p.V.Key("Annots")
+	d := newDestResolver(p.V.r)
+
+	// The index of each annotation, so that the references between
+	// them can be converted to indexes.
+	index := make(map[objptr]int)
+	for i := 0; i < annots.Len(); i++ {
+		if a := annots.Index(i); a.indirect {
+			if _, dup := index[a.ptr]; !dup {
+				index[a.ptr] = i
+			}
+		}
+	}
+	ref := func(v Value) int {
+		if !v.indirect {
+			return -1
+		}
+		if i, ok := index[v.ptr]; ok {
+			return i
+		}
+		return -1
+	}
+
+	list := make([]Annotation, 0, annots.Len())
+	for i := 0; i < annots.Len(); i++ {
+		v := annots.Index(i)
+		a := Annotation{
+			Subtype:   v.Key("Subtype").Name(),
+			Contents:  v.Key("Contents").Text(),
+			Name:      v.Key("NM").Text(),
+			Author:    v.Key("T").Text(),
+			Subject:   v.Key("Subj").Text(),
+			Flags:     AnnotationFlags(v.Key("F").Int64()),
+			Popup:     ref(v.Key("Popup")),
+			Parent:    ref(v.Key("Parent")),
+			InReplyTo: ref(v.Key("IRT")),
+			V:         v,
+		}
+		a.Rect, _ = rectValue(v.Key("Rect"))
+		a.Modified, _ = parseDate(v.Key("M").Text())
+		a.Created, _ = parseDate(v.Key("CreationDate").Text())
+
+		if action := v.Key("A"); action.Kind() == Dict {
+			act := d.action(action)
+			a.Action = &act
+		} else if dest := v.Key("Dest"); !dest.IsNull() {
+			// A link's destination, without an action dictionary, is
+			// the same as a GoTo action.
+			a.Action = &Action{Type: "GoTo", Dest: d.dest(dest)}
+		}
+		list = append(list, a)
+	}
+	return list
+}
@@ -0,0 +1,185 @@
+// Assembling new documents from the pages of existing ones.
+
+package pdf
+
+import (
+	"io"
+)
+
+// maxPageTreeDepth limits how deep the page tree is followed, which guards
+// against cycles in malformed files.
+const maxPageTreeDepth = 64
+
+// Pages returns the pages of the document, in order. It walks the page tree
+// once, so it is faster than calling Page for each page number.
+func (r *Reader) Pages() []Page {
+	var pages []Page
+	seen := make(map[objptr]bool)
+	var walk func(node Value, depth int)
+	walk = func(node Value, depth int) {
+		if node.indirect {
+			if seen[node.ptr] {
+				return
+			}
+			seen[node.ptr] = true
+		}
+		switch node.Key("Type").Name() {
+		case "Pages":
+			if depth >= maxPageTreeDepth {
+				return
+			}
+			kids := node.Key("Kids")
+			for i := 0; i < kids.Len(); i++ {
+				walk(kids.Index(i), depth+1)
+			}
+		case "Page":
+			pages = append(pages, Page{node})
+		}
+	}
+	walk(r.Trailer().Key("Root").Key("Pages"), 0)
+	return pages
+}
+
+// Rotate returns the number of degrees by which the page is rotated
+// clockwise when it is displayed: 0, 90, 180 or 270.
+func (p Page) Rotate() int {
+	return normalizeRotation(p.findInherited("Rotate").Int())
+}
+
+func normalizeRotation(degrees int) int {
+	degrees %= 360
+	if degrees < 0 {
+		degrees += 360
+	}
+	// Rotate must be a multiple of 90.
+	return (degrees + 45) / 90 * 90 % 360
+}
+
+// Rotated returns a copy of p that is rotated clockwise by the given number
+// of degrees (a multiple of 90), in addition to its existing rotation. The
+// copy can be added to a Document; p's file is not changed.
+func (p Page) Rotated(degrees int) Page {
+	v := p.V.With("Rotate", NewInt(int64(normalizeRotation(p.Rotate()+degrees))))
+	// The copy stands in for the original page, so a Document will
+	// redirect references to the original page (such as from its
+	// annotations) to the copy.
+	return Page{Value{r: p.V.r, ptr: p.V.ptr, data: v.data}}
+}
+
+// A Document is a list of pages, which may come from several Readers, to be
+// written as a new PDF file. It is the basis for splitting, merging,
+// reordering and deleting pages: for example, to merge two files, append the
+// Pages of their Readers, and to delete a page, remove it from Pages.
+//
+// The new file contains the pages and everything they use, such as fonts,
+// images and annotations. An object that is shared by several pages of the
+// same file is written only once. Each page gets its own copy of the
+// attributes it inherits from the page tree (Resources, MediaBox, CropBox
+// and Rotate). The rest of the original files (such as outlines and forms)
+// is not copied, and references from the pages to pages that are not in the
+// Document (such as links) become null.
+type Document struct {
+	Pages []Page
+
+	// Info is the document information dictionary, or null for none.
+	// To keep the information of a file, set it to the Info entry of the
+	// Reader's Trailer.
+	Info Value
+}
+
+// inheritedPageKeys are the page attributes that can be inherited from the
+// page tree.
+var inheritedPageKeys = []string{"Resources", "MediaBox", "CropBox", "Rotate"}
+
+// Write writes the document to w as a new PDF file. If opts is nil, the
+// defaults are used.
+func (d *Document) Write(w io.Writer, opts *WriterOptions) error {
+	wr := NewWriter(w, opts)
+	wr.omit = make(map[copyKey]bool)
+
+	// Pages that aren't in the document are written as null if
+	// anything refers to them; otherwise a link to another page would
+	// pull in the whole page tree of its file. The same goes for the
+	// nodes of the page trees.
+	readers := make(map[*Reader]bool)
+	for _, p := range d.Pages {
+		if r := p.V.r; r != nil && !readers[r] {
+			readers[r] = true
+			omitPageTree(wr, r)
+		}
+	}
+
+	parent := wr.Alloc()
+	refs := make([]Value, len(d.Pages))
+	for i, p := range d.Pages {
+		refs[i] = wr.Alloc()
+		if p.V.r == nil {
+			continue
+		}
+		// Links to the original page go to the (first) copy.
+		key := copyKey{p.V.r, p.V.ptr}
+		if wr.omit[key] {
+			delete(wr.omit, key)
+			wr.copies[key] = refs[i].data.(wref).ptr
+		}
+	}
+
+	for i, p := range d.Pages {
+		entries := make(map[string]Value)
+		for _, k := range p.V.Keys() {
+			entries[k] = p.V.Key(k)
+		}
+		for _, k := range inheritedPageKeys {
+			if _, ok := entries[k]; !ok {
+				entries[k] = p.findInherited(k)
+			}
+		}
+		if entries["MediaBox"].IsNull() {
+			// MediaBox is required; assume US Letter.
+			entries["MediaBox"] = NewArray(NewInt(0), NewInt(0), NewInt(612), NewInt(792))
+		}
+		if entries["Resources"].IsNull() {
+			entries["Resources"] = NewDict(nil)
+		}
+		entries["Type"] = NewName("Page")
+		entries["Parent"] = parent
+		if err := wr.Set(refs[i], NewDict(entries)); err != nil {
+			return err
+		}
+	}
+
+	wr.Set(parent, NewDict(map[string]Value{
+		"Type":  NewName("Pages"),
+		"Kids":  NewArray(refs...),
+		"Count": NewInt(int64(len(refs))),
+	}))
+	root := wr.Add(NewDict(map[string]Value{
+		"Type":  NewName("Catalog"),
+		"Pages": parent,
+	}))
+	return wr.Finish(NewDict(map[string]Value{
+		"Root": root,
+		"Info": d.Info,
+	}))
+}
+
+// omitPageTree marks the nodes of r's page tree to be omitted from the file
+// written by w.
+func omitPageTree(w *Writer, r *Reader) {
+	var walk func(node Value, depth int)
+	walk = func(node Value, depth int) {
+		if !node.indirect || depth > maxPageTreeDepth {
+			return
+		}
+		key := copyKey{r, node.ptr}
+		if w.omit[key] {
+			return
+		}
+		w.omit[key] = true
+		kids := node.Key("Kids")
+		for i := 0; i < kids.Len(); i++ {
+			walk(kids.Index(i), depth+1)
+		}
+	}
+	walk(r.Trailer().Key("Root").Key("Pages"), 0)
+}
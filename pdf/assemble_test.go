@@ -0,0 +1,146 @@
+package pdf
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+)
+
+// newAssembleSource returns a Reader for a document with a page for each of
+// the names, whose content stream is the page's name.
+func newAssembleSource(t *testing.T, rotate int64, names ...string) *Reader {
+	t.Helper()
+	r, _ := newTestReader(t, nil, func(w *Writer) Value {
+		root := w.Alloc()
+		var kids []Value
+		for _, name := range names {
+			kids = append(kids, w.Add(NewDict(map[string]Value{
+				"Type":     NewName("Page"),
+				"Parent":   root,
+				"MediaBox": NewArray(NewInt(0), NewInt(0), NewInt(612), NewInt(792)),
+				"Contents": w.Add(NewStream(NewDict(nil), []byte(name))),
+			})))
+		}
+		tree := map[string]Value{
+			"Type":  NewName("Pages"),
+			"Kids":  NewArray(kids...),
+			"Count": NewInt(int64(len(kids))),
+		}
+		if rotate != 0 {
+			// Rotate is inherited from the page tree.
+			tree["Rotate"] = NewInt(rotate)
+		}
+		w.Set(root, NewDict(tree))
+		return w.Add(NewDict(map[string]Value{"Type": NewName("Catalog"), "Pages": root}))
+	})
+	return r
+}
+
+// pageName returns the contents of p's content stream.
+func pageName(t *testing.T, p Page) string {
+	t.Helper()
+	rd := p.V.Key("Contents").Reader()
+	defer rd.Close()
+	data, err := io.ReadAll(rd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestDocumentWrite(t *testing.T) {
+	a := newAssembleSource(t, 0, "a1", "a2", "a3")
+	b := newAssembleSource(t, 90, "b1", "b2")
+	ap, bp := a.Pages(), b.Pages()
+
+	// Merge the files, delete a2, reorder the pages, and rotate some of
+	// them.
+	doc := &Document{Pages: []Page{bp[1], ap[2], ap[0].Rotated(90), bp[0].Rotated(-270)}}
+	var buf bytes.Buffer
+	if err := doc.Write(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := r.NumPage(); n != 4 {
+		t.Fatalf("got %d pages, want 4", n)
+	}
+	var names []string
+	var rotations []int
+	for _, p := range r.Pages() {
+		names = append(names, pageName(t, p))
+		rotations = append(rotations, p.Rotate())
+		// Each page has its own Rotate, rather than inheriting it.
+		if rot := p.V.Key("Rotate"); rot.Int() != p.Rotate() {
+			t.Errorf("page %s: got /Rotate %v, want %d", names[len(names)-1], rot, p.Rotate())
+		}
+	}
+	if want := []string{"b2", "a3", "a1", "b1"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got pages %q, want %q", names, want)
+	}
+	if want := []int{90, 0, 90, 180}; !reflect.DeepEqual(rotations, want) {
+		t.Errorf("got rotations %v, want %v", rotations, want)
+	}
+
+	// The source files are unchanged.
+	if rot := a.Page(1).Rotate(); rot != 0 {
+		t.Errorf("source page a1 has rotation %d after writing", rot)
+	}
+}
+
+func TestDocumentWriteLinks(t *testing.T) {
+	// Page 3 links to pages 1 and 2.
+	src, _ := newTestReader(t, nil, func(w *Writer) Value {
+		toFirst, toSecond := w.Alloc(), w.Alloc()
+		root, refs := addPages(w,
+			map[string]Value{"Contents": w.Add(NewStream(NewDict(nil), []byte("p1")))},
+			map[string]Value{"Contents": w.Add(NewStream(NewDict(nil), []byte("p2")))},
+			map[string]Value{
+				"Contents": w.Add(NewStream(NewDict(nil), []byte("p3"))),
+				"Annots":   NewArray(toFirst, toSecond),
+			},
+		)
+		for i, ref := range []Value{toFirst, toSecond} {
+			w.Set(ref, NewDict(map[string]Value{
+				"Type":    NewName("Annot"),
+				"Subtype": NewName("Link"),
+				"Rect":    NewArray(NewInt(0), NewInt(0), NewInt(10), NewInt(10)),
+				"Dest":    NewArray(refs[i], NewName("Fit")),
+			}))
+		}
+		return w.Add(NewDict(map[string]Value{"Type": NewName("Catalog"), "Pages": root}))
+	})
+	pages := src.Pages()
+
+	// Drop page 2, and put a rotated copy of page 1 last.
+	doc := &Document{Pages: []Page{pages[2], pages[0].Rotated(180)}}
+	var buf bytes.Buffer
+	if err := doc.Write(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := r.Pages()
+	if len(out) != 2 || pageName(t, out[0]) != "p3" || pageName(t, out[1]) != "p1" || out[1].Rotate() != 180 {
+		t.Fatalf("got wrong pages")
+	}
+	annots := out[0].V.Key("Annots")
+	if annots.Len() != 2 {
+		t.Fatalf("got %d annotations, want 2", annots.Len())
+	}
+	// The link to page 1 goes to the rotated copy.
+	if dest := annots.Index(0).Key("Dest").Index(0); !dest.indirect || dest.ptr != out[1].V.ptr {
+		t.Errorf("link to page 1 goes to %v, want %v", dest, out[1].V)
+	}
+	// The link to the deleted page goes nowhere.
+	if dest := annots.Index(1).Key("Dest").Index(0); !dest.IsNull() {
+		t.Errorf("link to deleted page goes to %v, want null", dest)
+	}
+}
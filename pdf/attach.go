@@ -0,0 +1,130 @@
+// Embedded files.
+
+package pdf
+
+import (
+	"io"
+	"time"
+)
+
+// An EmbeddedFile is a file attached to a document, from a file
+// specification with an embedded file stream (PDF 32000-1:2008, sections
+// 7.11.3 and 7.11.4).
+type EmbeddedFile struct {
+	// Name is the file name, from the UF or F entry of the file
+	// specification.
+	Name string
+
+	// Description is the text in the file specification's Desc entry.
+	Description string
+
+	// Subtype is the MIME type of the file, such as "text/xml", or empty
+	// if it isn't given.
+	Subtype string
+
+	// Size is the size of the file in bytes, or -1 if it isn't given.
+	Size int64
+
+	// CheckSum is the MD5 digest of the file, or nil if it isn't given.
+	CheckSum []byte
+
+	Created  time.Time // zero if it isn't known
+	Modified time.Time // zero if it isn't known
+
+	// Relationship is the AFRelationship entry of the file specification,
+	// which tells how the file relates to the document: "Source", "Data",
+	// "Alternative", "Supplement", "EncryptedPayload", "FormData", "Schema"
+	// or "Unspecified". It is empty if it isn't given.
+	Relationship string
+
+	// Key is the file's key in the EmbeddedFiles name tree, or empty if
+	// the file is attached to an annotation. Like other name tree keys, it
+	// is a byte string, not converted with Text, so it can be passed to
+	// NameTree.Lookup.
+	Key string
+
+	// Page is the number of the page (numbered from 1, as for Page) with
+	// the FileAttachment annotation that holds the file, or 0 if the file
+	// is in the EmbeddedFiles name tree.
+	Page int
+
+	// V is the file specification dictionary.
+	V Value
+}
+
+// Stream returns the embedded file stream.
+func (f EmbeddedFile) Stream() Value {
+	ef := f.V.Key("EF")
+	if s := ef.Key("UF"); s.Kind() == Stream {
+		return s
+	}
+	return ef.Key("F")
+}
+
+// Open returns the contents of the file, decoded by the stream's filters.
+func (f EmbeddedFile) Open() io.ReadCloser {
+	return f.Stream().Reader()
+}
+
+// EmbeddedFiles returns the files attached to the document: first the ones
+// in the EmbeddedFiles name tree of the document catalog, in order, and then
+// the ones attached to FileAttachment annotations, in page order. A file
+// specification that is in more than one place is listed once. File
+// specifications that refer to external files, rather than embedding them,
+// are left out.
+func (r *Reader) EmbeddedFiles() []EmbeddedFile {
+	var files []EmbeddedFile
+	seen := make(map[objptr]bool)
+	add := func(fs Value, key string, page int) {
+		if fs.Kind() != Dict || fs.Key("EF").Kind() != Dict {
+			return
+		}
+		if fs.indirect {
+			if seen[fs.ptr] {
+				return
+			}
+			seen[fs.ptr] = true
+		}
+		files = append(files, newEmbeddedFile(fs, key, page))
+	}
+
+	tree := r.Trailer().Key("Root").Key("Names").Key("EmbeddedFiles")
+	NameTree{tree}.Walk(func(key string, v Value) bool {
+		add(v, key, 0)
+		return true
+	})
+
+	for i, p := range r.Pages() {
+		annots := p.V.Key("Annots")
+		for j := 0; j < annots.Len(); j++ {
+			if a := annots.Index(j); a.Key("Subtype").Name() == "FileAttachment" {
+				add(a.Key("FS"), "", i+1)
+			}
+		}
+	}
+	return files
+}
+
+func newEmbeddedFile(fs Value, key string, page int) EmbeddedFile {
+	f := EmbeddedFile{
+		Name:         fileSpecName(fs),
+		Description:  fs.Key("Desc").Text(),
+		Relationship: fs.Key("AFRelationship").Name(),
+		Key:          key,
+		Page:         page,
+		Size:         -1,
+		V:            fs,
+	}
+	strm := f.Stream()
+	f.Subtype = strm.Key("Subtype").Name()
+	params := strm.Key("Params")
+	if size := params.Key("Size"); size.Kind() == Integer {
+		f.Size = size.Int64()
+	}
+	if sum := params.Key("CheckSum"); sum.Kind() == String {
+		f.CheckSum = []byte(sum.RawString())
+	}
+	f.Created, _ = parseDate(params.Key("CreationDate").Text())
+	f.Modified, _ = parseDate(params.Key("ModDate").Text())
+	return f
+}
@@ -0,0 +1,93 @@
+package pdf
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestEmbeddedFiles(t *testing.T) {
+	content := []byte("name,value\na,1\n")
+	r, _ := newTestReader(t, &WriterOptions{Compress: true}, func(w *Writer) Value {
+		data := w.Add(NewStream(NewDict(map[string]Value{
+			"Type":    NewName("EmbeddedFile"),
+			"Subtype": NewName("text/csv"),
+			"Params": NewDict(map[string]Value{
+				"Size":     NewInt(int64(len(content))),
+				"CheckSum": NewString("0123456789abcdef"),
+				"ModDate":  NewString("D:20240102030405Z"),
+			}),
+		}), content))
+		csv := w.Add(NewDict(map[string]Value{
+			"Type":           NewName("Filespec"),
+			"F":              NewString("data.csv"),
+			"UF":             NewTextString("データ.csv"),
+			"Desc":           NewTextString("The data"),
+			"AFRelationship": NewName("Data"),
+			"EF":             NewDict(map[string]Value{"F": data, "UF": data}),
+		}))
+		note := w.Add(NewDict(map[string]Value{
+			"Type": NewName("Filespec"),
+			"F":    NewString("note.txt"),
+			"EF":   NewDict(map[string]Value{"F": w.Add(NewStream(NewDict(nil), []byte("note")))}),
+		}))
+		// A reference to an external file isn't listed.
+		external := NewDict(map[string]Value{"Type": NewName("Filespec"), "F": NewString("other.pdf")})
+
+		attachment := func(fs Value) Value {
+			return w.Add(NewDict(map[string]Value{
+				"Type":    NewName("Annot"),
+				"Subtype": NewName("FileAttachment"),
+				"Rect":    NewArray(NewInt(0), NewInt(0), NewInt(20), NewInt(20)),
+				"FS":      fs,
+			}))
+		}
+		return newCatalog(w, map[string]Value{
+			"Names": NewDict(map[string]Value{
+				"EmbeddedFiles": NewDict(map[string]Value{
+					"Names": NewArray(NewString("external"), external, NewTextString("データ"), csv),
+				}),
+			}),
+		}, nil, map[string]Value{
+			// The first attachment is the same as the one in the name
+			// tree.
+			"Annots": NewArray(attachment(csv), attachment(note)),
+		})
+	})
+
+	files := r.EmbeddedFiles()
+	if len(files) != 2 {
+		t.Fatalf("got %d files, want 2", len(files))
+	}
+
+	f := files[0]
+	if f.Name != "データ.csv" || f.Description != "The data" || f.Subtype != "text/csv" || f.Relationship != "Data" || f.Page != 0 {
+		t.Errorf("got %+v", f)
+	}
+	if f.Size != int64(len(content)) || string(f.CheckSum) != "0123456789abcdef" {
+		t.Errorf("got size %d, checksum %q", f.Size, f.CheckSum)
+	}
+	if want := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC); !f.Modified.Equal(want) || !f.Created.IsZero() {
+		t.Errorf("got created %v, modified %v", f.Created, f.Modified)
+	}
+	// The key is the raw UTF-16 string from the name tree.
+	if f.Key != NewTextString("データ").RawString() {
+		t.Errorf("got key %q", f.Key)
+	}
+	tree := NameTree{r.Trailer().Key("Root").Key("Names").Key("EmbeddedFiles")}
+	if fs := tree.Lookup(f.Key); fs.Key("Desc").Text() != "The data" {
+		t.Errorf("looking up the key %q gave %v", f.Key, fs)
+	}
+	rd := f.Open()
+	got, err := io.ReadAll(rd)
+	rd.Close()
+	if err != nil || !bytes.Equal(got, content) {
+		t.Errorf("got contents %q, %v", got, err)
+	}
+
+	f = files[1]
+	if f.Name != "note.txt" || f.Key != "" || f.Page != 2 || f.Size != -1 {
+		t.Errorf("got %+v", f)
+	}
+}
@@ -0,0 +1,184 @@
+// Construction of new Values, for writing.
+
+package pdf
+
+import (
+	"math"
+	"sort"
+)
+
+// The functions in this file build Values in memory, to be written by a
+// Writer. A built Value has no Reader, but it may contain Values from a
+// Reader; when it is written, the objects they refer to are copied too.
+//
+// Values are never modified in place: With and Without return new
+// dictionaries, leaving the original (which may be shared by a Reader's
+// cache) unchanged.
+
+// NewBool returns a boolean Value.
+func NewBool(b bool) Value {
+	return Value{data: b}
+}
+
+// NewInt returns an integer Value.
+func NewInt(i int64) Value {
+	return Value{data: i}
+}
+
+// NewReal returns a real Value. PDF has no representation for infinities
+// and NaNs, so they are replaced by zero.
+func NewReal(f float64) Value {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		f = 0
+	}
+	return Value{data: f}
+}
+
+// NewName returns a name Value. The name should not include a leading slash.
+func NewName(s string) Value {
+	return Value{data: name(s)}
+}
+
+// NewString returns a string Value holding the bytes of s, without any
+// conversion. For human-readable text, use NewTextString.
+func NewString(s string) Value {
+	return Value{data: s}
+}
+
+// NewTextString returns a string Value holding the text s, encoded as a PDF
+// text string: in PDFDocEncoding if possible, and otherwise in UTF-16BE.
+// The Text method recovers s.
+func NewTextString(s string) Value {
+	if enc, ok := pdfDocEncode(s); ok {
+		return Value{data: enc}
+	}
+	return Value{data: utf16Encode(s)}
+}
+
+// NewArray returns an array Value with the given elements.
+func NewArray(elems ...Value) Value {
+	a := make(array, len(elems))
+	for i, e := range elems {
+		a[i] = e.object()
+	}
+	return Value{data: a}
+}
+
+// NewDict returns a dictionary Value with the given entries. Keys should not
+// include a leading slash. Null entries are omitted, since a null value in a
+// dictionary is the same as a missing key.
+func NewDict(entries map[string]Value) Value {
+	d := make(dict, len(entries))
+	for k, v := range entries {
+		if v.IsNull() {
+			continue
+		}
+		d[name(k)] = v.object()
+	}
+	return Value{data: d}
+}
+
+// NewStream returns a stream Value with the header dictionary hdr and the
+// given data. The data must already be encoded with the filters listed in
+// hdr's Filter entry (if any). The Length entry is filled in when the stream
+// is written.
+func NewStream(hdr Value, data []byte) Value {
+	d := make(dict)
+	if x, ok := hdr.dict(); ok {
+		for k, v := range x {
+			d[k] = hdr.wrap(v)
+		}
+	}
+	delete(d, "Length")
+	if data == nil {
+		data = []byte{}
+	}
+	return Value{data: stream{hdr: d, raw: data}}
+}
+
+// With returns a copy of the dictionary (or stream) v with the entry key set
+// to val, or removed if val is null. If v is not a dictionary or stream, With
+// returns a new dictionary with just that entry.
+func (v Value) With(key string, val Value) Value {
+	d := make(dict)
+	x, _ := v.dict()
+	for k, e := range x {
+		d[k] = v.wrap(e)
+	}
+	if val.IsNull() {
+		delete(d, name(key))
+	} else {
+		d[name(key)] = val.object()
+	}
+	if strm, ok := v.data.(stream); ok {
+		return v.rebuild(stream{hdr: d, ptr: strm.ptr, offset: strm.offset, raw: strm.raw})
+	}
+	return Value{data: d}
+}
+
+// Without returns a copy of the dictionary (or stream) v without the entry key.
+func (v Value) Without(key string) Value {
+	return v.With(key, Value{})
+}
+
+// dict returns the dictionary of v, or the header dictionary if v is a stream.
+func (v Value) dict() (dict, bool) {
+	switch x := v.data.(type) {
+	case dict:
+		return x, true
+	case stream:
+		return x.hdr, true
+	}
+	return nil, false
+}
+
+// rebuild returns a built Value holding the stream strm, which is a modified
+// copy of v. A stream in the file is still read through v's Reader.
+func (v Value) rebuild(strm stream) Value {
+	if v.r == nil || strm.raw != nil {
+		return Value{data: strm}
+	}
+	// The copy keeps v's Reader, so that the data can be read, and so
+	// that the references in the header are interpreted in the right
+	// file. It is not the indirect object v, though.
+	return Value{r: v.r, ptr: v.ptr, data: strm}
+}
+
+// wrap converts the element x of v to an object that can be stored in a
+// built Value. References and other objects from v's Reader are wrapped in
+// Values, so that they are still interpreted relative to that Reader.
+func (v Value) wrap(x object) object {
+	if v.r == nil {
+		return x
+	}
+	switch x.(type) {
+	case nil, bool, int64, float64, string, name:
+		return x
+	}
+	return Value{r: v.r, ptr: v.ptr, data: x}
+}
+
+// object returns the object to store for v in a built Value.
+func (v Value) object() object {
+	if v.r == nil {
+		return v.data
+	}
+	switch v.data.(type) {
+	case nil, bool, int64, float64, string, name:
+		if !v.indirect {
+			return v.data
+		}
+	}
+	v.err = nil
+	return v
+}
+
+// sortedKeys returns the keys of d in order.
+func sortedKeys(d dict) []name {
+	keys := make([]name, 0, len(d))
+	for k := range d {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
@@ -0,0 +1,158 @@
+// Caching of objects loaded from the file.
+
+package pdf
+
+import (
+	"bytes"
+	"container/list"
+	"fmt"
+	"io/ioutil"
+)
+
+// DefaultCacheSize is the number of objects that a Reader keeps in its cache
+// unless SetCacheSize is called.
+const DefaultCacheSize = 1000
+
+// objStreamCacheSize is the number of decoded object streams that a Reader
+// keeps. They are much larger than ordinary objects, but each one holds many
+// objects.
+const objStreamCacheSize = 16
+
+// An lru is a cache of values keyed by object, which discards the least
+// recently used entries when it is full. It does no locking of its own.
+type lru struct {
+	max   int
+	ll    *list.List
+	items map[objptr]*list.Element
+}
+
+type lruEntry struct {
+	key   objptr
+	value interface{}
+}
+
+func newLRU(max int) *lru {
+	return &lru{
+		max:   max,
+		ll:    list.New(),
+		items: make(map[objptr]*list.Element),
+	}
+}
+
+func (c *lru) get(key objptr) (value interface{}, ok bool) {
+	if e, ok := c.items[key]; ok {
+		c.ll.MoveToFront(e)
+		return e.Value.(*lruEntry).value, true
+	}
+	return nil, false
+}
+
+func (c *lru) put(key objptr, value interface{}) {
+	if c.max <= 0 {
+		return
+	}
+	if e, ok := c.items[key]; ok {
+		c.ll.MoveToFront(e)
+		e.Value.(*lruEntry).value = value
+		return
+	}
+	c.items[key] = c.ll.PushFront(&lruEntry{key, value})
+	c.trim()
+}
+
+func (c *lru) trim() {
+	for c.ll.Len() > c.max {
+		e := c.ll.Back()
+		c.ll.Remove(e)
+		delete(c.items, e.Value.(*lruEntry).key)
+	}
+}
+
+// SetCacheSize sets the maximum number of objects that r keeps in memory after
+// loading them from the file. A size of zero disables the cache.
+func (r *Reader) SetCacheSize(n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cache.max = n
+	r.cache.trim()
+}
+
+// An objStream is the decoded contents of an object stream.
+type objStream struct {
+	data    []byte
+	offsets map[uint32]int64 // where each object starts in data
+	extends objptr           // the stream that this one extends, if any
+}
+
+// loadObjStream returns the decoded object stream ptr, from the cache if
+// possible.
+func (r *Reader) loadObjStream(parent, ptr objptr) (s *objStream, err error) {
+	r.mu.Lock()
+	cached, ok := r.objStreams.get(ptr)
+	r.mu.Unlock()
+	if ok {
+		return cached.(*objStream), nil
+	}
+
+	strm := r.resolve(parent, ptr)
+	if strm.Kind() != Stream {
+		if strm.err != nil {
+			return nil, strm.err
+		}
+		return nil, fmt.Errorf("object stream %v is not a stream", ptr)
+	}
+	if strm.Key("Type").Name() != "ObjStm" {
+		return nil, fmt.Errorf("%v is not an object stream", ptr)
+	}
+	n := strm.Key("N").Int64()
+	if n < 0 {
+		return nil, fmt.Errorf("object stream %v has bad N %d", ptr, n)
+	}
+	first := strm.Key("First").Int64()
+	if first == 0 {
+		return nil, fmt.Errorf("object stream %v is missing First", ptr)
+	}
+	rd := strm.Reader()
+	data, err := ioutil.ReadAll(rd)
+	rd.Close()
+	if err != nil {
+		return nil, fmt.Errorf("reading object stream %v: %v", ptr, err)
+	}
+	// Each entry in the header takes at least four bytes ("1 0 ", without
+	// the space at the very end), so a larger N can't be right, and
+	// mustn't be used to size the map.
+	if max := int64(len(data)+1) / 4; n > max {
+		n = max
+	}
+
+	s = &objStream{
+		data:    data,
+		offsets: make(map[uint32]int64, n),
+	}
+	if ext, ok := strm.data.(stream).hdr["Extends"].(objptr); ok {
+		s.extends = ext
+	}
+	func() {
+		defer catch(&err)
+		b := newBuffer(bytes.NewReader(data), 0)
+		b.allowEOF = true
+		for i := int64(0); i < n; i++ {
+			id, ok1 := b.readToken().(int64)
+			off, ok2 := b.readToken().(int64)
+			if !ok1 || !ok2 {
+				break
+			}
+			if _, dup := s.offsets[uint32(id)]; !dup {
+				s.offsets[uint32(id)] = first + off
+			}
+		}
+	}()
+	if err != nil {
+		return nil, fmt.Errorf("object stream %v: %v", ptr, err)
+	}
+
+	r.mu.Lock()
+	r.objStreams.put(ptr, s)
+	r.mu.Unlock()
+	return s, nil
+}
@@ -0,0 +1,141 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestLRU(t *testing.T) {
+	a, b, c := objptr{1, 0}, objptr{2, 0}, objptr{3, 0}
+	cache := newLRU(2)
+	cache.put(a, "a")
+	cache.put(b, "b")
+	cache.get(a)
+	cache.put(c, "c") // b is the least recently used
+	for _, x := range []struct {
+		key  objptr
+		want interface{}
+	}{
+		{a, "a"},
+		{b, nil},
+		{c, "c"},
+	} {
+		if got, _ := cache.get(x.key); got != x.want {
+			t.Errorf("%v: got %v, want %v", x.key, got, x.want)
+		}
+	}
+
+	cache.max = 1
+	cache.trim()
+	if _, ok := cache.get(a); ok {
+		t.Error("a is still cached after shrinking the cache")
+	}
+	if got, _ := cache.get(c); got != "c" {
+		t.Errorf("after shrinking the cache, got %v for c", got)
+	}
+
+	off := newLRU(0)
+	off.put(a, "a")
+	if _, ok := off.get(a); ok {
+		t.Error("a cache with size 0 kept a value")
+	}
+}
+
+// A countingReaderAt counts the reads from the underlying file.
+type countingReaderAt struct {
+	r     io.ReaderAt
+	reads int
+}
+
+func (c *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	c.reads++
+	return c.r.ReadAt(p, off)
+}
+
+func TestObjStreamCache(t *testing.T) {
+	_, data := newTestReader(t, &WriterOptions{Compress: true, ObjectStreams: true}, func(w *Writer) Value {
+		fonts := make(map[string]Value)
+		for i := 1; i <= 3; i++ {
+			fonts[fmt.Sprintf("F%d", i)] = w.Add(NewDict(map[string]Value{
+				"Type":     NewName("Font"),
+				"Subtype":  NewName("Type1"),
+				"BaseFont": NewName(fmt.Sprintf("Font%d", i)),
+			}))
+		}
+		return newPageTree(w, NewDict(map[string]Value{"Font": NewDict(fonts)}))
+	})
+	f := &countingReaderAt{r: bytes.NewReader(data)}
+	r, err := NewReader(f, int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Loading the page decodes the object stream, which holds all the
+	// objects.
+	if r.NumPage() != 1 {
+		t.Fatalf("got %d pages", r.NumPage())
+	}
+	page := r.Page(1)
+	if n := r.objStreams.ll.Len(); n != 1 {
+		t.Fatalf("%d object streams cached, want 1", n)
+	}
+	reads := f.reads
+
+	// With the object cache off, the objects are parsed again from the
+	// decoded object stream, without reading the file.
+	r.SetCacheSize(0)
+	for i := 1; i <= 3; i++ {
+		if got, want := page.Font(fmt.Sprintf("F%d", i)).BaseFont(), fmt.Sprintf("Font%d", i); got != want {
+			t.Errorf("got font %q, want %q", got, want)
+		}
+	}
+	if f.reads != reads {
+		t.Errorf("%d more reads from the file", f.reads-reads)
+	}
+	if n := r.cache.ll.Len(); n != 0 {
+		t.Errorf("%d objects cached with the cache off", n)
+	}
+
+	r.SetCacheSize(DefaultCacheSize)
+	page.Font("F1").BaseFont()
+	if n := r.cache.ll.Len(); n == 0 {
+		t.Error("no objects cached")
+	}
+}
+
+func TestObjStreamBadN(t *testing.T) {
+	for _, c := range []struct {
+		n    int64
+		fail bool
+	}{
+		{1, false},
+		{1 << 40, false}, // limited by the size of the data
+		{-1, true},
+	} {
+		r, _ := newTestReader(t, nil, func(w *Writer) Value {
+			strm := w.Add(NewStream(NewDict(map[string]Value{
+				"Type":  NewName("ObjStm"),
+				"N":     NewInt(c.n),
+				"First": NewInt(4),
+			}), []byte("5 0 (x)")))
+			return w.Add(NewDict(map[string]Value{"Type": NewName("Catalog"), "ObjStm": strm}))
+		})
+		strm := r.Trailer().Key("Root").Key("ObjStm")
+		s, err := r.loadObjStream(objptr{}, strm.ptr)
+		if c.fail {
+			if err == nil {
+				t.Errorf("N = %d: no error", c.n)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("N = %d: %v", c.n, err)
+			continue
+		}
+		if off, ok := s.offsets[5]; !ok || off != 4 || len(s.offsets) != 1 {
+			t.Errorf("N = %d: got offsets %v", c.n, s.offsets)
+		}
+	}
+}
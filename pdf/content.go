@@ -5,7 +5,8 @@ import "io"
 // A ContentStream is a sequence of instructions (operators and operands)
 // describing the content of a page.
 type ContentStream struct {
-	b *buffer
+	b   *buffer
+	err error
 }
 
 // NewContentStream creates a ContentStream with the contents of r.
@@ -19,8 +20,22 @@ func NewContentStream(r io.Reader) *ContentStream {
 }
 
 // ReadInstruction returns the next instruction.
-// If the end of the stream is reached, the operator will be the empty string.
+// If the end of the stream is reached, or if there is an error,
+// the operator will be the empty string. Err returns the error, if any.
 func (cs *ContentStream) ReadInstruction() (operands []Value, operator string) {
+	if cs.err != nil {
+		return nil, ""
+	}
+	defer func() {
+		if e := recover(); e != nil {
+			se, ok := e.(syntaxError)
+			if !ok {
+				panic(e)
+			}
+			cs.err = se.err
+			operands, operator = nil, ""
+		}
+	}()
 	for {
 		tok := cs.b.readToken()
 		if tok == io.EOF {
@@ -36,6 +51,12 @@ func (cs *ContentStream) ReadInstruction() (operands []Value, operator string) {
 		}
 		cs.b.unreadToken(tok)
 		obj := cs.b.readObject()
-		operands = append(operands, Value{nil, objptr{}, obj})
+		operands = append(operands, Value{data: obj})
 	}
 }
+
+// Err returns the error, if any, that stopped ReadInstruction.
+// Reaching the end of the stream is not an error.
+func (cs *ContentStream) Err() error {
+	return cs.err
+}
@@ -0,0 +1,609 @@
+// Decryption of encrypted PDF files.
+
+package pdf
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rc4"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// See PDF 32000-1:2008, §7.6, and ISO 32000-2:2020, §7.6, for the
+// algorithms used in this file.
+
+var passwordPad = []byte{
+	0x28, 0xBF, 0x4E, 0x5E, 0x4E, 0x75, 0x8A, 0x41, 0x64, 0x00, 0x4E, 0x56, 0xFF, 0xFA, 0x01, 0x08,
+	0x2E, 0x2E, 0x00, 0xB6, 0xD0, 0x68, 0x3E, 0x80, 0x2F, 0x0C, 0xA9, 0xFE, 0x64, 0x53, 0x69, 0x7A,
+}
+
+var ErrInvalidPassword = fmt.Errorf("encrypted PDF: invalid password")
+
+// A cryptMethod is an algorithm for encrypting strings and streams, as named
+// by the CFM entry of a crypt filter.
+type cryptMethod int
+
+const (
+	cryptNone  cryptMethod = iota // no encryption (the Identity filter)
+	cryptRC4                      // RC4, with a key for each object (V2)
+	cryptAESV2                    // AES-128, with a key for each object
+	cryptAESV3                    // AES-256, with the file key
+)
+
+// A decrypter holds what is needed to decrypt the strings and streams of an
+// encrypted file.
+type decrypter struct {
+	key             []byte
+	strMethod       cryptMethod
+	stmMethod       cryptMethod
+	filters         map[name]cryptMethod // the crypt filters, by name
+	encryptMetadata bool
+}
+
+func (r *Reader) initEncrypt(password string) error {
+	encrypt, _ := r.resolve(objptr{}, r.trailer["Encrypt"]).data.(dict)
+	switch encrypt["Filter"] {
+	case name("Standard"):
+		return r.initStandard(encrypt, password)
+	case name("Adobe.PubSec"):
+		return fmt.Errorf("encrypted PDF: file is encrypted for specific recipients; use NewReaderPublicKey")
+	default:
+		return fmt.Errorf("unsupported PDF: encryption filter %v", objfmt(encrypt["Filter"]))
+	}
+}
+
+// newDecrypter reads the parts of the encryption dictionary that are common
+// to all security handlers: the algorithms and the key length in bytes.
+func newDecrypter(encrypt dict) (d *decrypter, keyLen int, err error) {
+	d = &decrypter{encryptMetadata: true}
+	if em, ok := encrypt["EncryptMetadata"].(bool); ok {
+		d.encryptMetadata = em
+	}
+
+	V, _ := encrypt["V"].(int64)
+	switch V {
+	case 1, 2:
+		keyLen = 5
+		if V == 2 {
+			if n, ok := encrypt["Length"].(int64); ok {
+				if n%8 != 0 || n > 128 || n < 40 {
+					return nil, 0, fmt.Errorf("malformed PDF: %d-bit encryption key", n)
+				}
+				keyLen = int(n / 8)
+			}
+		}
+		d.strMethod = cryptRC4
+		d.stmMethod = cryptRC4
+		return d, keyLen, nil
+
+	case 4, 5:
+		keyLen = 16
+		if V == 5 {
+			keyLen = 32
+		} else if n, ok := encrypt["Length"].(int64); ok && n >= 40 && n <= 128 && n%8 == 0 {
+			keyLen = int(n / 8)
+		}
+		d.filters = map[name]cryptMethod{"Identity": cryptNone}
+		cf, _ := encrypt["CF"].(dict)
+		for fname, f := range cf {
+			params, _ := f.(dict)
+			switch params["CFM"] {
+			case nil, name("None"):
+				d.filters[fname] = cryptNone
+			case name("V2"):
+				d.filters[fname] = cryptRC4
+			case name("AESV2"):
+				d.filters[fname] = cryptAESV2
+			case name("AESV3"):
+				d.filters[fname] = cryptAESV3
+			default:
+				return nil, 0, fmt.Errorf("unsupported PDF: crypt filter method %v", objfmt(params["CFM"]))
+			}
+		}
+		lookup := func(key name) (cryptMethod, error) {
+			fname, ok := encrypt[key].(name)
+			if !ok {
+				return cryptNone, nil
+			}
+			m, ok := d.filters[fname]
+			if !ok {
+				return 0, fmt.Errorf("malformed PDF: crypt filter %s not found", fname)
+			}
+			return m, nil
+		}
+		if d.strMethod, err = lookup("StrF"); err != nil {
+			return nil, 0, err
+		}
+		if d.stmMethod, err = lookup("StmF"); err != nil {
+			return nil, 0, err
+		}
+		return d, keyLen, nil
+
+	default:
+		return nil, 0, fmt.Errorf("unsupported PDF: encryption version V=%d; %v", V, objfmt(encrypt))
+	}
+}
+
+// initStandard sets up decryption for a file that uses the standard
+// (password-based) security handler. The password may be either the user
+// password or the owner password.
+func (r *Reader) initStandard(encrypt dict, password string) error {
+	d, keyLen, err := newDecrypter(encrypt)
+	if err != nil {
+		return err
+	}
+	R, _ := encrypt["R"].(int64)
+	O, _ := encrypt["O"].(string)
+	U, _ := encrypt["U"].(string)
+	p, _ := encrypt["P"].(int64)
+	P := uint32(p)
+
+	var owner bool
+	switch {
+	case R < 2:
+		return fmt.Errorf("malformed PDF: encryption revision R=%d", R)
+
+	case R <= 4:
+		if len(O) != 32 || len(U) != 32 {
+			return fmt.Errorf("malformed PDF: missing O= or U= encryption parameters")
+		}
+		ids, ok := r.trailer["ID"].(array)
+		if !ok || len(ids) < 1 {
+			return fmt.Errorf("malformed PDF: missing ID in trailer")
+		}
+		ID, ok := ids[0].(string)
+		if !ok {
+			return fmt.Errorf("malformed PDF: missing ID in trailer")
+		}
+		s := &standardR4{R: int(R), O: []byte(O), U: []byte(U), P: P, ID: []byte(ID), keyLen: keyLen, encryptMetadata: d.encryptMetadata}
+		// Passwords are in PDFDocEncoding; characters that can't be
+		// encoded are dropped.
+		docpw, _ := pdfDocEncode(password)
+		pw := padPassword([]byte(docpw))
+		d.key = s.authenticateUser(pw)
+		if d.key == nil {
+			if d.key = s.authenticateUser(s.userPasswordFromOwner(pw)); d.key == nil {
+				return ErrInvalidPassword
+			}
+			owner = true
+		}
+
+	case R <= 6:
+		if len(O) < 48 || len(U) < 48 {
+			return fmt.Errorf("malformed PDF: missing O= or U= encryption parameters")
+		}
+		OE, _ := encrypt["OE"].(string)
+		UE, _ := encrypt["UE"].(string)
+		if len(OE) != 32 || len(UE) != 32 {
+			return fmt.Errorf("malformed PDF: missing OE= or UE= encryption parameters")
+		}
+		// Passwords are UTF-8 (normalized with SASLprep, which is not done
+		// here), truncated to 127 bytes.
+		pw := []byte(password)
+		if len(pw) > 127 {
+			pw = pw[:127]
+		}
+		u, o := []byte(U[:48]), []byte(O[:48])
+		switch {
+		case bytes.Equal(hashR6(int(R), pw, o[32:40], u), o[:32]):
+			d.key = aesDecryptNoIV(hashR6(int(R), pw, o[40:48], u), []byte(OE))
+			owner = true
+		case bytes.Equal(hashR6(int(R), pw, u[32:40], nil), u[:32]):
+			d.key = aesDecryptNoIV(hashR6(int(R), pw, u[40:48], nil), []byte(UE))
+		default:
+			return ErrInvalidPassword
+		}
+
+		// The Perms entry is an encrypted copy of P, which guards against
+		// tampering with the permissions.
+		if R == 6 || encrypt["Perms"] != nil {
+			perms, _ := encrypt["Perms"].(string)
+			if len(perms) != 16 {
+				return fmt.Errorf("malformed PDF: missing Perms encryption parameter")
+			}
+			block, _ := aes.NewCipher(d.key)
+			dec := make([]byte, 16)
+			block.Decrypt(dec, []byte(perms))
+			if string(dec[9:12]) != "adb" {
+				return fmt.Errorf("malformed PDF: invalid Perms encryption parameter")
+			}
+			if uint32(dec[0])|uint32(dec[1])<<8|uint32(dec[2])<<16|uint32(dec[3])<<24 != P {
+				return fmt.Errorf("malformed PDF: permissions do not match Perms")
+			}
+		}
+
+	default:
+		return fmt.Errorf("unsupported PDF: encryption revision R=%d", R)
+	}
+
+	r.crypt = d
+	r.perms = P
+	r.owner = owner
+	return nil
+}
+
+// A standardR4 holds the parameters of the standard security handler, for
+// revisions 2 through 4.
+type standardR4 struct {
+	R               int
+	O, U            []byte
+	P               uint32
+	ID              []byte
+	keyLen          int
+	encryptMetadata bool
+}
+
+// authenticateUser computes the file key from the padded user password pw
+// (algorithm 2), and checks it against U (algorithms 4 and 5). It returns
+// nil if the password is incorrect.
+func (s *standardR4) authenticateUser(pw []byte) []byte {
+	h := md5.New()
+	h.Write(pw)
+	h.Write(s.O)
+	h.Write([]byte{byte(s.P), byte(s.P >> 8), byte(s.P >> 16), byte(s.P >> 24)})
+	h.Write(s.ID)
+	if s.R >= 4 && !s.encryptMetadata {
+		h.Write([]byte{0xff, 0xff, 0xff, 0xff})
+	}
+	key := h.Sum(nil)
+
+	n := s.keyLen
+	if s.R == 2 {
+		n = 5
+	}
+	if s.R >= 3 {
+		for i := 0; i < 50; i++ {
+			h.Reset()
+			h.Write(key[:n])
+			key = h.Sum(key[:0])
+		}
+	}
+	key = key[:n]
+
+	var u []byte
+	if s.R == 2 {
+		u = make([]byte, 32)
+		copy(u, passwordPad)
+		c, _ := rc4.NewCipher(key)
+		c.XORKeyStream(u, u)
+	} else {
+		h.Reset()
+		h.Write(passwordPad)
+		h.Write(s.ID)
+		u = h.Sum(nil)
+		rc4Rounds(key, u, false)
+	}
+
+	if !bytes.HasPrefix(s.U, u) {
+		return nil
+	}
+	return key
+}
+
+// userPasswordFromOwner recovers the padded user password from the padded
+// owner password pw (algorithm 7). If pw is not the owner password, the
+// result is garbage, which will fail authentication.
+func (s *standardR4) userPasswordFromOwner(pw []byte) []byte {
+	sum := md5.Sum(pw)
+	key := sum[:]
+	n := s.keyLen
+	if s.R == 2 {
+		n = 5
+	}
+	if s.R >= 3 {
+		for i := 0; i < 50; i++ {
+			sum = md5.Sum(key)
+			key = sum[:]
+		}
+	}
+	key = key[:n]
+
+	u := append([]byte(nil), s.O...)
+	if s.R == 2 {
+		c, _ := rc4.NewCipher(key)
+		c.XORKeyStream(u, u)
+	} else {
+		rc4Rounds(key, u, true)
+	}
+	return u
+}
+
+// rc4Rounds encrypts data in place 20 times with RC4, using key XORed with
+// the round number (0 through 19, or 19 through 0 if reverse is true).
+func rc4Rounds(key, data []byte, reverse bool) {
+	key1 := make([]byte, len(key))
+	for i := 0; i < 20; i++ {
+		round := i
+		if reverse {
+			round = 19 - i
+		}
+		for j := range key1 {
+			key1[j] = key[j] ^ byte(round)
+		}
+		c, _ := rc4.NewCipher(key1)
+		c.XORKeyStream(data, data)
+	}
+}
+
+// padPassword pads or truncates a password to 32 bytes.
+func padPassword(pw []byte) []byte {
+	padded := make([]byte, 32)
+	n := copy(padded, pw)
+	copy(padded[n:], passwordPad)
+	return padded
+}
+
+// hashR6 computes the password hash used by revisions 5 and 6 of the
+// standard security handler (algorithm 2.B in ISO 32000-2). Revision 5 uses
+// a single round of SHA-256.
+func hashR6(R int, pw, salt, udata []byte) []byte {
+	h := sha256.New()
+	h.Write(pw)
+	h.Write(salt)
+	h.Write(udata)
+	k := h.Sum(nil)
+	if R == 5 {
+		return k
+	}
+
+	hashes := [3]hash.Hash{sha256.New(), sha512.New384(), sha512.New()}
+	for i := 0; ; i++ {
+		k1 := make([]byte, 0, 64*(len(pw)+len(k)+len(udata)))
+		for j := 0; j < 64; j++ {
+			k1 = append(k1, pw...)
+			k1 = append(k1, k...)
+			k1 = append(k1, udata...)
+		}
+		block, _ := aes.NewCipher(k[:16])
+		e := k1
+		cipher.NewCBCEncrypter(block, k[16:32]).CryptBlocks(e, k1)
+
+		// The sum of the first 16 bytes, taken as a big-endian number,
+		// modulo 3, is the same as the sum of the bytes modulo 3, since
+		// 256 % 3 == 1.
+		sum := 0
+		for _, b := range e[:16] {
+			sum += int(b)
+		}
+		h := hashes[sum%3]
+		h.Reset()
+		h.Write(e)
+		k = h.Sum(nil)
+
+		if i >= 63 && int(e[len(e)-1]) <= i+1-32 {
+			break
+		}
+	}
+	return k[:32]
+}
+
+// aesDecryptNoIV decrypts data with AES-256 in CBC mode, with an
+// initialization vector of zeros and no padding.
+func aesDecryptNoIV(key, data []byte) []byte {
+	block, err := aes.NewCipher(key)
+	if err != nil || len(data)%16 != 0 {
+		return nil
+	}
+	out := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, make([]byte, 16)).CryptBlocks(out, data)
+	return out
+}
+
+// objectKey returns the key for decrypting the strings and streams of the
+// object ptr (algorithm 1). AES-256 uses the file key directly.
+func (d *decrypter) objectKey(method cryptMethod, ptr objptr) []byte {
+	if method == cryptAESV3 {
+		return d.key
+	}
+	h := md5.New()
+	h.Write(d.key)
+	h.Write([]byte{byte(ptr.id), byte(ptr.id >> 8), byte(ptr.id >> 16), byte(ptr.gen), byte(ptr.gen >> 8)})
+	if method == cryptAESV2 {
+		h.Write([]byte("sAlT"))
+	}
+	key := h.Sum(nil)
+	if n := len(d.key) + 5; n < len(key) {
+		key = key[:n]
+	}
+	return key
+}
+
+func (d *decrypter) decryptString(ptr objptr, x string) string {
+	method := d.strMethod
+	switch method {
+	case cryptNone:
+		return x
+	case cryptRC4:
+		c, _ := rc4.NewCipher(d.objectKey(method, ptr))
+		data := []byte(x)
+		c.XORKeyStream(data, data)
+		return string(data)
+	default:
+		// The string is the initialization vector followed by the
+		// ciphertext, padded as in RFC 2898.
+		cb, err := aes.NewCipher(d.objectKey(method, ptr))
+		if err != nil || len(x) < 32 || len(x)%16 != 0 {
+			return ""
+		}
+		data := []byte(x[16:])
+		cipher.NewCBCDecrypter(cb, []byte(x[:16])).CryptBlocks(data, data)
+		return string(unpad(data))
+	}
+}
+
+// decryptStream wraps rd, which reads the raw data of the stream v, so that
+// it decrypts the data.
+func (v Value) decryptStream(x stream, rd io.Reader) io.Reader {
+	d := v.r.crypt
+	if d == nil {
+		return rd
+	}
+	method := d.stmMethod
+	switch x.hdr["Type"] {
+	case name("XRef"):
+		return rd
+	case name("Metadata"):
+		if !d.encryptMetadata {
+			return rd
+		}
+	}
+	// A Crypt filter at the start of the filter chain overrides the
+	// default method for streams.
+	if f := v.Key("Filter"); f.Name() == "Crypt" || f.Index(0).Name() == "Crypt" {
+		params := v.Key("DecodeParms")
+		if f.Kind() == Array {
+			params = params.Index(0)
+		}
+		fname := name(params.Key("Name").Name())
+		if fname == "" {
+			fname = "Identity"
+		}
+		m, ok := d.filters[fname]
+		if !ok {
+			return &errorReadCloser{fmt.Errorf("malformed PDF: crypt filter %s not found", fname)}
+		}
+		method = m
+	}
+
+	key := d.objectKey(method, x.ptr)
+	switch method {
+	case cryptNone:
+		return rd
+	case cryptRC4:
+		c, _ := rc4.NewCipher(key)
+		return &cipher.StreamReader{S: c, R: rd}
+	default:
+		cb, err := aes.NewCipher(key)
+		if err != nil {
+			return &errorReadCloser{fmt.Errorf("AES: %v", err)}
+		}
+		iv := make([]byte, 16)
+		if _, err := io.ReadFull(rd, iv); err != nil {
+			return &errorReadCloser{fmt.Errorf("AES: reading initialization vector: %v", err)}
+		}
+		return &cbcReader{cbc: cipher.NewCBCDecrypter(cb, iv), rd: rd}
+	}
+}
+
+// encryptString encrypts the string x in the object ptr, for writing an
+// update to an encrypted file.
+func (d *decrypter) encryptString(ptr objptr, x string) string {
+	return string(d.encrypt(d.strMethod, ptr, []byte(x)))
+}
+
+// encryptStream encrypts the data of the stream ptr, with the header hdr.
+func (d *decrypter) encryptStream(ptr objptr, hdr dict, data []byte) []byte {
+	switch hdr["Type"] {
+	case name("XRef"):
+		return data
+	case name("Metadata"):
+		if !d.encryptMetadata {
+			return data
+		}
+	}
+	return d.encrypt(d.stmMethod, ptr, data)
+}
+
+func (d *decrypter) encrypt(method cryptMethod, ptr objptr, data []byte) []byte {
+	key := d.objectKey(method, ptr)
+	switch method {
+	case cryptNone:
+		return data
+	case cryptRC4:
+		c, _ := rc4.NewCipher(key)
+		out := make([]byte, len(data))
+		c.XORKeyStream(out, data)
+		return out
+	default:
+		cb, _ := aes.NewCipher(key)
+		pad := 16 - len(data)%16
+		out := make([]byte, 16+len(data)+pad)
+		io.ReadFull(rand.Reader, out[:16])
+		copy(out[16:], data)
+		for i := 16 + len(data); i < len(out); i++ {
+			out[i] = byte(pad)
+		}
+		cipher.NewCBCEncrypter(cb, out[:16]).CryptBlocks(out[16:], out[16:])
+		return out
+	}
+}
+
+// unpad removes the padding from the end of data, as in RFC 2898.
+func unpad(data []byte) []byte {
+	if len(data) == 0 {
+		return data
+	}
+	pad := int(data[len(data)-1])
+	if pad < 1 || pad > 16 || pad > len(data) {
+		return data
+	}
+	return data[:len(data)-pad]
+}
+
+// A cbcReader decrypts a stream encrypted with AES in CBC mode. It reads one
+// block ahead, so that it can remove the padding from the last block.
+type cbcReader struct {
+	cbc  cipher.BlockMode
+	rd   io.Reader
+	next []byte // the next block, already decrypted
+	pend []byte
+	err  error
+}
+
+func (r *cbcReader) Read(b []byte) (n int, err error) {
+	for len(r.pend) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.next == nil {
+			if r.next, r.err = r.readBlock(); r.err != nil {
+				continue
+			}
+		}
+		block := r.next
+		r.next, r.err = r.readBlock()
+		if r.err == io.EOF {
+			block = unpad(block)
+		}
+		r.pend = block
+	}
+	n = copy(b, r.pend)
+	r.pend = r.pend[n:]
+	return n, nil
+}
+
+func (r *cbcReader) readBlock() ([]byte, error) {
+	buf := make([]byte, 16)
+	_, err := io.ReadFull(r.rd, buf)
+	if err == io.ErrUnexpectedEOF {
+		err = errors.New("AES: stream length is not a multiple of the block size")
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.cbc.CryptBlocks(buf, buf)
+	return buf, nil
+}
+
+// Permissions returns the access permissions of an encrypted file (the P
+// entry of its encryption dictionary), and whether it was opened with the
+// owner password (or, for public-key encryption, the permissions granted to
+// the recipient). The owner password grants all permissions. For a file that
+// is not encrypted, Permissions returns all permissions and true.
+//
+// It is up to the application to respect the permissions; the package does
+// not enforce them.
+func (r *Reader) Permissions() (p uint32, owner bool) {
+	if r.crypt == nil {
+		return 0xffffffff, true
+	}
+	return r.perms, r.owner
+}
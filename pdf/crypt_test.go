@@ -0,0 +1,108 @@
+package pdf
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func mustDecodeHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// The expected values in these tests were computed with an independent
+// implementation of algorithm 2.B of ISO 32000-2, with the user password
+// "user", the owner password "owner", and the file key 00 01 02 ... 1f.
+var (
+	r6User           = "273444d38b9bfa2ef7f9ec30b363c84a94e674abb67e0e8c8ca3479a9655109001010101010101010202020202020202"
+	r6UserEncrypted  = "1cd32a3e614179af9c4722c750024a4e47bda2cf30ecfb4cc97e7f77feffd90f"
+	r6Owner          = "9f982be98253f0645861cac62fb244eac286ca130f3246b202b4aadcf58d8d0b03030303030303030404040404040404"
+	r6OwnerEncrypted = "c9e4b1e83a6f417a754ec46a8ad5da4a85b53b543812794e60500debf031ca15"
+	r6Perms          = "f5f99b4811a7cfab72b2b9c7381ed13f" // for P = -1028
+)
+
+func TestHashR6(t *testing.T) {
+	u := mustDecodeHex(r6User)
+	for _, c := range []struct {
+		R     int
+		pw    string
+		salt  []byte
+		udata []byte
+		want  string
+	}{
+		{6, "user", u[32:40], nil, r6User[:64]},
+		{6, "owner", mustDecodeHex(r6Owner)[32:40], u, r6Owner[:64]},
+		{5, "user", u[32:40], nil, "11f9c78082a5dc812a13967141cd9c043e9d2acccb1cc056164aff673c7aa208"},
+	} {
+		if got := hashR6(c.R, []byte(c.pw), c.salt, c.udata); hex.EncodeToString(got) != c.want {
+			t.Errorf("hashR6(%d, %q): got %x, want %s", c.R, c.pw, got, c.want)
+		}
+	}
+}
+
+func r6Encrypt(P int64, perms string) dict {
+	stdCF := dict{"CFM": name("AESV3"), "AuthEvent": name("DocOpen"), "Length": int64(32)}
+	return dict{
+		"Filter": name("Standard"),
+		"V":      int64(5),
+		"R":      int64(6),
+		"Length": int64(256),
+		"CF":     dict{"StdCF": stdCF},
+		"StmF":   name("StdCF"),
+		"StrF":   name("StdCF"),
+		"P":      P,
+		"U":      string(mustDecodeHex(r6User)),
+		"UE":     string(mustDecodeHex(r6UserEncrypted)),
+		"O":      string(mustDecodeHex(r6Owner)),
+		"OE":     string(mustDecodeHex(r6OwnerEncrypted)),
+		"Perms":  string(mustDecodeHex(perms)),
+	}
+}
+
+func TestStandardR6(t *testing.T) {
+	fileKey := make([]byte, 32)
+	for i := range fileKey {
+		fileKey[i] = byte(i)
+	}
+	for _, c := range []struct {
+		password string
+		owner    bool
+	}{
+		{"user", false},
+		{"owner", true},
+	} {
+		r := new(Reader)
+		if err := r.initStandard(r6Encrypt(-1028, r6Perms), c.password); err != nil {
+			t.Errorf("password %q: %v", c.password, err)
+			continue
+		}
+		if !bytes.Equal(r.crypt.key, fileKey) {
+			t.Errorf("password %q: got key %x", c.password, r.crypt.key)
+		}
+		if r.owner != c.owner || r.perms != uint32(0xfffffbfc) {
+			t.Errorf("password %q: got owner %v, permissions %x", c.password, r.owner, r.perms)
+		}
+	}
+
+	if err := new(Reader).initStandard(r6Encrypt(-1028, r6Perms), "wrong"); err != ErrInvalidPassword {
+		t.Errorf("wrong password: got %v", err)
+	}
+
+	// P has been changed to grant more permissions, but Perms still has
+	// the original value.
+	err := new(Reader).initStandard(r6Encrypt(-4, r6Perms), "user")
+	if err == nil || !strings.Contains(err.Error(), "Perms") {
+		t.Errorf("tampered permissions: got %v", err)
+	}
+	// Perms has been damaged.
+	damaged := "00" + r6Perms[2:]
+	err = new(Reader).initStandard(r6Encrypt(-1028, damaged), "user")
+	if err == nil || !strings.Contains(err.Error(), "Perms") {
+		t.Errorf("damaged Perms: got %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+// Dates.
+
+package pdf
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseDate parses a date string, in the format D:YYYYMMDDHHmmSSOHH'mm
+// (PDF 32000-1:2008, section 7.9.4). All the fields after the year are
+// optional. Since many files get the format slightly wrong, parseDate also
+// accepts dates without the D: prefix, with a trailing apostrophe, and with
+// missing minutes in the time zone.
+func parseDate(s string) (time.Time, error) {
+	orig := s
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(s, "D:")
+
+	// The fields of the date, with their ranges and defaults.
+	fields := []struct {
+		width, min, max, value int
+	}{
+		{4, 0, 9999, 0}, // year
+		{2, 1, 12, 1},   // month
+		{2, 1, 31, 1},   // day
+		{2, 0, 23, 0},   // hour
+		{2, 0, 59, 0},   // minute
+		{2, 0, 59, 0},   // second
+	}
+	for i := range fields {
+		f := &fields[i]
+		if len(s) == 0 || !isDigit(s[0]) {
+			if i == 0 {
+				return time.Time{}, fmt.Errorf("invalid date %q", orig)
+			}
+			break
+		}
+		if len(s) < f.width {
+			return time.Time{}, fmt.Errorf("invalid date %q", orig)
+		}
+		n, err := strconv.Atoi(s[:f.width])
+		if err != nil || n < f.min || n > f.max {
+			return time.Time{}, fmt.Errorf("invalid date %q", orig)
+		}
+		f.value = n
+		s = s[f.width:]
+	}
+
+	loc := time.UTC
+	if len(s) > 0 {
+		switch s[0] {
+		case 'Z':
+			// UTC
+		case '+', '-':
+			sign := 1
+			if s[0] == '-' {
+				sign = -1
+			}
+			tz := strings.Replace(s[1:], "'", "", -1)
+			if len(tz) < 2 {
+				return time.Time{}, fmt.Errorf("invalid time zone in date %q", orig)
+			}
+			hh, err := strconv.Atoi(tz[:2])
+			if err != nil {
+				return time.Time{}, fmt.Errorf("invalid time zone in date %q", orig)
+			}
+			mm := 0
+			if len(tz) >= 4 {
+				mm, err = strconv.Atoi(tz[2:4])
+				if err != nil {
+					return time.Time{}, fmt.Errorf("invalid time zone in date %q", orig)
+				}
+			}
+			loc = time.FixedZone("", sign*(hh*3600+mm*60))
+		default:
+			return time.Time{}, fmt.Errorf("invalid date %q", orig)
+		}
+	}
+	return time.Date(fields[0].value, time.Month(fields[1].value), fields[2].value, fields[3].value, fields[4].value, fields[5].value, 0, loc), nil
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
@@ -0,0 +1,56 @@
+package pdf
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDate(t *testing.T) {
+	for _, c := range []struct {
+		s      string
+		want   time.Time
+		offset int // the time zone offset, in seconds
+		ok     bool
+	}{
+		{"D:2024", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), 0, true},
+		{"D:202403", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), 0, true},
+		{"D:20240315", time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC), 0, true},
+		{"D:2024031513", time.Date(2024, 3, 15, 13, 0, 0, 0, time.UTC), 0, true},
+		{"D:20240315134502", time.Date(2024, 3, 15, 13, 45, 2, 0, time.UTC), 0, true},
+		{"D:20240315134502Z", time.Date(2024, 3, 15, 13, 45, 2, 0, time.UTC), 0, true},
+		{"D:20240315134502Z00'00'", time.Date(2024, 3, 15, 13, 45, 2, 0, time.UTC), 0, true},
+		{"D:20240315134502+05'30'", time.Date(2024, 3, 15, 8, 15, 2, 0, time.UTC), 19800, true},
+		{"D:20240315134502+05'30", time.Date(2024, 3, 15, 8, 15, 2, 0, time.UTC), 19800, true},
+		{"D:20240315134502+0530", time.Date(2024, 3, 15, 8, 15, 2, 0, time.UTC), 19800, true},
+		{"D:20240315134502-08'", time.Date(2024, 3, 15, 21, 45, 2, 0, time.UTC), -28800, true},
+		{"D:20240315134502-08", time.Date(2024, 3, 15, 21, 45, 2, 0, time.UTC), -28800, true},
+		{"20240315", time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC), 0, true},
+		{" D:2024 ", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), 0, true},
+		{"", time.Time{}, 0, false},
+		{"D:", time.Time{}, 0, false},
+		{"D:202", time.Time{}, 0, false},
+		{"D:2024031", time.Time{}, 0, false},
+		{"D:20241315", time.Time{}, 0, false},
+		{"D:20240332", time.Time{}, 0, false},
+		{"D:2024031524", time.Time{}, 0, false},
+		{"D:20240315134502+5", time.Time{}, 0, false},
+		{"D:20240315134502+ab'cd'", time.Time{}, 0, false},
+		{"D:20240315134502X", time.Time{}, 0, false},
+		{"March 15, 2024", time.Time{}, 0, false},
+	} {
+		got, err := parseDate(c.s)
+		if !c.ok {
+			if err == nil {
+				t.Errorf("parseDate(%q) = %v, want an error", c.s, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseDate(%q): %v", c.s, err)
+			continue
+		}
+		if _, offset := got.Zone(); !got.Equal(c.want) || offset != c.offset {
+			t.Errorf("parseDate(%q) = %v, want %v with offset %d", c.s, got, c.want, c.offset)
+		}
+	}
+}
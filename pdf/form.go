@@ -0,0 +1,387 @@
+// Interactive forms.
+
+package pdf
+
+import (
+	"io"
+	"strconv"
+	"time"
+)
+
+// FieldFlags are the flags in a form field's Ff entry (PDF 32000-1:2008,
+// section 12.7.3.1). Some bits have different meanings for different types
+// of field.
+type FieldFlags uint32
+
+const (
+	FieldReadOnly FieldFlags = 1 << 0
+	FieldRequired FieldFlags = 1 << 1
+	FieldNoExport FieldFlags = 1 << 2
+
+	// Button fields.
+	FieldNoToggleToOff  FieldFlags = 1 << 14
+	FieldRadio          FieldFlags = 1 << 15
+	FieldPushbutton     FieldFlags = 1 << 16
+	FieldRadiosInUnison FieldFlags = 1 << 25
+
+	// Text fields.
+	FieldMultiline       FieldFlags = 1 << 12
+	FieldPassword        FieldFlags = 1 << 13
+	FieldFileSelect      FieldFlags = 1 << 20
+	FieldDoNotSpellCheck FieldFlags = 1 << 22
+	FieldDoNotScroll     FieldFlags = 1 << 23
+	FieldComb            FieldFlags = 1 << 24
+	FieldRichText        FieldFlags = 1 << 25
+
+	// Choice fields.
+	FieldCombo             FieldFlags = 1 << 17
+	FieldEdit              FieldFlags = 1 << 18
+	FieldSort              FieldFlags = 1 << 19
+	FieldMultiSelect       FieldFlags = 1 << 21
+	FieldCommitOnSelChange FieldFlags = 1 << 26
+)
+
+// A FieldKind is the kind of a form field, which depends on its type (FT)
+// and flags.
+type FieldKind int
+
+const (
+	UnknownField FieldKind = iota
+	TextField
+	CheckBoxField
+	RadioField
+	PushButtonField
+	ComboBoxField
+	ListBoxField
+	SignatureField
+)
+
+var fieldKindNames = [...]string{
+	UnknownField:    "Unknown",
+	TextField:       "Text",
+	CheckBoxField:   "CheckBox",
+	RadioField:      "Radio",
+	PushButtonField: "PushButton",
+	ComboBoxField:   "ComboBox",
+	ListBoxField:    "ListBox",
+	SignatureField:  "Signature",
+}
+
+func (k FieldKind) String() string {
+	if k < 0 || int(k) >= len(fieldKindNames) {
+		return "FieldKind(" + strconv.Itoa(int(k)) + ")"
+	}
+	return fieldKindNames[k]
+}
+
+// A Field is a terminal field of an interactive form: one that holds a value,
+// rather than only grouping other fields. The attributes that a field
+// inherits from its ancestors in the field tree are filled in.
+type Field struct {
+	// Name is the fully qualified name of the field: the partial names
+	// of the field and its ancestors, separated by periods.
+	Name string
+
+	// AlternateName is the name to show in the user interface (TU), or
+	// empty.
+	AlternateName string
+
+	Type  string // the field type: "Tx", "Btn", "Ch" or "Sig"
+	Kind  FieldKind
+	Flags FieldFlags
+
+	// Value is the value of the field: for a text field, its text; for
+	// a check box or radio button, the name of the selected state ("Off"
+	// if none is selected), or the export value from Options if the
+	// states are numbered; for a choice field, the selected options.
+	// It is empty if the field has no value. Default is the value that
+	// the field is reset to (DV), in the same form.
+	Value   []string
+	Default []string
+
+	// Signature is the value of a signature field, or nil if the field
+	// isn't signed.
+	Signature *Signature
+
+	// DefaultAppearance is the DA string, which sets the font and color
+	// of variable text. It is inherited from the AcroForm dictionary if
+	// no field specifies it.
+	DefaultAppearance string
+
+	// MaxLen is the maximum length of a text field, or 0 if there is no
+	// limit.
+	MaxLen int
+
+	// Options are the items of a choice field, or the export values of a
+	// check box or radio button.
+	Options []FieldOption
+
+	// Widgets are the widget annotations that show the field.
+	Widgets []Widget
+
+	// V is the field dictionary.
+	V Value
+}
+
+// A FieldOption is an item of a choice field.
+type FieldOption struct {
+	Export  string // the value that the field has when this option is chosen
+	Display string // the text shown for the option
+}
+
+// A Widget is a widget annotation, which shows a form field on a page.
+type Widget struct {
+	// Page is the number of the page (numbered from 1, as for Page) with
+	// the widget, or 0 if it can't be found.
+	Page int
+
+	// Rect is the location of the widget on the page.
+	Rect Rect
+
+	// State is the appearance state (AS) of a check box or radio button
+	// widget, and OnState is the name of its appearance state for when it
+	// is selected.
+	State, OnState string
+
+	// V is the annotation dictionary.
+	V Value
+}
+
+// A Signature is the value of a signature field (PDF 32000-1:2008, section
+// 12.8.1).
+type Signature struct {
+	Filter    string // the preferred signature handler, such as "Adobe.PPKLite"
+	SubFilter string // the encoding of the signature, such as "adbe.pkcs7.detached"
+
+	Name        string // the name of the signer
+	Reason      string
+	Location    string
+	ContactInfo string
+	Signed      time.Time // zero if it isn't known
+
+	// V is the signature dictionary.
+	V Value
+}
+
+// inheritedFieldKeys are the field attributes that are inherited from
+// ancestors in the field tree.
+var inheritedFieldKeys = []string{"FT", "Ff", "V", "DV", "DA", "Opt", "MaxLen"}
+
+// Fields returns the terminal fields of the document's interactive form
+// (AcroForm), in the order in which they appear in the field tree. A field
+// whose kids are a mixture of widgets and fields, which the PDF
+// specification doesn't allow, is listed with its widgets, as well as its
+// descendants.
+func (r *Reader) Fields() []Field {
+	form := r.Trailer().Key("Root").Key("AcroForm")
+	if form.Kind() != Dict {
+		return nil
+	}
+
+	// The page with each widget annotation.
+	widgetPages := make(map[objptr]int)
+	for i, p := range r.Pages() {
+		annots := p.V.Key("Annots")
+		for j := 0; j < annots.Len(); j++ {
+			if a := annots.Index(j); a.indirect {
+				if _, dup := widgetPages[a.ptr]; !dup {
+					widgetPages[a.ptr] = i + 1
+				}
+			}
+		}
+	}
+
+	w := &fieldWalker{
+		d:           newDestResolver(r),
+		widgetPages: widgetPages,
+		seen:        make(map[objptr]bool),
+	}
+	inherited := map[string]Value{"DA": form.Key("DA")}
+	fields := form.Key("Fields")
+	for i := 0; i < fields.Len(); i++ {
+		w.walk(fields.Index(i), "", inherited, 0)
+	}
+	return w.fields
+}
+
+// A fieldWalker walks the field tree, collecting the terminal fields.
+type fieldWalker struct {
+	d           *destResolver
+	widgetPages map[objptr]int
+	seen        map[objptr]bool
+	fields      []Field
+}
+
+func (w *fieldWalker) walk(v Value, parentName string, inherited map[string]Value, depth int) {
+	if !visit(v, w.seen, depth) {
+		return
+	}
+
+	name := parentName
+	if t := v.Key("T"); t.Kind() == String {
+		if name != "" {
+			name += "."
+		}
+		name += t.Text()
+	}
+
+	attrs := make(map[string]Value, len(inheritedFieldKeys))
+	for _, k := range inheritedFieldKeys {
+		if a := v.Key(k); !a.IsNull() {
+			attrs[k] = a
+		} else {
+			attrs[k] = inherited[k]
+		}
+	}
+
+	// The kids of a field are either fields or widgets. A terminal field
+	// has only widgets as kids, or is merged with its only widget. Some
+	// files mix widgets and fields in the same Kids array; then the
+	// field is listed with the widgets, followed by its descendants.
+	kids := v.Key("Kids")
+	var widgets, children []Value
+	for i := 0; i < kids.Len(); i++ {
+		if kid := kids.Index(i); isWidget(kid) {
+			widgets = append(widgets, kid)
+		} else {
+			children = append(children, kid)
+		}
+	}
+	if kids.Len() == 0 && v.Key("Subtype").Name() == "Widget" {
+		widgets = append(widgets, v)
+	}
+	if len(children) == 0 || len(widgets) > 0 {
+		w.fields = append(w.fields, w.newField(v, name, attrs, widgets))
+	}
+	for _, kid := range children {
+		w.walk(kid, name, attrs, depth+1)
+	}
+}
+
+// isWidget reports whether v, a kid of a field, is a widget annotation
+// rather than a field. Widgets don't have partial names.
+func isWidget(v Value) bool {
+	if !v.Key("T").IsNull() {
+		return false
+	}
+	return v.Key("Subtype").Name() == "Widget" || v.Key("Kids").IsNull()
+}
+
+func (w *fieldWalker) newField(v Value, name string, attrs map[string]Value, widgets []Value) Field {
+	f := Field{
+		Name:              name,
+		AlternateName:     v.Key("TU").Text(),
+		Type:              attrs["FT"].Name(),
+		Flags:             FieldFlags(attrs["Ff"].Int64()),
+		DefaultAppearance: attrs["DA"].RawString(),
+		MaxLen:            attrs["MaxLen"].Int(),
+		V:                 v,
+	}
+
+	switch f.Type {
+	case "Tx":
+		f.Kind = TextField
+	case "Btn":
+		switch {
+		case f.Flags&FieldPushbutton != 0:
+			f.Kind = PushButtonField
+		case f.Flags&FieldRadio != 0:
+			f.Kind = RadioField
+		default:
+			f.Kind = CheckBoxField
+		}
+	case "Ch":
+		f.Kind = ListBoxField
+		if f.Flags&FieldCombo != 0 {
+			f.Kind = ComboBoxField
+		}
+	case "Sig":
+		f.Kind = SignatureField
+	}
+
+	opt := attrs["Opt"]
+	for i := 0; i < opt.Len(); i++ {
+		o := opt.Index(i)
+		if o.Kind() == Array {
+			f.Options = append(f.Options, FieldOption{Export: o.Index(0).Text(), Display: o.Index(1).Text()})
+		} else {
+			f.Options = append(f.Options, FieldOption{Export: o.Text(), Display: o.Text()})
+		}
+	}
+
+	for _, wv := range widgets {
+		wd := Widget{
+			State: wv.Key("AS").Name(),
+			V:     wv,
+		}
+		if wv.indirect {
+			wd.Page = w.widgetPages[wv.ptr]
+		}
+		if wd.Page == 0 {
+			wd.Page = w.d.pageNumber(wv.Key("P"))
+		}
+		wd.Rect, _ = rectValue(wv.Key("Rect"))
+		for _, state := range wv.Key("AP").Key("N").Keys() {
+			if state != "Off" {
+				wd.OnState = state
+				break
+			}
+		}
+		f.Widgets = append(f.Widgets, wd)
+	}
+
+	if f.Kind == SignatureField {
+		if sig := attrs["V"]; sig.Kind() == Dict {
+			f.Signature = &Signature{
+				Filter:      sig.Key("Filter").Name(),
+				SubFilter:   sig.Key("SubFilter").Name(),
+				Name:        sig.Key("Name").Text(),
+				Reason:      sig.Key("Reason").Text(),
+				Location:    sig.Key("Location").Text(),
+				ContactInfo: sig.Key("ContactInfo").Text(),
+				V:           sig,
+			}
+			f.Signature.Signed, _ = parseDate(sig.Key("M").Text())
+		}
+	} else {
+		f.Value = f.fieldValue(attrs["V"])
+		f.Default = f.fieldValue(attrs["DV"])
+	}
+	return f
+}
+
+// fieldValue decodes a field value (V or DV).
+func (f *Field) fieldValue(v Value) []string {
+	switch v.Kind() {
+	case String:
+		return []string{v.Text()}
+	case Name:
+		state := v.Name()
+		// When a button field has export values, its states may be
+		// numbered, as indexes into Opt.
+		if len(f.Options) > 0 && (f.Kind == CheckBoxField || f.Kind == RadioField) {
+			if i, err := strconv.Atoi(state); err == nil && i >= 0 && i < len(f.Options) {
+				return []string{f.Options[i].Export}
+			}
+		}
+		return []string{state}
+	case Array:
+		var values []string
+		for i := 0; i < v.Len(); i++ {
+			if e := v.Index(i); e.Kind() == String {
+				values = append(values, e.Text())
+			}
+		}
+		return values
+	case Stream:
+		// Rich text fields may keep their value in a stream.
+		rd := v.Reader()
+		defer rd.Close()
+		data, err := io.ReadAll(rd)
+		if err != nil {
+			return nil
+		}
+		return []string{NewString(string(data)).Text()}
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package pdf
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFields(t *testing.T) {
+	r, _ := newTestReader(t, nil, func(w *Writer) Value {
+		nameWidget, ageWidget1, ageWidget2, red, green, agree, mixedWidget := w.Alloc(), w.Alloc(), w.Alloc(), w.Alloc(), w.Alloc(), w.Alloc(), w.Alloc()
+		root, pages := addPages(w,
+			map[string]Value{"Annots": NewArray(nameWidget, red, green, agree)},
+			map[string]Value{"Annots": NewArray(ageWidget1, mixedWidget)},
+		)
+		rect := func(x1, y1, x2, y2 int64) Value {
+			return NewArray(NewInt(x1), NewInt(y1), NewInt(x2), NewInt(y2))
+		}
+		widget := func(entries map[string]Value) Value {
+			d := map[string]Value{"Type": NewName("Annot"), "Subtype": NewName("Widget")}
+			for k, v := range entries {
+				d[k] = v
+			}
+			return NewDict(d)
+		}
+		appearances := func(states ...string) Value {
+			n := make(map[string]Value)
+			for _, s := range states {
+				n[s] = w.Add(NewStream(NewDict(nil), nil))
+			}
+			return NewDict(map[string]Value{"N": NewDict(n)})
+		}
+
+		person := w.Alloc()
+		// A field merged with its widget.
+		w.Set(nameWidget, widget(map[string]Value{
+			"T":      NewTextString("name"),
+			"Parent": person,
+			"V":      NewTextString("Alice"),
+			"Rect":   rect(100, 700, 300, 720),
+		}))
+
+		age := w.Alloc()
+		w.Set(age, NewDict(map[string]Value{
+			"T":      NewTextString("age"),
+			"Parent": person,
+			"MaxLen": NewInt(3),
+			"DA":     NewString("/Cour 10 Tf 0 g"),
+			"Kids":   NewArray(ageWidget1, ageWidget2),
+		}))
+		w.Set(ageWidget1, widget(map[string]Value{"Parent": age, "Rect": rect(100, 600, 140, 620)}))
+		// This widget isn't in any page's Annots, but has P.
+		w.Set(ageWidget2, widget(map[string]Value{"Parent": age, "Rect": rect(100, 500, 140, 520), "P": pages[0]}))
+
+		w.Set(person, NewDict(map[string]Value{
+			"T":    NewTextString("person"),
+			"FT":   NewName("Tx"),
+			"Ff":   NewInt(int64(FieldRequired)),
+			"Kids": NewArray(nameWidget, age),
+		}))
+
+		// A radio button field with numbered states.
+		color := w.Alloc()
+		w.Set(red, widget(map[string]Value{"Parent": color, "AS": NewName("Off"), "AP": appearances("0", "Off"), "Rect": rect(10, 10, 20, 20)}))
+		w.Set(green, widget(map[string]Value{"Parent": color, "AS": NewName("1"), "AP": appearances("1", "Off"), "Rect": rect(30, 10, 40, 20)}))
+		w.Set(color, NewDict(map[string]Value{
+			"T":    NewTextString("color"),
+			"FT":   NewName("Btn"),
+			"Ff":   NewInt(int64(FieldRadio | FieldNoToggleToOff)),
+			"Opt":  NewArray(NewTextString("Red"), NewTextString("Green")),
+			"V":    NewName("1"),
+			"Kids": NewArray(red, green),
+		}))
+
+		// A check box merged with its widget.
+		w.Set(agree, widget(map[string]Value{
+			"T":    NewTextString("agree"),
+			"FT":   NewName("Btn"),
+			"V":    NewName("Yes"),
+			"AS":   NewName("Yes"),
+			"AP":   appearances("Off", "Yes"),
+			"Rect": rect(50, 50, 60, 60),
+		}))
+
+		// Choice fields that inherit their type, flags and options.
+		choices := w.Add(NewDict(map[string]Value{
+			"T":   NewTextString("choices"),
+			"FT":  NewName("Ch"),
+			"Ff":  NewInt(int64(FieldMultiSelect)),
+			"Opt": NewArray(NewArray(NewString("r"), NewTextString("Red")), NewArray(NewString("g"), NewTextString("Green"))),
+			"Kids": NewArray(
+				w.Add(NewDict(map[string]Value{"T": NewTextString("list"), "V": NewArray(NewString("r"), NewString("g")), "DV": NewString("r")})),
+				w.Add(NewDict(map[string]Value{"T": NewTextString("combo"), "Ff": NewInt(int64(FieldCombo)), "V": NewString("g")})),
+			),
+		}))
+
+		sig := w.Add(NewDict(map[string]Value{
+			"T":  NewTextString("sig"),
+			"FT": NewName("Sig"),
+			"V": NewDict(map[string]Value{
+				"Type":      NewName("Sig"),
+				"Filter":    NewName("Adobe.PPKLite"),
+				"SubFilter": NewName("adbe.pkcs7.detached"),
+				"Name":      NewTextString("Alice"),
+				"Reason":    NewTextString("Approval"),
+				"M":         NewString("D:20240315134502Z"),
+			}),
+		}))
+
+		// A field whose kids are a widget and a field.
+		mixed := w.Alloc()
+		w.Set(mixedWidget, widget(map[string]Value{"Parent": mixed, "Rect": rect(0, 0, 10, 10)}))
+		w.Set(mixed, NewDict(map[string]Value{
+			"T":    NewTextString("mixed"),
+			"FT":   NewName("Tx"),
+			"V":    NewTextString("outer"),
+			"Kids": NewArray(mixedWidget, w.Add(NewDict(map[string]Value{"T": NewTextString("inner"), "V": NewTextString("inner")}))),
+		}))
+
+		return w.Add(NewDict(map[string]Value{
+			"Type":  NewName("Catalog"),
+			"Pages": root,
+			"AcroForm": NewDict(map[string]Value{
+				"Fields": NewArray(person, color, agree, choices, sig, mixed),
+				"DA":     NewString("/Helv 0 Tf 0 g"),
+			}),
+		}))
+	})
+
+	fields := r.Fields()
+	var names []string
+	for _, f := range fields {
+		names = append(names, f.Name)
+	}
+	want := []string{"person.name", "person.age", "color", "agree", "choices.list", "choices.combo", "sig", "mixed", "mixed.inner"}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("got fields %q, want %q", names, want)
+	}
+	field := func(name string) Field {
+		for _, f := range fields {
+			if f.Name == name {
+				return f
+			}
+		}
+		return Field{}
+	}
+
+	f := field("person.name")
+	if f.Kind != TextField || f.Flags != FieldRequired || f.DefaultAppearance != "/Helv 0 Tf 0 g" || !reflect.DeepEqual(f.Value, []string{"Alice"}) {
+		t.Errorf("person.name: got %+v", f)
+	}
+	if len(f.Widgets) != 1 || f.Widgets[0].Page != 1 || f.Widgets[0].V.Key("T").Text() != "name" {
+		t.Errorf("person.name: got widgets %+v", f.Widgets)
+	}
+
+	f = field("person.age")
+	if f.Kind != TextField || f.Flags != FieldRequired || f.MaxLen != 3 || f.DefaultAppearance != "/Cour 10 Tf 0 g" {
+		t.Errorf("person.age: got %+v", f)
+	}
+	if len(f.Widgets) != 2 || f.Widgets[0].Page != 2 || f.Widgets[1].Page != 1 {
+		t.Errorf("person.age: got widgets %+v", f.Widgets)
+	} else if want := (Rect{Point{100, 600}, Point{140, 620}}); f.Widgets[0].Rect != want {
+		t.Errorf("person.age: got rectangle %v, want %v", f.Widgets[0].Rect, want)
+	}
+
+	f = field("color")
+	if f.Kind != RadioField || !reflect.DeepEqual(f.Value, []string{"Green"}) || len(f.Widgets) != 2 {
+		t.Errorf("color: got %+v", f)
+	} else if w := f.Widgets[1]; w.State != "1" || w.OnState != "1" || w.Page != 1 {
+		t.Errorf("color: got widget %+v", w)
+	}
+
+	f = field("agree")
+	if f.Kind != CheckBoxField || !reflect.DeepEqual(f.Value, []string{"Yes"}) || len(f.Widgets) != 1 || f.Widgets[0].OnState != "Yes" || f.Widgets[0].Page != 1 {
+		t.Errorf("agree: got %+v", f)
+	}
+
+	options := []FieldOption{{"r", "Red"}, {"g", "Green"}}
+	f = field("choices.list")
+	if f.Kind != ListBoxField || f.Flags != FieldMultiSelect || !reflect.DeepEqual(f.Options, options) ||
+		!reflect.DeepEqual(f.Value, []string{"r", "g"}) || !reflect.DeepEqual(f.Default, []string{"r"}) {
+		t.Errorf("choices.list: got %+v", f)
+	}
+	f = field("choices.combo")
+	if f.Kind != ComboBoxField || !reflect.DeepEqual(f.Options, options) || !reflect.DeepEqual(f.Value, []string{"g"}) {
+		t.Errorf("choices.combo: got %+v", f)
+	}
+
+	f = field("sig")
+	if f.Kind != SignatureField || f.Signature == nil || f.Value != nil {
+		t.Fatalf("sig: got %+v", f)
+	}
+	if s := f.Signature; s.Filter != "Adobe.PPKLite" || s.SubFilter != "adbe.pkcs7.detached" || s.Name != "Alice" || s.Reason != "Approval" ||
+		!s.Signed.Equal(time.Date(2024, 3, 15, 13, 45, 2, 0, time.UTC)) {
+		t.Errorf("sig: got signature %+v", s)
+	}
+
+	f = field("mixed")
+	if !reflect.DeepEqual(f.Value, []string{"outer"}) || len(f.Widgets) != 1 || f.Widgets[0].Page != 2 {
+		t.Errorf("mixed: got %+v", f)
+	}
+	f = field("mixed.inner")
+	if f.Kind != TextField || !reflect.DeepEqual(f.Value, []string{"inner"}) || len(f.Widgets) != 0 {
+		t.Errorf("mixed.inner: got %+v", f)
+	}
+}
@@ -0,0 +1,70 @@
+package pdf
+
+import (
+	"bytes"
+	"testing"
+)
+
+// newTestReader writes a file with the Writer and opens it. build adds the
+// objects to the Writer, and returns the document catalog.
+func newTestReader(t *testing.T, opts *WriterOptions, build func(w *Writer) Value) (*Reader, []byte) {
+	t.Helper()
+	var buf bytes.Buffer
+	w := NewWriter(&buf, opts)
+	root := build(w)
+	if err := w.Finish(NewDict(map[string]Value{"Root": root})); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r, buf.Bytes()
+}
+
+// newPageTree returns a catalog with one page, with the given resources.
+func newPageTree(w *Writer, resources Value) Value {
+	return newPages(w, map[string]Value{"Resources": resources})
+}
+
+// newPages returns a catalog with a page for each of the dictionaries in
+// pages. Type, Parent, and MediaBox are filled in.
+func newPages(w *Writer, pages ...map[string]Value) Value {
+	return newCatalog(w, nil, pages...)
+}
+
+// newCatalog is like newPages, but adds entries to the catalog.
+func newCatalog(w *Writer, entries map[string]Value, pages ...map[string]Value) Value {
+	root, _ := addPages(w, pages...)
+	catalog := map[string]Value{
+		"Type":  NewName("Catalog"),
+		"Pages": root,
+	}
+	for k, v := range entries {
+		catalog[k] = v
+	}
+	return w.Add(NewDict(catalog))
+}
+
+// addPages adds a page tree with a page for each of the dictionaries in
+// pages, and returns the root of the tree and references to the pages.
+func addPages(w *Writer, pages ...map[string]Value) (root Value, refs []Value) {
+	root = w.Alloc()
+	for _, entries := range pages {
+		page := map[string]Value{
+			"Type":     NewName("Page"),
+			"Parent":   root,
+			"MediaBox": NewArray(NewInt(0), NewInt(0), NewInt(612), NewInt(792)),
+		}
+		for k, v := range entries {
+			page[k] = v
+		}
+		refs = append(refs, w.Add(NewDict(page)))
+	}
+	w.Set(root, NewDict(map[string]Value{
+		"Type":  NewName("Pages"),
+		"Kids":  NewArray(refs...),
+		"Count": NewInt(int64(len(refs))),
+	}))
+	return root, refs
+}
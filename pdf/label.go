@@ -0,0 +1,228 @@
+// Page labels.
+
+package pdf
+
+import (
+	"strconv"
+	"strings"
+)
+
+// A labelRange is a range of pages that are labeled in the same style,
+// from a page label dictionary (PDF 32000-1:2008, section 12.4.2).
+type labelRange struct {
+	first  int    // the index of the first page, from 0
+	style  string // the numbering style: D, R, r, A, a, or empty for none
+	prefix string
+	start  int // the number of the first page
+}
+
+// pageLabelRanges returns the ranges of page labels, in order. They are
+// read from the file only once.
+func (r *Reader) pageLabelRanges() []labelRange {
+	r.mu.Lock()
+	ranges, loaded := r.pageLabels, r.pageLabelsLoaded
+	r.mu.Unlock()
+	if loaded {
+		return ranges
+	}
+	NumberTree{r.Trailer().Key("Root").Key("PageLabels")}.Walk(func(key int64, v Value) bool {
+		if key < 0 || len(ranges) > 0 && int(key) <= ranges[len(ranges)-1].first {
+			// Out of order; ignore it.
+			return true
+		}
+		lr := labelRange{
+			first:  int(key),
+			style:  v.Key("S").Name(),
+			prefix: v.Key("P").Text(),
+			start:  1,
+		}
+		if st := v.Key("St"); st.Kind() == Integer && st.Int() >= 1 {
+			lr.start = st.Int()
+		}
+		ranges = append(ranges, lr)
+		return true
+	})
+
+	r.mu.Lock()
+	r.pageLabels, r.pageLabelsLoaded = ranges, true
+	r.mu.Unlock()
+	return ranges
+}
+
+// PageLabel returns the label of page n (numbered from 1, as for Page): the
+// page number that is printed on the page, such as "iv" or "A-3", as given by
+// the document's page labels. If the document doesn't have page labels, the
+// label is n in decimal. If page n isn't covered by the page labels, the label
+// is empty.
+func (r *Reader) PageLabel(n int) string {
+	ranges := r.pageLabelRanges()
+	if len(ranges) == 0 {
+		return strconv.Itoa(n)
+	}
+	index := n - 1
+	for i := len(ranges) - 1; i >= 0; i-- {
+		if lr := ranges[i]; lr.first <= index {
+			return lr.prefix + formatPageNumber(lr.style, lr.start+index-lr.first)
+		}
+	}
+	return ""
+}
+
+// PageForLabel returns the number of the first page (numbered from 1, as for
+// Page) whose label is label, or 0 if there is no such page. If no label
+// matches exactly, the numeric part of the label may be given in either upper
+// or lower case, so that "IV" finds page "iv".
+func (r *Reader) PageForLabel(label string) int {
+	numPages := r.NumPage()
+	ranges := r.pageLabelRanges()
+	if len(ranges) == 0 {
+		ranges = []labelRange{{style: "D", start: 1}}
+	}
+	if n := findLabel(ranges, numPages, label, false); n != 0 {
+		return n
+	}
+	return findLabel(ranges, numPages, label, true)
+}
+
+// findLabel returns the number of the first page with the given label, or 0.
+// If fold is true, the case of the numeric part is ignored.
+func findLabel(ranges []labelRange, numPages int, label string, fold bool) int {
+	for i, lr := range ranges {
+		end := numPages // the index after the last page in the range
+		if i+1 < len(ranges) && ranges[i+1].first < end {
+			end = ranges[i+1].first
+		}
+		if lr.first >= end || !strings.HasPrefix(label, lr.prefix) {
+			continue
+		}
+		num := label[len(lr.prefix):]
+		if lr.style == "" {
+			if num == "" {
+				return lr.first + 1
+			}
+			continue
+		}
+		v, ok := parsePageNumber(lr.style, num, fold)
+		if !ok || v < lr.start {
+			continue
+		}
+		if index := lr.first + v - lr.start; index < end {
+			return index + 1
+		}
+	}
+	return 0
+}
+
+// maxNumeral is the largest page number written in Roman numerals or
+// letters. Larger numbers are written in decimal, so that a bogus St entry
+// doesn't make enormous labels.
+const maxNumeral = 4999
+
+// formatPageNumber formats n in a page label numbering style.
+func formatPageNumber(style string, n int) string {
+	switch style {
+	case "D":
+		return strconv.Itoa(n)
+	case "R":
+		return roman(n)
+	case "r":
+		return strings.ToLower(roman(n))
+	case "A":
+		return letters(n)
+	case "a":
+		return strings.ToLower(letters(n))
+	}
+	return ""
+}
+
+// parsePageNumber is the inverse of formatPageNumber. If fold is true, it
+// ignores case. It reports false if s is not in the canonical form for its
+// value.
+func parsePageNumber(style, s string, fold bool) (n int, ok bool) {
+	orig := s
+	switch style {
+	case "D":
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return 0, false
+		}
+		return n, formatPageNumber(style, n) == s
+	case "R", "r":
+		n = parseRoman(strings.ToUpper(s))
+	case "A", "a":
+		s = strings.ToUpper(s)
+		if s != "" && s[0] >= 'A' && s[0] <= 'Z' && len(s) <= maxNumeral/26+1 {
+			n = (len(s)-1)*26 + int(s[0]-'A') + 1
+		}
+	default:
+		return 0, false
+	}
+	if n <= 0 {
+		// Numbers above maxNumeral are written in decimal.
+		if d, err := strconv.Atoi(orig); err == nil && d > maxNumeral {
+			return d, strconv.Itoa(d) == orig
+		}
+		return 0, false
+	}
+	if fold {
+		return n, strings.EqualFold(formatPageNumber(style, n), orig)
+	}
+	return n, formatPageNumber(style, n) == orig
+}
+
+var romanNumerals = []struct {
+	value  int
+	symbol string
+}{
+	{1000, "M"}, {900, "CM"}, {500, "D"}, {400, "CD"},
+	{100, "C"}, {90, "XC"}, {50, "L"}, {40, "XL"},
+	{10, "X"}, {9, "IX"}, {5, "V"}, {4, "IV"}, {1, "I"},
+}
+
+// roman returns n in upper-case Roman numerals. Numbers that can't be
+// written that way (zero and negative numbers), and numbers above
+// maxNumeral, are returned in decimal.
+func roman(n int) string {
+	if n <= 0 || n > maxNumeral {
+		return strconv.Itoa(n)
+	}
+	var b strings.Builder
+	for _, r := range romanNumerals {
+		for n >= r.value {
+			b.WriteString(r.symbol)
+			n -= r.value
+		}
+	}
+	return b.String()
+}
+
+// parseRoman returns the value of the upper-case Roman numeral s, or 0 if s
+// contains other characters. It doesn't check that s is in canonical form.
+func parseRoman(s string) int {
+	n := 0
+	for len(s) > 0 {
+		found := false
+		for _, r := range romanNumerals {
+			if strings.HasPrefix(s, r.symbol) {
+				n += r.value
+				s = s[len(r.symbol):]
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0
+		}
+	}
+	return n
+}
+
+// letters returns n in the alphabetic style of page labels: A to Z for 1 to
+// 26, AA to ZZ for 27 to 52, AAA to ZZZ for 53 to 78, and so on. Numbers
+// that are zero or negative, or above maxNumeral, are returned in decimal.
+func letters(n int) string {
+	if n <= 0 || n > maxNumeral {
+		return strconv.Itoa(n)
+	}
+	return strings.Repeat(string(rune('A'+(n-1)%26)), (n-1)/26+1)
+}
@@ -0,0 +1,107 @@
+package pdf
+
+import "testing"
+
+func TestFormatPageNumber(t *testing.T) {
+	for _, c := range []struct {
+		style string
+		n     int
+		want  string
+	}{
+		{"D", 12, "12"},
+		{"R", 4, "IV"},
+		{"R", 1994, "MCMXCIV"},
+		{"R", 4999, "MMMMCMXCIX"},
+		{"R", 5000, "5000"},
+		{"r", 9, "ix"},
+		{"R", 0, "0"},
+		{"A", 1, "A"},
+		{"A", 26, "Z"},
+		{"A", 27, "AA"},
+		{"a", 55, "ccc"},
+		{"A", 2000000000, "2000000000"},
+		{"", 3, ""},
+		{"X", 3, ""},
+	} {
+		if got := formatPageNumber(c.style, c.n); got != c.want {
+			t.Errorf("formatPageNumber(%q, %d) = %q, want %q", c.style, c.n, got, c.want)
+		}
+	}
+}
+
+func TestParsePageNumber(t *testing.T) {
+	for _, c := range []struct {
+		style, s string
+		fold     bool
+		n        int
+		ok       bool
+	}{
+		{"D", "12", false, 12, true},
+		{"D", "012", false, 12, false},
+		{"D", "0", false, 0, false},
+		{"R", "XIV", false, 14, true},
+		{"R", "IIII", false, 4, false}, // not canonical
+		{"R", "xiv", false, 14, false},
+		{"R", "xiv", true, 14, true},
+		{"r", "XIV", true, 14, true},
+		{"r", "XiV", true, 14, true},
+		{"R", "ABC", false, 0, false},
+		{"R", "5000", false, 5000, true},
+		{"R", "4000", false, 0, false},
+		{"A", "CC", false, 29, true},
+		{"A", "CD", false, 29, false},
+		{"a", "cc", false, 29, true},
+		{"a", "CC", false, 29, false},
+		{"a", "CC", true, 29, true},
+		{"A", "", false, 0, false},
+		{"A", "7000", false, 7000, true},
+		{"", "1", false, 0, false},
+	} {
+		n, ok := parsePageNumber(c.style, c.s, c.fold)
+		if ok != c.ok || ok && n != c.n {
+			t.Errorf("parsePageNumber(%q, %q, %v) = %d, %v; want %d, %v", c.style, c.s, c.fold, n, ok, c.n, c.ok)
+		}
+	}
+}
+
+func TestPageLabels(t *testing.T) {
+	r, _ := newTestReader(t, nil, func(w *Writer) Value {
+		return newCatalog(w, map[string]Value{
+			"PageLabels": NewDict(map[string]Value{
+				"Nums": NewArray(
+					NewInt(0), NewDict(map[string]Value{"S": NewName("r")}),
+					NewInt(3), NewDict(map[string]Value{"S": NewName("D")}),
+					NewInt(5), NewDict(map[string]Value{"S": NewName("A"), "P": NewTextString("App-"), "St": NewInt(2000000000)}),
+					NewInt(6), NewDict(map[string]Value{"P": NewTextString("Cover")}),
+				),
+			}),
+		}, make([]map[string]Value, 8)...)
+	})
+
+	want := []string{"i", "ii", "iii", "1", "2", "App-2000000000", "Cover", "Cover"}
+	for i, label := range want {
+		if got := r.PageLabel(i + 1); got != label {
+			t.Errorf("PageLabel(%d) = %q, want %q", i+1, got, label)
+		}
+	}
+	for _, c := range []struct {
+		label string
+		page  int
+	}{
+		{"ii", 2},
+		{"II", 2},
+		{"iiii", 0},
+		{"2", 5},
+		{"3", 0},
+		{"App-2000000000", 6},
+		{"Cover", 7},
+		{"", 0},
+	} {
+		if got := r.PageForLabel(c.label); got != c.page {
+			t.Errorf("PageForLabel(%q) = %d, want %d", c.label, got, c.page)
+		}
+	}
+	if !r.pageLabelsLoaded {
+		t.Error("page labels weren't cached")
+	}
+}
@@ -43,8 +43,7 @@ type buffer struct {
 	allowObjptr bool
 	allowStream bool
 	eof         bool
-	key         []byte
-	useAES      bool
+	crypt       *decrypter
 	objptr      objptr
 }
 
@@ -78,8 +77,34 @@ func (b *buffer) readByte() byte {
 	return c
 }
 
+// A syntaxError is the panic value used by buffer to abandon parsing
+// malformed input. It is recovered by catch, at the points where parsing
+// starts, and turned into an ordinary error.
+type syntaxError struct {
+	err error
+}
+
 func (b *buffer) errorf(format string, args ...interface{}) {
-	panic(fmt.Errorf(format, args...))
+	panic(syntaxError{fmt.Errorf(format, args...)})
+}
+
+// catch recovers from a panic caused by errorf, and stores the error in *err.
+// Other panics are passed through. It must be called directly by defer.
+func catch(err *error) {
+	if e := recover(); e != nil {
+		se, ok := e.(syntaxError)
+		if !ok {
+			panic(e)
+		}
+		*err = se.err
+	}
+}
+
+// tryReadObject is like readObject, but returns an error instead of
+// panicking if the input is malformed.
+func (b *buffer) tryReadObject() (obj object, err error) {
+	defer catch(&err)
+	return b.readObject(), nil
 }
 
 func (b *buffer) reload() bool {
@@ -190,6 +215,9 @@ func (b *buffer) readHexString() token {
 		if c == '>' {
 			break
 		}
+		if b.eof {
+			b.errorf("unexpected EOF in hex string")
+		}
 		if isSpace(c) {
 			goto Loop
 		}
@@ -227,6 +255,9 @@ func (b *buffer) readLiteralString() token {
 Loop:
 	for {
 		c := b.readByte()
+		if b.eof {
+			b.errorf("unexpected EOF in string")
+		}
 		switch c {
 		default:
 			tmp = append(tmp, c)
@@ -387,6 +418,10 @@ func isReal(s string) bool {
 //	objdef, a PDF object definition
 //
 // An object may also be nil, to represent the PDF null.
+//
+// Objects built in memory (see build.go) may also contain a Value, standing
+// for an object from another Reader, and a wref, a reference to an object in
+// a Writer.
 type object interface{}
 
 type dict map[name]object
@@ -397,6 +432,7 @@ type stream struct {
 	hdr    dict
 	ptr    objptr
 	offset int64
+	raw    []byte // the encoded data of a stream built in memory; nil for a stream in the file
 }
 
 type objptr struct {
@@ -424,8 +460,8 @@ func (b *buffer) readObject() object {
 		return nil
 	}
 
-	if str, ok := tok.(string); ok && b.key != nil && b.objptr.id != 0 {
-		tok = decryptString(b.key, b.useAES, b.objptr, str)
+	if str, ok := tok.(string); ok && b.crypt != nil && b.objptr.id != 0 {
+		tok = b.crypt.decryptString(b.objptr, str)
 	}
 
 	if !b.allowObjptr {
@@ -467,6 +503,9 @@ func (b *buffer) readArray() object {
 		if tok == nil || tok == keyword("]") {
 			break
 		}
+		if tok == io.EOF {
+			b.errorf("unexpected EOF parsing array")
+		}
 		b.unreadToken(tok)
 		x = append(x, b.readObject())
 	}
@@ -480,6 +519,9 @@ func (b *buffer) readDict() object {
 		if tok == nil || tok == keyword(">>") {
 			break
 		}
+		if tok == io.EOF {
+			b.errorf("unexpected EOF parsing dictionary")
+		}
 		n, ok := tok.(name)
 		if !ok {
 			b.errorf("unexpected non-name key %T(%v) parsing dictionary", tok, tok)
@@ -509,7 +551,7 @@ func (b *buffer) readDict() object {
 		b.errorf("stream keyword not followed by newline")
 	}
 
-	return stream{x, b.objptr, b.readOffset()}
+	return stream{hdr: x, ptr: b.objptr, offset: b.readOffset()}
 }
 
 func isSpace(b byte) bool {
@@ -0,0 +1,310 @@
+// Document metadata.
+
+package pdf
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DocumentInfo is the information in a document's information dictionary
+// (PDF 32000-1:2008, section 14.3.3). Fields that are missing from the
+// dictionary are empty.
+type DocumentInfo struct {
+	Title    string
+	Author   string
+	Subject  string
+	Keywords string
+	Creator  string // the application that created the original document
+	Producer string // the application that converted it to PDF
+
+	Created  time.Time
+	Modified time.Time
+
+	// Trapped is "True", "False" or "Unknown" (or empty if it isn't
+	// specified), telling whether the document has been modified to
+	// include trapping information.
+	Trapped string
+
+	// Custom holds the other text entries of the dictionary, which are
+	// defined by the application that wrote them.
+	Custom map[string]string
+}
+
+// Info returns the contents of the document information dictionary. Since
+// PDF 2.0, most of this information is supposed to be in the XMP metadata
+// instead (see XMP), but many files have both.
+func (r *Reader) Info() DocumentInfo {
+	v := r.Trailer().Key("Info")
+	info := DocumentInfo{Custom: make(map[string]string)}
+	for _, k := range v.Keys() {
+		e := v.Key(k)
+		switch k {
+		case "Title":
+			info.Title = e.Text()
+		case "Author":
+			info.Author = e.Text()
+		case "Subject":
+			info.Subject = e.Text()
+		case "Keywords":
+			info.Keywords = e.Text()
+		case "Creator":
+			info.Creator = e.Text()
+		case "Producer":
+			info.Producer = e.Text()
+		case "CreationDate":
+			info.Created, _ = parseDate(e.Text())
+		case "ModDate":
+			info.Modified, _ = parseDate(e.Text())
+		case "Trapped":
+			// Trapped is a name, but some files use a boolean or a string.
+			switch e.Kind() {
+			case Name:
+				info.Trapped = e.Name()
+			case Bool:
+				info.Trapped = "False"
+				if e.Bool() {
+					info.Trapped = "True"
+				}
+			case String:
+				info.Trapped = e.Text()
+			}
+		default:
+			if e.Kind() == String {
+				info.Custom[k] = e.Text()
+			}
+		}
+	}
+	return info
+}
+
+// XML namespaces used in XMP metadata.
+const (
+	NamespaceRDF    = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	NamespaceDC     = "http://purl.org/dc/elements/1.1/"
+	NamespaceXMP    = "http://ns.adobe.com/xap/1.0/"
+	NamespacePDF    = "http://ns.adobe.com/pdf/1.3/"
+	NamespacePDFAID = "http://www.aiim.org/pdfa/ns/id/"
+)
+
+// XMP is the XMP metadata of a document: properties in RDF/XML format,
+// grouped by namespace (see ISO 16684-1). The most common properties are
+// also available as fields.
+type XMP struct {
+	// Dublin Core properties. For properties that can be given in
+	// several languages, the default one is used.
+	Title       string
+	Creators    []string
+	Description string
+	Subjects    []string
+	Rights      string
+	Publishers  []string
+	Languages   []string
+	Format      string
+
+	// XMP basic and Adobe PDF properties.
+	CreatorTool string
+	Producer    string
+	Keywords    string
+	Created     time.Time
+	Modified    time.Time
+
+	// PDF/A identification: the part of ISO 19005 that the document
+	// conforms to (such as 1, 2 or 3), or zero if it doesn't claim to
+	// conform to PDF/A, and the conformance level (such as "A" or "B").
+	PDFAPart        int
+	PDFAConformance string
+
+	// Raw is the XMP packet.
+	Raw []byte
+
+	properties map[xml.Name][]string
+}
+
+// Property returns the values of the property with the given namespace URI
+// and local name, such as NamespaceDC and "creator". A simple property has
+// one value; an array (bag, sequence or alternatives) has one for each item;
+// for alternatives in several languages, the default one comes first.
+// Structured properties are not supported.
+func (x *XMP) Property(namespace, name string) []string {
+	return x.properties[xml.Name{Space: namespace, Local: name}]
+}
+
+// first returns the first value of a property, or the empty string.
+func (x *XMP) first(namespace, name string) string {
+	if v := x.Property(namespace, name); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// XMP returns the document's XMP metadata, from the Metadata stream of the
+// document catalog. It returns nil and no error if the document has no XMP
+// metadata.
+func (r *Reader) XMP() (*XMP, error) {
+	strm := r.Trailer().Key("Root").Key("Metadata")
+	if strm.Kind() != Stream {
+		return nil, strm.Err()
+	}
+	rd := strm.Reader()
+	defer rd.Close()
+	data, err := io.ReadAll(rd)
+	if err != nil {
+		return nil, fmt.Errorf("reading XMP metadata: %v", err)
+	}
+	return parseXMP(data)
+}
+
+// An xmlNode is an element of an XML document, for parsing documents whose
+// structure isn't known in advance.
+type xmlNode struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Nodes   []xmlNode  `xml:",any"`
+	Text    string     `xml:",chardata"`
+}
+
+// parseXMP parses an XMP packet.
+func parseXMP(data []byte) (*XMP, error) {
+	var root xmlNode
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("parsing XMP metadata: %v", err)
+	}
+	x := &XMP{
+		Raw:        data,
+		properties: make(map[xml.Name][]string),
+	}
+	x.collect(&root)
+
+	x.Title = x.first(NamespaceDC, "title")
+	x.Creators = x.Property(NamespaceDC, "creator")
+	x.Description = x.first(NamespaceDC, "description")
+	x.Subjects = x.Property(NamespaceDC, "subject")
+	x.Rights = x.first(NamespaceDC, "rights")
+	x.Publishers = x.Property(NamespaceDC, "publisher")
+	x.Languages = x.Property(NamespaceDC, "language")
+	x.Format = x.first(NamespaceDC, "format")
+
+	x.CreatorTool = x.first(NamespaceXMP, "CreatorTool")
+	x.Producer = x.first(NamespacePDF, "Producer")
+	x.Keywords = x.first(NamespacePDF, "Keywords")
+	x.Created, _ = parseXMPDate(x.first(NamespaceXMP, "CreateDate"))
+	x.Modified, _ = parseXMPDate(x.first(NamespaceXMP, "ModifyDate"))
+
+	x.PDFAPart, _ = strconv.Atoi(x.first(NamespacePDFAID, "part"))
+	x.PDFAConformance = x.first(NamespacePDFAID, "conformance")
+	return x, nil
+}
+
+// collect finds the rdf:Description elements in n and its descendants, and
+// records their properties.
+func (x *XMP) collect(n *xmlNode) {
+	if n.XMLName.Space != NamespaceRDF || n.XMLName.Local != "Description" {
+		for i := range n.Nodes {
+			x.collect(&n.Nodes[i])
+		}
+		return
+	}
+
+	// Simple properties may be written as attributes.
+	for _, a := range n.Attrs {
+		if isXMLMetaAttr(a.Name) {
+			continue
+		}
+		x.properties[a.Name] = append(x.properties[a.Name], a.Value)
+	}
+
+	for i := range n.Nodes {
+		prop := &n.Nodes[i]
+		if values, ok := containerItems(prop); ok {
+			x.properties[prop.XMLName] = append(x.properties[prop.XMLName], values...)
+			continue
+		}
+		if len(prop.Nodes) > 0 {
+			// A structured property; look for nested descriptions.
+			x.collect(prop)
+			continue
+		}
+		value := strings.TrimSpace(prop.Text)
+		for _, a := range prop.Attrs {
+			if a.Name.Space == NamespaceRDF && a.Name.Local == "resource" {
+				value = a.Value
+			}
+		}
+		x.properties[prop.XMLName] = append(x.properties[prop.XMLName], value)
+	}
+}
+
+// containerItems returns the items of an array property, which contains an
+// rdf:Bag, rdf:Seq or rdf:Alt element. For rdf:Alt, the item for the
+// x-default language is moved to the front.
+func containerItems(prop *xmlNode) ([]string, bool) {
+	if len(prop.Nodes) != 1 {
+		return nil, false
+	}
+	c := &prop.Nodes[0]
+	if c.XMLName.Space != NamespaceRDF {
+		return nil, false
+	}
+	switch c.XMLName.Local {
+	case "Bag", "Seq", "Alt":
+	default:
+		return nil, false
+	}
+	var items []string
+	for _, li := range c.Nodes {
+		if li.XMLName.Space != NamespaceRDF || li.XMLName.Local != "li" {
+			continue
+		}
+		item := strings.TrimSpace(li.Text)
+		isDefault := false
+		for _, a := range li.Attrs {
+			if a.Name.Local == "lang" && a.Value == "x-default" {
+				isDefault = true
+			}
+		}
+		if isDefault {
+			items = append([]string{item}, items...)
+		} else {
+			items = append(items, item)
+		}
+	}
+	return items, true
+}
+
+// isXMLMetaAttr reports whether an attribute is part of the XML or RDF
+// syntax, rather than a property.
+func isXMLMetaAttr(n xml.Name) bool {
+	switch {
+	case n.Space == "xmlns", n.Space == "" && n.Local == "xmlns":
+		return true
+	case n.Space == NamespaceRDF:
+		return true
+	case n.Space == "http://www.w3.org/XML/1998/namespace" || n.Space == "xml":
+		return true
+	}
+	return false
+}
+
+// parseXMPDate parses a date in the ISO 8601 format used by XMP, in which
+// the time, or parts of the date, may be left out.
+func parseXMPDate(s string) (time.Time, error) {
+	for _, layout := range []string{
+		"2006-01-02T15:04:05.999999999Z07:00",
+		"2006-01-02T15:04:05",
+		"2006-01-02T15:04Z07:00",
+		"2006-01-02T15:04",
+		"2006-01-02",
+		"2006-01",
+		"2006",
+	} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", s)
+}
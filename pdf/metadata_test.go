@@ -0,0 +1,143 @@
+package pdf
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+const testXMP = `<?xpacket begin="" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about=""
+    xmlns:xmp="http://ns.adobe.com/xap/1.0/"
+    xmlns:pdf="http://ns.adobe.com/pdf/1.3/"
+    xmp:CreatorTool="Writer 2.0"
+    xmp:CreateDate="2024-03-15T13:45:02+05:30"
+    pdf:Producer="Converter 1.1">
+   <xmp:ModifyDate>2024-03-16</xmp:ModifyDate>
+   <pdf:Keywords> alpha, beta </pdf:Keywords>
+  </rdf:Description>
+  <rdf:Description rdf:about="" xmlns:dc="http://purl.org/dc/elements/1.1/">
+   <dc:format>application/pdf</dc:format>
+   <dc:title>
+    <rdf:Alt>
+     <rdf:li xml:lang="de">Der Titel</rdf:li>
+     <rdf:li xml:lang="x-default">The Title</rdf:li>
+    </rdf:Alt>
+   </dc:title>
+   <dc:creator>
+    <rdf:Seq>
+     <rdf:li>First Author</rdf:li>
+     <rdf:li>Second Author</rdf:li>
+    </rdf:Seq>
+   </dc:creator>
+   <dc:subject>
+    <rdf:Bag><rdf:li>one</rdf:li><rdf:li>two</rdf:li></rdf:Bag>
+   </dc:subject>
+   <dc:source rdf:resource="http://example.com/source"/>
+  </rdf:Description>
+  <rdf:Description rdf:about="" xmlns:ex="http://example.com/ns/">
+   <ex:contact>
+    <rdf:Description ex:email="someone@example.com">
+     <ex:phone>555-0100</ex:phone>
+    </rdf:Description>
+   </ex:contact>
+  </rdf:Description>
+  <rdf:Description rdf:about="" xmlns:pdfaid="http://www.aiim.org/pdfa/ns/id/">
+   <pdfaid:part>2</pdfaid:part>
+   <pdfaid:conformance>B</pdfaid:conformance>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>`
+
+func TestParseXMP(t *testing.T) {
+	x, err := parseXMP([]byte(testXMP))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		name      string
+		got, want interface{}
+	}{
+		// Attributes
+		{"CreatorTool", x.CreatorTool, "Writer 2.0"},
+		{"Producer", x.Producer, "Converter 1.1"},
+		{"Created", x.Created.Equal(time.Date(2024, 3, 15, 8, 15, 2, 0, time.UTC)), true},
+		// Elements
+		{"Modified", x.Modified, time.Date(2024, 3, 16, 0, 0, 0, 0, time.UTC)},
+		{"Keywords", x.Keywords, "alpha, beta"},
+		{"Format", x.Format, "application/pdf"},
+		// x-default comes first, even though it isn't listed first.
+		{"Title", x.Title, "The Title"},
+		{"title", x.Property(NamespaceDC, "title"), []string{"The Title", "Der Titel"}},
+		{"Creators", x.Creators, []string{"First Author", "Second Author"}},
+		{"Subjects", x.Subjects, []string{"one", "two"}},
+		{"source", x.Property(NamespaceDC, "source"), []string{"http://example.com/source"}},
+		// Nested descriptions
+		{"email", x.Property("http://example.com/ns/", "email"), []string{"someone@example.com"}},
+		{"phone", x.Property("http://example.com/ns/", "phone"), []string{"555-0100"}},
+		{"PDFAPart", x.PDFAPart, 2},
+		{"PDFAConformance", x.PDFAConformance, "B"},
+		{"missing", x.Property(NamespaceDC, "rights"), []string(nil)},
+		{"about", x.Property(NamespaceRDF, "about"), []string(nil)},
+	} {
+		if !reflect.DeepEqual(c.got, c.want) {
+			t.Errorf("%s: got %q, want %q", c.name, c.got, c.want)
+		}
+	}
+
+	if _, err := parseXMP([]byte("<x:xmpmeta")); err == nil {
+		t.Error("no error for malformed XML")
+	}
+}
+
+func TestParseXMPDate(t *testing.T) {
+	for _, c := range []struct {
+		s    string
+		want time.Time
+		ok   bool
+	}{
+		{"2024-03-15T13:45:02.25Z", time.Date(2024, 3, 15, 13, 45, 2, 250000000, time.UTC), true},
+		{"2024-03-15T13:45:02-08:00", time.Date(2024, 3, 15, 21, 45, 2, 0, time.UTC), true},
+		{"2024-03-15T13:45:02", time.Date(2024, 3, 15, 13, 45, 2, 0, time.UTC), true},
+		{"2024-03-15T13:45+01:00", time.Date(2024, 3, 15, 12, 45, 0, 0, time.UTC), true},
+		{"2024-03-15T13:45", time.Date(2024, 3, 15, 13, 45, 0, 0, time.UTC), true},
+		{"2024-03-15", time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC), true},
+		{"2024-03", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), true},
+		{"2024", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), true},
+		{"", time.Time{}, false},
+		{"D:20240315", time.Time{}, false},
+		{"2024-13-01", time.Time{}, false},
+	} {
+		got, err := parseXMPDate(c.s)
+		if (err == nil) != c.ok || c.ok && !got.Equal(c.want) {
+			t.Errorf("parseXMPDate(%q) = %v, %v; want %v", c.s, got, err, c.want)
+		}
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	r, _ := newTestReader(t, nil, func(w *Writer) Value {
+		return newCatalog(w, map[string]Value{
+			"Metadata": w.Add(NewStream(NewDict(map[string]Value{
+				"Type":    NewName("Metadata"),
+				"Subtype": NewName("XML"),
+			}), []byte(testXMP))),
+		})
+	})
+	x, err := r.XMP()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x.Title != "The Title" || string(x.Raw) != testXMP {
+		t.Errorf("got title %q", x.Title)
+	}
+
+	// A file without metadata.
+	r, _ = newTestReader(t, nil, func(w *Writer) Value { return newPages(w) })
+	if x, err := r.XMP(); x != nil || err != nil {
+		t.Errorf("got %v, %v for a file without metadata", x, err)
+	}
+}
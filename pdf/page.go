@@ -5,7 +5,11 @@
 package pdf
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
 	"strings"
 )
 
@@ -48,6 +52,10 @@ Search:
 		}
 		break
 	}
+	if page.err != nil {
+		// The page tree couldn't be loaded; report why.
+		return Page{Value{r: r, err: page.err}}
+	}
 	return Page{}
 }
 
@@ -57,7 +65,10 @@ func (r *Reader) NumPage() int {
 }
 
 func (p Page) findInherited(key string) Value {
-	for v := p.V; !v.IsNull(); v = v.Key("Parent") {
+	// The depth limit guards against cycles in the page tree.
+	depth := 0
+	for v := p.V; !v.IsNull() && depth < maxPageTreeDepth; v = v.Key("Parent") {
+		depth++
 		if r := v.Key(key); !r.IsNull() {
 			return r
 		}
@@ -73,6 +84,137 @@ func (p Page) CropBox() Value {
 	return p.findInherited("CropBox")
 }
 
+// VisibleBox returns the region of the page that is meant to be displayed or
+// printed: the CropBox, clipped to the MediaBox. If the page has no CropBox,
+// it is the MediaBox; if it has no usable MediaBox either, it is US Letter
+// size. The coordinates are in default user space units.
+func (p Page) VisibleBox() Rect {
+	media, ok := rectValue(p.MediaBox())
+	if !ok {
+		media = Rect{Point{0, 0}, Point{612, 792}}
+	}
+	crop, ok := rectValue(p.CropBox())
+	if !ok {
+		return media
+	}
+	crop.Min.X = math.Max(crop.Min.X, media.Min.X)
+	crop.Min.Y = math.Max(crop.Min.Y, media.Min.Y)
+	crop.Max.X = math.Min(crop.Max.X, media.Max.X)
+	crop.Max.Y = math.Min(crop.Max.Y, media.Max.Y)
+	if crop.Min.X >= crop.Max.X || crop.Min.Y >= crop.Max.Y {
+		// A CropBox outside the MediaBox is an error; show the
+		// whole page instead of nothing.
+		return media
+	}
+	return crop
+}
+
+// UserUnit returns the size of the page's default user space unit, in
+// multiples of 1/72 inch. It is normally 1.
+func (p Page) UserUnit() float64 {
+	if u := p.V.Key("UserUnit").Float64(); u > 0 {
+		return u
+	}
+	return 1
+}
+
+// rectValue converts a rectangle array to a Rect, putting the corners in
+// order. It reports whether v was a valid, non-empty rectangle.
+func rectValue(v Value) (Rect, bool) {
+	if v.Kind() != Array || v.Len() != 4 {
+		return Rect{}, false
+	}
+	x1, y1 := v.Index(0).Float64(), v.Index(1).Float64()
+	x2, y2 := v.Index(2).Float64(), v.Index(3).Float64()
+	r := Rect{
+		Min: Point{math.Min(x1, x2), math.Min(y1, y2)},
+		Max: Point{math.Max(x1, x2), math.Max(y1, y2)},
+	}
+	if r.Min.X == r.Max.X || r.Min.Y == r.Max.Y {
+		return Rect{}, false
+	}
+	return r, true
+}
+
+// OutputIntents returns the array of output intents, which describe the
+// color characteristics of the devices the page was prepared for. A page may
+// have its own OutputIntents (since PDF 2.0); otherwise, those of the
+// document apply.
+func (p Page) OutputIntents() Value {
+	if oi := p.V.Key("OutputIntents"); oi.Kind() == Array {
+		return oi
+	}
+	if p.V.r == nil {
+		return Value{}
+	}
+	return p.V.r.Trailer().Key("Root").Key("OutputIntents")
+}
+
+// ContentReader returns the page's content stream. If the page's Contents
+// entry is an array of streams, they are read one after another, as if they
+// were a single stream; since the boundaries between the streams count as
+// whitespace, a newline is inserted between them. A page without Contents
+// is empty.
+func (p Page) ContentReader() io.ReadCloser {
+	contents := p.V.Key("Contents")
+	switch contents.Kind() {
+	case Null:
+		if err := contents.Err(); err != nil {
+			return &errorReadCloser{err}
+		}
+		return ioutil.NopCloser(strings.NewReader(""))
+	case Array:
+		return &contentsReader{contents: contents}
+	}
+	return contents.Reader()
+}
+
+// A contentsReader reads the streams in a Contents array in sequence.
+type contentsReader struct {
+	contents Value
+	next     int           // the index of the next stream
+	cur      io.ReadCloser // the stream being read, if any
+}
+
+func (c *contentsReader) Read(buf []byte) (int, error) {
+	for {
+		if c.cur == nil {
+			if c.next >= c.contents.Len() {
+				return 0, io.EOF
+			}
+			strm := c.contents.Index(c.next)
+			c.next++
+			if strm.Kind() == Null && strm.Err() == nil {
+				// A reference to a missing object; treat it as
+				// an empty stream.
+				continue
+			}
+			c.cur = strm.Reader()
+			if c.next > 1 && len(buf) > 0 {
+				buf[0] = '\n'
+				return 1, nil
+			}
+		}
+		n, err := c.cur.Read(buf)
+		if err == io.EOF {
+			c.cur.Close()
+			c.cur = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (c *contentsReader) Close() error {
+	if c.cur != nil {
+		return c.cur.Close()
+	}
+	return nil
+}
+
 // Resources returns the resources dictionary associated with the page.
 func (p Page) Resources() Value {
 	return p.findInherited("Resources")
@@ -130,81 +272,118 @@ func (f Font) Width(code int) float64 {
 	return f.V.Key("Widths").Index(code - first).Float64()
 }
 
+// widthFunc returns a function that gives the widths of the characters
+// shown with f, in thousandths of text space units. For composite fonts, the
+// widths come from the descendant font's W and DW entries.
+func (f Font) widthFunc() func(c charCode) float64 {
+	if f.V.Key("Subtype").Name() != "Type0" {
+		return func(c charCode) float64 { return f.Width(int(c.code)) }
+	}
+
+	descendant := f.V.Key("DescendantFonts").Index(0)
+	dw := 1000.0
+	if v := descendant.Key("DW"); !v.IsNull() {
+		dw = v.Float64()
+	}
+	widths := make(map[int]float64)
+	w := descendant.Key("W")
+	for i := 0; i < w.Len(); {
+		first := w.Index(i).Int()
+		next := w.Index(i + 1)
+		if next.Kind() == Array {
+			for j := 0; j < next.Len(); j++ {
+				widths[first+j] = next.Index(j).Float64()
+			}
+			i += 2
+			continue
+		}
+		for cid := first; cid <= next.Int(); cid++ {
+			widths[cid] = w.Index(i + 2).Float64()
+		}
+		i += 3
+	}
+
+	return func(c charCode) float64 {
+		if w, ok := widths[c.cid]; ok {
+			return w
+		}
+		return dw
+	}
+}
+
 // Encoder returns the encoding between font code point sequences and UTF-8.
+// The font's ToUnicode CMap is used if it has one. Otherwise the text is
+// derived from the font's encoding and glyph names, or, for composite fonts,
+// from the font's CMap or the character map of its embedded TrueType font.
 func (f Font) Encoder() TextEncoding {
+	var toUnicode *cmap
+	if tu := f.V.Key("ToUnicode"); tu.Kind() == Stream {
+		toUnicode = readCmap(tu, make(map[objptr]bool))
+	}
+
+	if f.V.Key("Subtype").Name() == "Type0" {
+		return f.cidEncoder(toUnicode)
+	}
+
+	e := &byteEncoder{table: &pdfDocEncoding, toUnicode: toUnicode}
 	enc := f.V.Key("Encoding")
 	switch enc.Kind() {
 	case Name:
-		switch enc.Name() {
-		case "WinAnsiEncoding":
-			return &byteEncoder{&WinAnsiEncoding}
-		case "MacRomanEncoding":
-			return &byteEncoder{&MacRomanEncoding}
-		case "Identity-H":
-			// TODO: Should be big-endian UCS-2 decoder
-			return &nopEncoder{}
-		default:
+		if table := encodingTable(enc.Name()); table != nil {
+			e.table = table
+		} else {
 			println("unknown encoding", enc.Name())
-			return &nopEncoder{}
 		}
 	case Dict:
-		return &dictEncoder{enc.Key("Differences")}
+		e.table = differencesTable(enc)
 	case Null:
-		// ok, try ToUnicode
+		// ok
 	default:
 		println("unexpected encoding", enc.String())
-		return &nopEncoder{}
 	}
+	return e
+}
 
-	toUnicode := f.V.Key("ToUnicode")
-	if toUnicode.Kind() == Dict {
-		m := readCmap(toUnicode)
-		if m == nil {
-			return &nopEncoder{}
-		}
-		return m
-	}
+// A TextEncoding represents a mapping between
+// font code points and UTF-8 text.
+type TextEncoding interface {
+	// Decode returns the UTF-8 text corresponding to
+	// the sequence of code points in raw.
+	Decode(raw string) (text string)
+}
 
-	return &byteEncoder{&pdfDocEncoding}
+// A charCode is a single character code from a string shown with a font.
+type charCode struct {
+	code uint32
+	n    int    // the length of the code in bytes
+	cid  int    // the CID, for composite fonts
+	text string // the corresponding UTF-8 text
 }
 
-type dictEncoder struct {
-	v Value
+// A charDecoder is a TextEncoding that can split a string into individual
+// character codes.
+type charDecoder interface {
+	decodeChars(raw string) []charCode
 }
 
-func (e *dictEncoder) Decode(raw string) (text string) {
-	r := make([]rune, 0, len(raw))
-	for i := 0; i < len(raw); i++ {
-		ch := rune(raw[i])
-		n := -1
-		for j := 0; j < e.v.Len(); j++ {
-			x := e.v.Index(j)
-			if x.Kind() == Integer {
-				n = int(x.Int64())
-				continue
-			}
-			if x.Kind() == Name {
-				if int(raw[i]) == n {
-					r := nameToRune[x.Name()]
-					if r != 0 {
-						ch = r
-						break
-					}
-				}
-				n++
-			}
-		}
-		r = append(r, ch)
+// decodeChars splits raw into character codes with their text, using enc.
+func decodeChars(enc TextEncoding, raw string) []charCode {
+	if d, ok := enc.(charDecoder); ok {
+		return d.decodeChars(raw)
 	}
-	return string(r)
+	chars := make([]charCode, len(raw))
+	for i := range chars {
+		chars[i] = charCode{code: uint32(raw[i]), n: 1, cid: int(raw[i]), text: enc.Decode(raw[i : i+1])}
+	}
+	return chars
 }
 
-// A TextEncoding represents a mapping between
-// font code points and UTF-8 text.
-type TextEncoding interface {
-	// Decode returns the UTF-8 text corresponding to
-	// the sequence of code points in raw.
-	Decode(raw string) (text string)
+func joinText(chars []charCode) string {
+	var b strings.Builder
+	for _, c := range chars {
+		b.WriteString(c.text)
+	}
+	return b.String()
 }
 
 type nopEncoder struct {
@@ -214,64 +393,141 @@ func (e *nopEncoder) Decode(raw string) (text string) {
 	return raw
 }
 
+// A byteEncoder is the encoding for a simple font, with single-byte codes.
+// The ToUnicode CMap takes precedence over the table, if it is present.
 type byteEncoder struct {
-	table *[256]rune
+	table     *[256]rune
+	toUnicode *cmap
 }
 
 func (e *byteEncoder) Decode(raw string) (text string) {
-	r := make([]rune, 0, len(raw))
-	for i := 0; i < len(raw); i++ {
-		r = append(r, e.table[raw[i]])
+	return joinText(e.decodeChars(raw))
+}
+
+func (e *byteEncoder) decodeChars(raw string) []charCode {
+	chars := make([]charCode, len(raw))
+	for i := range chars {
+		c := charCode{code: uint32(raw[i]), n: 1, cid: int(raw[i])}
+		if s, ok := e.toUnicode.lookup(raw[i : i+1]); ok {
+			c.text = s
+		} else {
+			c.text = string(e.table[raw[i]])
+		}
+		chars[i] = c
 	}
-	return string(r)
+	return chars
 }
 
+// A cmap is a ToUnicode CMap, mapping character codes to Unicode text.
 type cmap struct {
 	space   [4][][2]string
 	bfrange []bfrange
+	parent  *cmap // from usecmap
+
+	// table maps codes to text directly, for the predefined CID-to-Unicode
+	// CMaps (see predefinedToUnicode).
+	table map[uint32]string
 }
 
-func (m *cmap) Decode(raw string) (text string) {
-	var r []rune
-Parse:
-	for len(raw) > 0 {
+// codeLength returns the length of the first character code in raw,
+// according to m's codespace ranges, or 0 if there is no matching range.
+func (m *cmap) codeLength(raw string) int {
+	for c := m; c != nil; c = c.parent {
 		for n := 1; n <= 4 && n <= len(raw); n++ {
-			for _, space := range m.space[n-1] {
+			for _, space := range c.space[n-1] {
 				if space[0] <= raw[:n] && raw[:n] <= space[1] {
-					text := raw[:n]
-					raw = raw[n:]
-					for _, bf := range m.bfrange {
-						if len(bf.lo) == n && bf.lo <= text && text <= bf.hi {
-							if bf.dst.Kind() == String {
-								s := bf.dst.RawString()
-								if bf.lo != text {
-									b := []byte(s)
-									b[len(b)-1] += text[len(text)-1] - bf.lo[len(bf.lo)-1]
-									s = string(b)
-								}
-								r = append(r, []rune(utf16Decode(s))...)
-								continue Parse
-							}
-							if bf.dst.Kind() == Array {
-								fmt.Printf("array %v\n", bf.dst)
-							} else {
-								fmt.Printf("unknown dst %v\n", bf.dst)
-							}
-							r = append(r, noRune)
-							continue Parse
-						}
-					}
-					fmt.Printf("no text for %q", text)
-					r = append(r, noRune)
-					continue Parse
+					return n
+				}
+			}
+		}
+	}
+	return 0
+}
+
+// lookup returns the text for the character code in code.
+func (m *cmap) lookup(code string) (text string, ok bool) {
+	for c := m; c != nil; c = c.parent {
+		if s, ok := c.table[codeValue(code)]; ok && len(code) == 2 {
+			return s, true
+		}
+		// Search backward, since later mappings override earlier ones.
+		for i := len(c.bfrange) - 1; i >= 0; i-- {
+			bf := c.bfrange[i]
+			if len(bf.lo) != len(code) || code < bf.lo || bf.hi < code {
+				continue
+			}
+			offset := codeValue(code) - codeValue(bf.lo)
+			switch bf.dst.Kind() {
+			case String:
+				s := bf.dst.RawString()
+				if offset != 0 {
+					s = incrementUTF16(s, offset)
 				}
+				return utf16Decode(s), true
+			case Array:
+				dst := bf.dst.Index(int(offset))
+				if dst.Kind() == Name {
+					return string(glyphRune(dst.Name())), true
+				}
+				return utf16Decode(dst.RawString()), true
+			case Name:
+				// bfchar mapping to a glyph name
+				return string(glyphRune(bf.dst.Name())), true
 			}
+			return "", false
+		}
+	}
+	return "", false
+}
+
+func (m *cmap) Decode(raw string) (text string) {
+	return joinText(m.decodeChars(raw))
+}
+
+func (m *cmap) decodeChars(raw string) []charCode {
+	var chars []charCode
+	for len(raw) > 0 {
+		n := m.codeLength(raw)
+		if n == 0 {
+			n = 1
 		}
-		println("no code space found")
-		r = append(r, noRune)
-		raw = raw[1:]
+		c := charCode{code: codeValue(raw[:n]), n: n}
+		c.cid = int(c.code)
+		if s, ok := m.lookup(raw[:n]); ok {
+			c.text = s
+		} else {
+			c.text = string(noRune)
+		}
+		chars = append(chars, c)
+		raw = raw[n:]
+	}
+	return chars
+}
+
+// codeValue returns the numeric value of a big-endian character code.
+func codeValue(code string) uint32 {
+	var x uint32
+	for i := 0; i < len(code); i++ {
+		x = x<<8 | uint32(code[i])
+	}
+	return x
+}
+
+// incrementUTF16 adds offset to the last UTF-16 code unit in s, as is done
+// for the destinations of bfrange mappings.
+func incrementUTF16(s string, offset uint32) string {
+	b := []byte(s)
+	if len(b) < 2 {
+		if len(b) == 1 {
+			b[0] += byte(offset)
+		}
+		return string(b)
 	}
-	return string(r)
+	u := uint32(b[len(b)-2])<<8 | uint32(b[len(b)-1])
+	u += offset
+	b[len(b)-2] = byte(u >> 8)
+	b[len(b)-1] = byte(u)
+	return string(b)
 }
 
 type bfrange struct {
@@ -280,65 +536,137 @@ type bfrange struct {
 	dst Value
 }
 
-func readCmap(toUnicode Value) *cmap {
+// readCmap reads a ToUnicode CMap. seen holds the CMap streams that are
+// already being read, to detect UseCMap cycles.
+func readCmap(toUnicode Value, seen map[objptr]bool) *cmap {
 	n := -1
 	var m cmap
 	ok := true
+	fail := func(err error) {
+		toUnicode.r.reportError(fmt.Errorf("reading ToUnicode CMap: %v", err))
+		ok = false
+	}
+	if seen[toUnicode.ptr] {
+		fail(errors.New("UseCMap cycle"))
+		return nil
+	}
+	seen[toUnicode.ptr] = true
 	Interpret(toUnicode, func(stk *Stack, op string) {
 		if !ok {
 			return
 		}
 		switch op {
 		case "findresource":
-			category := stk.Pop()
-			key := stk.Pop()
-			fmt.Println("findresource", key, category)
+			stk.Pop()
+			stk.Pop()
 			stk.Push(newDict())
 		case "begincmap":
 			stk.Push(newDict())
 		case "endcmap":
 			stk.Pop()
-		case "begincodespacerange":
+		case "begincodespacerange", "beginbfrange", "beginbfchar":
 			n = int(stk.Pop().Int64())
+			if n < 0 {
+				fail(fmt.Errorf("bad count for %s: %d", op, n))
+			}
 		case "endcodespacerange":
 			if n < 0 {
-				println("missing begincodespacerange")
-				ok = false
+				fail(errors.New("missing begincodespacerange"))
+				return
+			}
+			if n > stk.Len()/2 {
+				fail(fmt.Errorf("codespace range count %d, but only %d operands", n, stk.Len()))
 				return
 			}
 			for i := 0; i < n; i++ {
 				hi, lo := stk.Pop().RawString(), stk.Pop().RawString()
-				if len(lo) == 0 || len(lo) != len(hi) {
-					println("bad codespace range")
-					ok = false
+				if len(lo) == 0 || len(lo) > 4 || len(lo) != len(hi) {
+					fail(errors.New("bad codespace range"))
 					return
 				}
 				m.space[len(lo)-1] = append(m.space[len(lo)-1], [2]string{lo, hi})
 			}
 			n = -1
-		case "beginbfrange":
-			n = int(stk.Pop().Int64())
 		case "endbfrange":
 			if n < 0 {
-				panic("missing beginbfrange")
+				fail(errors.New("missing beginbfrange"))
+				return
 			}
-			for i := 0; i < n; i++ {
+			if n > stk.Len()/3 {
+				fail(fmt.Errorf("bfrange count %d, but only %d operands", n, stk.Len()))
+				return
+			}
+			ranges := make([]bfrange, n)
+			for i := n - 1; i >= 0; i-- {
 				dst, srcHi, srcLo := stk.Pop(), stk.Pop().RawString(), stk.Pop().RawString()
-				m.bfrange = append(m.bfrange, bfrange{srcLo, srcHi, dst})
+				ranges[i] = bfrange{srcLo, srcHi, dst}
+			}
+			m.bfrange = append(m.bfrange, ranges...)
+			n = -1
+		case "endbfchar":
+			if n < 0 {
+				fail(errors.New("missing beginbfchar"))
+				return
+			}
+			if n > stk.Len()/2 {
+				fail(fmt.Errorf("bfchar count %d, but only %d operands", n, stk.Len()))
+				return
+			}
+			ranges := make([]bfrange, n)
+			for i := n - 1; i >= 0; i-- {
+				dst, src := stk.Pop(), stk.Pop().RawString()
+				ranges[i] = bfrange{src, src, dst}
+			}
+			m.bfrange = append(m.bfrange, ranges...)
+			n = -1
+		case "usecmap":
+			if name := stk.Pop().Name(); name != "" {
+				parent, err := predefinedToUnicode(name)
+				if err != nil {
+					toUnicode.r.reportError(fmt.Errorf("reading ToUnicode CMap: %v", err))
+				}
+				m.parent = parent
 			}
 		case "defineresource":
-			category := stk.Pop().Name()
+			stk.Pop()
 			value := stk.Pop()
-			key := stk.Pop().Name()
-			fmt.Println("defineresource", key, value, category)
+			stk.Pop()
 			stk.Push(value)
-		default:
-			println("interp\t", op)
 		}
 	})
 	if !ok {
 		return nil
 	}
+
+	// A UseCMap entry in the stream dictionary replaces a parent named
+	// with the usecmap operator, unless it can't be loaded.
+	switch parent := toUnicode.Key("UseCMap"); parent.Kind() {
+	case Stream:
+		if p := readCmap(parent, seen); p != nil {
+			m.parent = p
+		}
+	case Name:
+		p, err := predefinedToUnicode(parent.Name())
+		if err != nil {
+			toUnicode.r.reportError(fmt.Errorf("reading ToUnicode CMap: %v", err))
+		} else {
+			m.parent = p
+		}
+	}
+
+	// Some ToUnicode CMaps omit the codespace ranges. Infer them from the
+	// lengths of the codes that are mapped.
+	hasSpace := false
+	for _, space := range m.space {
+		hasSpace = hasSpace || len(space) > 0
+	}
+	if !hasSpace && m.parent == nil {
+		for _, bf := range m.bfrange {
+			if n := len(bf.lo); n >= 1 && n <= 4 && len(m.space[n-1]) == 0 {
+				m.space[n-1] = [][2]string{{strings.Repeat("\x00", n), strings.Repeat("\xff", n)}}
+			}
+		}
+	}
 	return &m
 }
 
@@ -401,8 +729,17 @@ type gstate struct {
 }
 
 // Content returns the page's content.
+//
+// The text is returned as individual characters with minimal layout
+// information; the giopdf package's ExtractText function groups text into
+// words, lines, and blocks.
+//
+// If the content stream is malformed, Content returns the content before
+// the error, and reports the error to the Reader's error handler (see
+// SetErrorHandler).
 func (p Page) Content() Content {
-	strm := p.V.Key("Contents")
+	strm := p.ContentReader()
+	defer strm.Close()
 	var enc TextEncoding = &nopEncoder{}
 
 	var g = gstate{
@@ -411,21 +748,21 @@ func (p Page) Content() Content {
 	}
 
 	var text []Text
+	width := func(c charCode) float64 { return 0 }
 	showText := func(s string) {
-		n := 0
-		for _, ch := range enc.Decode(s) {
+		for _, c := range decodeChars(enc, s) {
 			Trm := matrix{{g.Tfs * g.Th, 0, 0}, {0, g.Tfs, 0}, {0, g.Trise, 1}}.mul(g.Tm).mul(g.CTM)
-			w0 := g.Tf.Width(int(s[n]))
-			n++
-			if ch != ' ' {
+			w0 := width(c)
+			if c.text != " " {
 				f := g.Tf.BaseFont()
 				if i := strings.Index(f, "+"); i >= 0 {
 					f = f[i+1:]
 				}
-				text = append(text, Text{f, Trm[0][0], Trm[2][0], Trm[2][1], w0 / 1000 * Trm[0][0], string(ch)})
+				text = append(text, Text{f, Trm[0][0], Trm[2][0], Trm[2][1], w0 / 1000 * Trm[0][0], c.text})
 			}
 			tx := w0/1000*g.Tfs + g.Tc
-			if ch == ' ' {
+			// Word spacing applies to the single-byte code 32.
+			if c.n == 1 && c.code == ' ' {
 				tx += g.Tw
 			}
 			tx *= g.Th
@@ -435,7 +772,7 @@ func (p Page) Content() Content {
 
 	var rect []Rect
 	var gstack []gstate
-	Interpret(strm, func(stk *Stack, op string) {
+	err := interpret(strm, func(stk *Stack, op string) {
 		n := stk.Len()
 		args := make([]Value, n)
 		for i := n - 1; i >= 0; i-- {
@@ -448,7 +785,7 @@ func (p Page) Content() Content {
 
 		case "cm": // update g.CTM
 			if len(args) != 6 {
-				panic("bad g.Tm")
+				return
 			}
 			var m matrix
 			for i := 0; i < 6; i++ {
@@ -458,6 +795,9 @@ func (p Page) Content() Content {
 			g.CTM = m.mul(g.CTM)
 
 		case "gs": // set parameters from graphics state resource
+			if len(args) != 1 {
+				return
+			}
 			gs := p.Resources().Key("ExtGState").Key(args[0].Name())
 			font := gs.Key("Font")
 			if font.Kind() == Array && font.Len() == 2 {
@@ -474,7 +814,7 @@ func (p Page) Content() Content {
 
 		case "re": // append rectangle to path
 			if len(args) != 4 {
-				panic("bad re")
+				return
 			}
 			x, y, w, h := args[0].Float64(), args[1].Float64(), args[2].Float64(), args[3].Float64()
 			rect = append(rect, Rect{Point{x, y}, Point{x + w, y + h}})
@@ -484,6 +824,9 @@ func (p Page) Content() Content {
 
 		case "Q": // restore graphics state
 			n := len(gstack) - 1
+			if n < 0 {
+				return
+			}
 			g = gstack[n]
 			gstack = gstack[:n]
 
@@ -500,19 +843,19 @@ func (p Page) Content() Content {
 
 		case "Tc": // set character spacing
 			if len(args) != 1 {
-				panic("bad g.Tc")
+				return
 			}
 			g.Tc = args[0].Float64()
 
 		case "TD": // move text position and set leading
 			if len(args) != 2 {
-				panic("bad Td")
+				return
 			}
 			g.Tl = -args[1].Float64()
 			fallthrough
 		case "Td": // move text position
 			if len(args) != 2 {
-				panic("bad Td")
+				return
 			}
 			tx := args[0].Float64()
 			ty := args[1].Float64()
@@ -522,20 +865,17 @@ func (p Page) Content() Content {
 
 		case "Tf": // set text font and size
 			if len(args) != 2 {
-				panic("bad TL")
+				return
 			}
 			f := args[0].Name()
 			g.Tf = p.Font(f)
 			enc = g.Tf.Encoder()
-			if enc == nil {
-				println("no cmap for", f)
-				enc = &nopEncoder{}
-			}
+			width = g.Tf.widthFunc()
 			g.Tfs = args[1].Float64()
 
 		case "\"": // set spacing, move to next line, and show text
 			if len(args) != 3 {
-				panic("bad \" operator")
+				return
 			}
 			g.Tw = args[0].Float64()
 			g.Tc = args[1].Float64()
@@ -543,7 +883,7 @@ func (p Page) Content() Content {
 			fallthrough
 		case "'": // move to next line and show text
 			if len(args) != 1 {
-				panic("bad ' operator")
+				return
 			}
 			x := matrix{{1, 0, 0}, {0, 1, 0}, {0, -g.Tl, 1}}
 			g.Tlm = x.mul(g.Tlm)
@@ -551,11 +891,14 @@ func (p Page) Content() Content {
 			fallthrough
 		case "Tj": // show text
 			if len(args) != 1 {
-				panic("bad Tj operator")
+				return
 			}
 			showText(args[0].RawString())
 
 		case "TJ": // show text, allowing individual glyph positioning
+			if len(args) != 1 {
+				return
+			}
 			v := args[0]
 			for i := 0; i < v.Len(); i++ {
 				x := v.Index(i)
@@ -569,13 +912,13 @@ func (p Page) Content() Content {
 
 		case "TL": // set text leading
 			if len(args) != 1 {
-				panic("bad TL")
+				return
 			}
 			g.Tl = args[0].Float64()
 
 		case "Tm": // set text matrix and line matrix
 			if len(args) != 6 {
-				panic("bad g.Tm")
+				return
 			}
 			var m matrix
 			for i := 0; i < 6; i++ {
@@ -587,29 +930,32 @@ func (p Page) Content() Content {
 
 		case "Tr": // set text rendering mode
 			if len(args) != 1 {
-				panic("bad Tr")
+				return
 			}
 			g.Tmode = int(args[0].Int64())
 
 		case "Ts": // set text rise
 			if len(args) != 1 {
-				panic("bad Ts")
+				return
 			}
 			g.Trise = args[0].Float64()
 
 		case "Tw": // set word spacing
 			if len(args) != 1 {
-				panic("bad g.Tw")
+				return
 			}
 			g.Tw = args[0].Float64()
 
 		case "Tz": // set horizontal text scaling
 			if len(args) != 1 {
-				panic("bad Tz")
+				return
 			}
 			g.Th = args[0].Float64() / 100
 		}
 	})
+	if err != nil {
+		p.V.r.reportError(fmt.Errorf("reading page content: %v", err))
+	}
 	return Content{text, rect}
 }
 
@@ -646,20 +992,60 @@ func (x TextHorizontal) Less(i, j int) bool {
 type Outline struct {
 	Title string    // title for this element
 	Child []Outline // child elements
+
+	// Action is what happens when the element is chosen; usually it is a
+	// GoTo action, whose Dest is the place in the document to go to. It is
+	// nil if the element has no action.
+	Action *Action
+
+	Open   bool       // whether the element's children are shown
+	Color  [3]float64 // the RGB color of the title
+	Italic bool       // whether the title is shown in italics
+	Bold   bool       // whether the title is shown in bold
 }
 
 // Outline returns the document outline.
 // The Outline returned is the root of the outline tree and typically has no Title itself.
 // That is, the children of the returned root are the top-level entries in the outline.
 func (r *Reader) Outline() Outline {
-	return buildOutline(r.Trailer().Key("Root").Key("Outlines"))
+	d := newDestResolver(r)
+	seen := make(map[objptr]bool)
+	return buildOutline(r.Trailer().Key("Root").Key("Outlines"), d, seen, 0)
 }
 
-func buildOutline(entry Value) Outline {
+func buildOutline(entry Value, d *destResolver, seen map[objptr]bool, depth int) Outline {
 	var x Outline
 	x.Title = entry.Key("Title").Text()
+	if a := entry.Key("A"); a.Kind() == Dict {
+		act := d.action(a)
+		x.Action = &act
+	} else if dest := entry.Key("Dest"); !dest.IsNull() {
+		x.Action = &Action{Type: "GoTo", Dest: d.dest(dest)}
+	}
+	// A positive Count is the number of visible descendants of an open
+	// element; a negative one is for a closed element.
+	x.Open = entry.Key("Count").Int() > 0
+	if c := entry.Key("C"); c.Len() == 3 {
+		for i := range x.Color {
+			x.Color[i] = c.Index(i).Float64()
+		}
+	}
+	flags := entry.Key("F").Int()
+	x.Italic = flags&1 != 0
+	x.Bold = flags&2 != 0
+
+	if depth >= maxPageTreeDepth {
+		return x
+	}
 	for child := entry.Key("First"); child.Kind() == Dict; child = child.Key("Next") {
-		x.Child = append(x.Child, buildOutline(child))
+		// The links between elements may form a cycle in a damaged file.
+		if child.indirect {
+			if seen[child.ptr] {
+				break
+			}
+			seen[child.ptr] = true
+		}
+		x.Child = append(x.Child, buildOutline(child, d, seen, depth+1))
 	}
 	return x
 }
@@ -0,0 +1,78 @@
+package pdf
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestContentError(t *testing.T) {
+	r, _ := newTestReader(t, nil, func(w *Writer) Value {
+		return newPages(w, map[string]Value{
+			"Contents": w.Add(NewStream(NewDict(nil), []byte("BT 72 720 Td (Hello) Tj ET\nBT <4g> Tj (World) Tj ET\n"))),
+		})
+	})
+	var errs []error
+	r.SetErrorHandler(func(err error) { errs = append(errs, err) })
+
+	c := r.Page(1).Content()
+	var text []string
+	for _, t := range c.Text {
+		text = append(text, t.S)
+	}
+	if got := strings.Join(text, ""); got != "Hello" {
+		t.Errorf("got text %q, want the text before the error", got)
+	}
+	if len(errs) != 1 {
+		t.Errorf("got errors %v, want one", errs)
+	}
+}
+
+func TestContentsArray(t *testing.T) {
+	r, _ := newTestReader(t, nil, func(w *Writer) Value {
+		stream := func(s string) Value {
+			return w.Add(NewStream(NewDict(nil), []byte(s)))
+		}
+		missing := w.Alloc()
+		w.Set(missing, Value{})
+		return newPages(w,
+			map[string]Value{"Contents": NewArray(
+				stream("BT 72 720 Td (Hel"),
+				missing,
+				stream("lo) Tj (World) T"),
+				stream("j ET"),
+			)},
+			map[string]Value{"Contents": NewArray()},
+		)
+	})
+
+	rd := r.Page(1).ContentReader()
+	data, err := io.ReadAll(iotest.OneByteReader(rd))
+	rd.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The boundaries between the streams separate tokens.
+	if want := "BT 72 720 Td (Hel\nlo) Tj (World) T\nj ET"; string(data) != want {
+		t.Errorf("got content %q, want %q", data, want)
+	}
+
+	// The string continues across the boundary, with the newline in it,
+	// but T and j are separate operators, not Tj.
+	c := r.Page(1).Content()
+	var text []string
+	for _, t := range c.Text {
+		text = append(text, t.S)
+	}
+	if got := strings.Join(text, ""); got != "Hel\nlo" {
+		t.Errorf("got text %q, want %q", got, "Hel\nlo")
+	}
+
+	rd = r.Page(2).ContentReader()
+	data, err = io.ReadAll(rd)
+	rd.Close()
+	if err != nil || len(data) != 0 {
+		t.Errorf("empty Contents array: got %q, %v", data, err)
+	}
+}
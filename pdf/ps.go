@@ -5,6 +5,7 @@
 package pdf
 
 import (
+	"errors"
 	"fmt"
 	"io"
 )
@@ -34,7 +35,7 @@ func (stk *Stack) Pop() Value {
 }
 
 func newDict() Value {
-	return Value{nil, objptr{}, make(dict)}
+	return Value{data: make(dict)}
 }
 
 // Interpret interprets the content in a stream as a basic PostScript program,
@@ -51,8 +52,17 @@ func newDict() Value {
 //
 // There is no support for executable blocks, among other limitations.
 //
-func Interpret(strm Value, do func(stk *Stack, op string)) {
+// Interpret returns an error if the stream can't be read or is malformed.
+// The operators before the error will already have been executed.
+func Interpret(strm Value, do func(stk *Stack, op string)) (err error) {
 	rd := strm.Reader()
+	defer rd.Close()
+	return interpret(rd, do)
+}
+
+// interpret is Interpret, reading the program from rd.
+func interpret(rd io.Reader, do func(stk *Stack, op string)) (err error) {
+	defer catch(&err)
 	b := newBuffer(rd, 0)
 	b.allowEOF = true
 	b.allowObjptr = false
@@ -72,7 +82,7 @@ Reading:
 			default:
 				for i := len(dicts) - 1; i >= 0; i-- {
 					if v, ok := dicts[i][name(kw)]; ok {
-						stk.Push(Value{nil, objptr{}, v})
+						stk.Push(Value{data: v})
 						continue Reading
 					}
 				}
@@ -80,35 +90,35 @@ Reading:
 				continue
 			case "dict":
 				stk.Pop()
-				stk.Push(Value{nil, objptr{}, make(dict)})
+				stk.Push(Value{data: make(dict)})
 				continue
 			case "currentdict":
 				if len(dicts) == 0 {
-					panic("no current dictionary")
+					return errors.New("no current dictionary")
 				}
-				stk.Push(Value{nil, objptr{}, dicts[len(dicts)-1]})
+				stk.Push(Value{data: dicts[len(dicts)-1]})
 				continue
 			case "begin":
 				d := stk.Pop()
 				if d.Kind() != Dict {
-					panic("cannot begin non-dict")
+					return errors.New("cannot begin non-dict")
 				}
 				dicts = append(dicts, d.data.(dict))
 				continue
 			case "end":
 				if len(dicts) <= 0 {
-					panic("mismatched begin/end")
+					return errors.New("mismatched begin/end")
 				}
 				dicts = dicts[:len(dicts)-1]
 				continue
 			case "def":
 				if len(dicts) <= 0 {
-					panic("def without open dict")
+					return errors.New("def without open dict")
 				}
 				val := stk.Pop()
 				key, ok := stk.Pop().data.(name)
 				if !ok {
-					panic("def of non-name")
+					return errors.New("def of non-name")
 				}
 				dicts[len(dicts)-1][key] = val.data
 				continue
@@ -119,8 +129,9 @@ Reading:
 		}
 		b.unreadToken(tok)
 		obj := b.readObject()
-		stk.Push(Value{nil, objptr{}, obj})
+		stk.Push(Value{data: obj})
 	}
+	return nil
 }
 
 type seqReader struct {
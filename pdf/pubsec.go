@@ -0,0 +1,411 @@
+// Decryption of files encrypted for specific recipients (public-key security).
+
+package pdf
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/rand"
+	"crypto/rc4"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// NewReaderPublicKey opens a file encrypted with the public-key security
+// handler (Adobe.PubSec), using the data in f with the given total size.
+// The file is decrypted with the private key of the recipient cert, which
+// must be one of the file's recipients. If the file is not encrypted,
+// cert and key are not used.
+func NewReaderPublicKey(f io.ReaderAt, size int64, cert *x509.Certificate, key crypto.Decrypter) (*Reader, error) {
+	return newReader(f, size, func(r *Reader) error {
+		return r.initPublicKey(cert, key)
+	})
+}
+
+// ErrNotRecipient is returned by NewReaderPublicKey if the certificate is
+// not one of the recipients of the file.
+var ErrNotRecipient = errors.New("encrypted PDF: certificate is not a recipient")
+
+func (r *Reader) initPublicKey(cert *x509.Certificate, key crypto.Decrypter) error {
+	encrypt, _ := r.resolve(objptr{}, r.trailer["Encrypt"]).data.(dict)
+	if encrypt["Filter"] != name("Adobe.PubSec") {
+		return fmt.Errorf("encrypted PDF: file is not encrypted with public-key security")
+	}
+	d, keyLen, err := newDecrypter(encrypt)
+	if err != nil {
+		return err
+	}
+
+	// With the adbe.pkcs7.s5 subfilter, the recipients are listed in the
+	// default crypt filter instead of the encryption dictionary.
+	recipients := encrypt["Recipients"]
+	if recipients == nil {
+		cf, _ := encrypt["CF"].(dict)
+		stmf, _ := encrypt["StmF"].(name)
+		filter, _ := r.resolve(objptr{}, cf[stmf]).data.(dict)
+		recipients = filter["Recipients"]
+		if em, ok := filter["EncryptMetadata"].(bool); ok {
+			d.encryptMetadata = em
+		}
+	}
+	var envelopes []string
+	switch x := r.resolve(objptr{}, recipients).data.(type) {
+	case string:
+		envelopes = []string{x}
+	case array:
+		for _, e := range x {
+			if s, ok := r.resolve(objptr{}, e).data.(string); ok {
+				envelopes = append(envelopes, s)
+			}
+		}
+	}
+	if len(envelopes) == 0 {
+		return fmt.Errorf("malformed PDF: missing Recipients encryption parameter")
+	}
+
+	var content []byte
+	for _, env := range envelopes {
+		content, err = openEnvelope([]byte(env), cert, key)
+		if err != ErrNotRecipient {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if len(content) < 24 {
+		return fmt.Errorf("malformed PDF: short recipient data")
+	}
+
+	// The key is a hash of the 20-byte seed and all of the recipient
+	// envelopes. The seed is followed by the recipient's permissions.
+	h := sha1.New()
+	if d.stmMethod == cryptAESV3 || d.strMethod == cryptAESV3 {
+		h = sha256.New()
+	}
+	h.Write(content[:20])
+	for _, env := range envelopes {
+		io.WriteString(h, env)
+	}
+	if !d.encryptMetadata {
+		h.Write([]byte{0xff, 0xff, 0xff, 0xff})
+	}
+	d.key = h.Sum(nil)
+	if keyLen < len(d.key) {
+		d.key = d.key[:keyLen]
+	}
+
+	r.crypt = d
+	r.perms = uint32(content[20])<<24 | uint32(content[21])<<16 | uint32(content[22])<<8 | uint32(content[23])
+	r.owner = false
+	return nil
+}
+
+// ASN.1 structures for PKCS #7 (CMS) enveloped data, from RFC 5652.
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue // [0] EXPLICIT
+}
+
+type envelopedData struct {
+	Version              int
+	OriginatorInfo       asn1.RawValue   `asn1:"optional,tag:0"`
+	RecipientInfos       []asn1.RawValue `asn1:"set"`
+	EncryptedContentInfo encryptedContentInfo
+}
+
+type encryptedContentInfo struct {
+	ContentType      asn1.ObjectIdentifier
+	Algorithm        algorithmIdentifier
+	EncryptedContent asn1.RawValue `asn1:"optional,tag:0"`
+}
+
+type algorithmIdentifier struct {
+	Algorithm  asn1.ObjectIdentifier
+	Parameters asn1.RawValue `asn1:"optional"`
+}
+
+type keyTransRecipientInfo struct {
+	Version      int
+	RID          asn1.RawValue
+	Algorithm    algorithmIdentifier
+	EncryptedKey []byte
+}
+
+type issuerAndSerial struct {
+	Issuer asn1.RawValue
+	Serial *big.Int
+}
+
+var (
+	oidEnvelopedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 3}
+	oidRSA           = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidRSAOAEP       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 7}
+	oidDESEDE3CBC    = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+	oidRC2CBC        = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 2}
+	oidRC4           = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 4}
+	oidAES128CBC     = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC     = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC     = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+// openEnvelope decrypts the content of a PKCS #7 enveloped-data object, using
+// the private key of the recipient cert. It returns ErrNotRecipient if cert is
+// not among the object's recipients.
+func openEnvelope(ber []byte, cert *x509.Certificate, key crypto.Decrypter) ([]byte, error) {
+	// The envelopes are often BER-encoded, with indefinite lengths, but
+	// encoding/asn1 only accepts DER.
+	der, err := berToDER(ber)
+	if err != nil {
+		return nil, fmt.Errorf("malformed PDF: recipient data: %v", err)
+	}
+	var ci contentInfo
+	if _, err := asn1.Unmarshal(der, &ci); err != nil {
+		return nil, fmt.Errorf("malformed PDF: recipient data: %v", err)
+	}
+	if !ci.ContentType.Equal(oidEnvelopedData) {
+		return nil, fmt.Errorf("malformed PDF: recipient data is not enveloped data")
+	}
+	var ed envelopedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &ed); err != nil {
+		return nil, fmt.Errorf("malformed PDF: recipient data: %v", err)
+	}
+
+	var contentKey []byte
+	for _, raw := range ed.RecipientInfos {
+		var ri keyTransRecipientInfo
+		if _, err := asn1.Unmarshal(raw.FullBytes, &ri); err != nil {
+			// Not a key transport recipient.
+			continue
+		}
+		if !isRecipient(ri.RID, cert) {
+			continue
+		}
+		var opts crypto.DecrypterOpts
+		switch {
+		case ri.Algorithm.Algorithm.Equal(oidRSA):
+			// Nil options select PKCS #1 v1.5.
+		case ri.Algorithm.Algorithm.Equal(oidRSAOAEP):
+			opts = &rsa.OAEPOptions{Hash: crypto.SHA1}
+		default:
+			return nil, fmt.Errorf("unsupported PDF: key encryption algorithm %v", ri.Algorithm.Algorithm)
+		}
+		k, err := key.Decrypt(rand.Reader, ri.EncryptedKey, opts)
+		if err != nil {
+			return nil, fmt.Errorf("encrypted PDF: decrypting key: %v", err)
+		}
+		contentKey = k
+		break
+	}
+	if contentKey == nil {
+		return nil, ErrNotRecipient
+	}
+
+	eci := ed.EncryptedContentInfo
+	data, err := octetString(eci.EncryptedContent)
+	if err != nil {
+		return nil, fmt.Errorf("malformed PDF: recipient data: %v", err)
+	}
+	alg := eci.Algorithm.Algorithm
+	var block cipher.Block
+	switch {
+	case alg.Equal(oidRC4):
+		c, err := rc4.NewCipher(contentKey)
+		if err != nil {
+			return nil, fmt.Errorf("encrypted PDF: %v", err)
+		}
+		c.XORKeyStream(data, data)
+		return data, nil
+	case alg.Equal(oidDESEDE3CBC):
+		block, err = des.NewTripleDESCipher(contentKey)
+	case alg.Equal(oidAES128CBC), alg.Equal(oidAES192CBC), alg.Equal(oidAES256CBC):
+		block, err = aes.NewCipher(contentKey)
+	case alg.Equal(oidRC2CBC):
+		return nil, fmt.Errorf("unsupported PDF: recipient data encrypted with RC2")
+	default:
+		return nil, fmt.Errorf("unsupported PDF: content encryption algorithm %v", alg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("encrypted PDF: %v", err)
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(eci.Algorithm.Parameters.FullBytes, &iv); err != nil || len(iv) != block.BlockSize() {
+		return nil, fmt.Errorf("malformed PDF: recipient data: bad initialization vector")
+	}
+	if len(data)%block.BlockSize() != 0 {
+		return nil, fmt.Errorf("malformed PDF: recipient data: bad length")
+	}
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(data, data)
+	return unpad(data), nil
+}
+
+// isRecipient reports whether the recipient identifier rid refers to cert,
+// either by issuer and serial number or by subject key identifier.
+func isRecipient(rid asn1.RawValue, cert *x509.Certificate) bool {
+	if cert == nil {
+		return false
+	}
+	if rid.Class == asn1.ClassContextSpecific && rid.Tag == 0 {
+		return len(cert.SubjectKeyId) > 0 && bytes.Equal(rid.Bytes, cert.SubjectKeyId)
+	}
+	var ias issuerAndSerial
+	if _, err := asn1.Unmarshal(rid.FullBytes, &ias); err != nil {
+		return false
+	}
+	return bytes.Equal(ias.Issuer.FullBytes, cert.RawIssuer) && ias.Serial.Cmp(cert.SerialNumber) == 0
+}
+
+// maxBERDepth limits the nesting of BER elements that berToDER accepts.
+const maxBERDepth = 64
+
+// berToDER converts the lengths in BER-encoded data to the form required by
+// DER: indefinite lengths are replaced by definite ones, and all lengths are
+// written in the shortest form. Other differences between BER and DER, such
+// as constructed strings and the order of SET elements, are left alone; the
+// structures used here tolerate them.
+func berToDER(ber []byte) ([]byte, error) {
+	der, rest, err := convertBER(ber, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, errors.New("trailing data after ASN.1 element")
+	}
+	return der, nil
+}
+
+// convertBER converts the first BER element in b, returning it and the rest
+// of b.
+func convertBER(b []byte, depth int) (der, rest []byte, err error) {
+	if depth > maxBERDepth {
+		return nil, nil, errors.New("ASN.1 elements nested too deeply")
+	}
+	errTruncated := errors.New("truncated ASN.1 element")
+
+	// The identifier: one byte, or more for high tag numbers.
+	if len(b) < 2 {
+		return nil, nil, errTruncated
+	}
+	n := 1
+	if b[0]&0x1f == 0x1f {
+		for n < len(b) && b[n]&0x80 != 0 {
+			n++
+		}
+		n++
+	}
+	if n >= len(b) {
+		return nil, nil, errTruncated
+	}
+	tag := b[:n]
+	constructed := b[0]&0x20 != 0
+	b = b[n:]
+
+	var content []byte
+	switch l := b[0]; {
+	case l == 0x80:
+		// Indefinite length: the contents are elements, terminated by
+		// two zero bytes.
+		if !constructed {
+			return nil, nil, errors.New("indefinite length for primitive ASN.1 element")
+		}
+		b = b[1:]
+		for {
+			if len(b) < 2 {
+				return nil, nil, errTruncated
+			}
+			if b[0] == 0 && b[1] == 0 {
+				b = b[2:]
+				break
+			}
+			var elem []byte
+			elem, b, err = convertBER(b, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			content = append(content, elem...)
+		}
+
+	default:
+		length := int(l)
+		b = b[1:]
+		if l&0x80 != 0 {
+			n := int(l & 0x7f)
+			if n > 4 || n > len(b) {
+				return nil, nil, errors.New("invalid ASN.1 length")
+			}
+			length = 0
+			for _, c := range b[:n] {
+				length = length<<8 | int(c)
+			}
+			b = b[n:]
+		}
+		if length < 0 || length > len(b) {
+			return nil, nil, errTruncated
+		}
+		content, b = b[:length], b[length:]
+		if constructed {
+			var elems []byte
+			for rest := content; len(rest) > 0; {
+				var elem []byte
+				elem, rest, err = convertBER(rest, depth+1)
+				if err != nil {
+					return nil, nil, err
+				}
+				elems = append(elems, elem...)
+			}
+			content = elems
+		}
+	}
+
+	der = append(der, tag...)
+	der = appendDERLength(der, len(content))
+	der = append(der, content...)
+	return der, b, nil
+}
+
+// appendDERLength appends the DER encoding of a length to b.
+func appendDERLength(b []byte, n int) []byte {
+	if n < 0x80 {
+		return append(b, byte(n))
+	}
+	var x []byte
+	for ; n > 0; n >>= 8 {
+		x = append([]byte{byte(n)}, x...)
+	}
+	b = append(b, 0x80|byte(len(x)))
+	return append(b, x...)
+}
+
+// octetString returns the contents of an implicitly tagged OCTET STRING,
+// which in BER may be split into a constructed sequence of chunks.
+func octetString(v asn1.RawValue) ([]byte, error) {
+	if !v.IsCompound {
+		return append([]byte(nil), v.Bytes...), nil
+	}
+	var out []byte
+	for rest := v.Bytes; len(rest) > 0; {
+		var chunk asn1.RawValue
+		var err error
+		rest, err = asn1.Unmarshal(rest, &chunk)
+		if err != nil {
+			return nil, err
+		}
+		b, err := octetString(chunk)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, b...)
+	}
+	return out, nil
+}
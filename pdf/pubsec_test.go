@@ -0,0 +1,144 @@
+package pdf
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func newTestCert(t *testing.T, serial int64) (*x509.Certificate, *rsa.PrivateKey) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "Test Recipient"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+// newEnvelope returns a DER-encoded enveloped-data object holding content,
+// encrypted with AES-128 for cert.
+func newEnvelope(t *testing.T, content []byte, cert *x509.Certificate) []byte {
+	t.Helper()
+	contentKey := make([]byte, 16)
+	iv := make([]byte, 16)
+	rand.Read(contentKey)
+	rand.Read(iv)
+	pad := 16 - len(content)%16
+	data := append(append([]byte(nil), content...), bytes.Repeat([]byte{byte(pad)}, pad)...)
+	block, _ := aes.NewCipher(contentKey)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(data, data)
+
+	encryptedKey, err := rsa.EncryptPKCS1v15(rand.Reader, cert.PublicKey.(*rsa.PublicKey), contentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustMarshal := func(v interface{}) []byte {
+		b, err := asn1.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	ri := keyTransRecipientInfo{
+		RID: asn1.RawValue{FullBytes: mustMarshal(issuerAndSerial{
+			Issuer: asn1.RawValue{FullBytes: cert.RawIssuer},
+			Serial: cert.SerialNumber,
+		})},
+		Algorithm:    algorithmIdentifier{Algorithm: oidRSA, Parameters: asn1.NullRawValue},
+		EncryptedKey: encryptedKey,
+	}
+	ed := envelopedData{
+		RecipientInfos: []asn1.RawValue{{FullBytes: mustMarshal(ri)}},
+		EncryptedContentInfo: encryptedContentInfo{
+			ContentType: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1},
+			Algorithm: algorithmIdentifier{
+				Algorithm:  oidAES128CBC,
+				Parameters: asn1.RawValue{FullBytes: mustMarshal(iv)},
+			},
+			EncryptedContent: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, Bytes: data},
+		},
+	}
+	return mustMarshal(contentInfo{
+		ContentType: oidEnvelopedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: mustMarshal(ed)},
+	})
+}
+
+// indefinite re-encodes the constructed elements of a DER encoding with
+// indefinite lengths, as BER allows.
+func indefinite(t *testing.T, der []byte) []byte {
+	t.Helper()
+	var out []byte
+	for len(der) > 0 {
+		var v asn1.RawValue
+		rest, err := asn1.Unmarshal(der, &v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.IsCompound {
+			header := v.FullBytes[:len(v.FullBytes)-len(v.Bytes)]
+			out = append(out, header[0], 0x80)
+			out = append(out, indefinite(t, v.Bytes)...)
+			out = append(out, 0, 0)
+		} else {
+			out = append(out, v.FullBytes...)
+		}
+		der = rest
+	}
+	return out
+}
+
+func TestOpenEnvelope(t *testing.T) {
+	cert, key := newTestCert(t, 1)
+	other, _ := newTestCert(t, 2)
+	content := []byte("0123456789abcdefghij\xff\xff\xff\xfc")
+	der := newEnvelope(t, content, cert)
+	ber := indefinite(t, der)
+	if bytes.Equal(der, ber) {
+		t.Fatal("BER encoding is the same as DER")
+	}
+
+	for _, c := range []struct {
+		name string
+		data []byte
+	}{
+		{"DER", der},
+		{"BER", ber},
+	} {
+		got, err := openEnvelope(c.data, cert, key)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+		} else if !bytes.Equal(got, content) {
+			t.Errorf("%s: got %q, want %q", c.name, got, content)
+		}
+		if _, err := openEnvelope(c.data, other, key); err != ErrNotRecipient {
+			t.Errorf("%s, other certificate: got %v, want ErrNotRecipient", c.name, err)
+		}
+	}
+
+	if _, err := openEnvelope(ber[:len(ber)-2], cert, key); err == nil {
+		t.Error("truncated BER: no error")
+	}
+}
@@ -33,7 +33,10 @@
 // Returning zero values this way, especially from the Dict and Array accessors,
 // which themselves return Values, makes it possible to traverse a PDF quickly
 // without writing any error checking. On the other hand, it means that mistakes
-// can go unreported.
+// can go unreported. When an object can't be loaded, because the file is
+// malformed or uses an unsupported feature, the resulting null Value (and any
+// Value derived from it) reports the problem through its Err method; a Reader
+// can also be given an error handler to collect such errors as they occur.
 //
 // The basic structure of the PDF file is exposed as the graph of Values.
 //
@@ -49,45 +52,56 @@ package pdf // import "rsc.io/pdf"
 // BUG(rsc): The package is incomplete, although it has been used successfully on some
 // large real-world PDF files.
 
-// BUG(rsc): There is no support for closing open PDF files. If you drop all references to a Reader,
-// the underlying reader will eventually be garbage collected.
-
-// BUG(rsc): The library makes no attempt at efficiency. A value cache maintained in the Reader
-// would probably help significantly.
-
-// BUG(rsc): The support for reading encrypted files is weak.
-
-// BUG(rsc): The Value API does not support error reporting. The intent is to allow users to
-// set an error reporting callback in Reader, but that code has not been implemented.
-
 import (
 	"bytes"
 	"compress/zlib"
-	"crypto/aes"
-	"crypto/cipher"
-	"crypto/md5"
-	"crypto/rc4"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"sort"
 	"strconv"
+	"sync"
 
 	"golang.org/x/image/ccitt"
 )
 
 // A Reader is a single PDF file open for reading.
+// It is safe for concurrent use by multiple goroutines.
 type Reader struct {
 	f          io.ReaderAt
 	end        int64
+	version    string // from the header
+	trailerptr objptr
+	crypt      *decrypter // nil if the file is not encrypted
+	perms      uint32
+	owner      bool
+
+	errorHandler func(error)
+	closer       io.Closer // the file opened by Open
+
+	sections []int64 // offsets of the xref sections, newest first
+
+	// mu protects the fields below, which may change while the file is
+	// being read.
+	mu         sync.Mutex
 	xref       []xref
 	trailer    dict
-	trailerptr objptr
-	key        []byte
-	useAES     bool
+	cache      *lru  // recently used objects
+	objStreams *lru  // recently used object streams, decoded
+	repaired   bool  // whether the xref table has been rebuilt by scanning
+	warning    error // the damage that caused the repair
+	closed     bool
+
+	pageLabels       []labelRange // cached by pageLabelRanges
+	pageLabelsLoaded bool
 }
 
+// ErrClosed is the error reported when loading data from a Reader that has
+// been closed.
+var ErrClosed = errors.New("pdf: use of closed Reader")
+
 type xref struct {
 	ptr      objptr
 	inStream bool
@@ -95,13 +109,35 @@ type xref struct {
 	offset   int64
 }
 
-func (r *Reader) errorf(format string, args ...interface{}) {
-	panic(fmt.Errorf(format, args...))
+// SetErrorHandler sets a function to be called with each error that occurs
+// while loading objects from the file, such as a malformed object or an
+// unsupported filter. The same errors are available from Value.Err, but the
+// handler is a convenient way to collect diagnostics while traversing a file
+// with the error-free accessors.
+//
+// SetErrorHandler should be called before the Reader is shared between
+// goroutines, and the handler may be called from several goroutines at once.
+func (r *Reader) SetErrorHandler(h func(err error)) {
+	r.errorHandler = h
+}
+
+// fail reports err to the error handler, and returns a null Value carrying
+// the error.
+func (r *Reader) fail(err error) Value {
+	r.reportError(err)
+	return Value{r: r, err: err}
+}
+
+// reportError passes err to the error handler, if there is one.
+func (r *Reader) reportError(err error) {
+	if r != nil && r.errorHandler != nil {
+		r.errorHandler(err)
+	}
 }
 
 // Open opens a file for reading.
+// The file stays open until the Reader's Close method is called.
 func Open(file string) (*Reader, error) {
-	// TODO: Deal with closing file.
 	f, err := os.Open(file)
 	if err != nil {
 		return nil, err
@@ -111,7 +147,42 @@ func Open(file string) (*Reader, error) {
 		f.Close()
 		return nil, err
 	}
-	return NewReader(f, fi.Size())
+	r, err := NewReader(f, fi.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	r.closer = f
+	return r, nil
+}
+
+// Close releases the resources held by r: its caches, and the file if r was
+// created by Open. (A Reader created by NewReader does not close the
+// io.ReaderAt it was given.) After Close, Values obtained from r can still be
+// inspected if they have already been loaded, but loading anything more from
+// the file fails with ErrClosed.
+func (r *Reader) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	r.cache = newLRU(0)
+	r.objStreams = newLRU(0)
+	r.mu.Unlock()
+
+	if r.closer != nil {
+		return r.closer.Close()
+	}
+	return nil
+}
+
+// isClosed reports whether r has been closed.
+func (r *Reader) isClosed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.closed
 }
 
 // NewReader opens a file for reading, using the data in f with the given total size.
@@ -123,58 +194,170 @@ func NewReader(f io.ReaderAt, size int64) (*Reader, error) {
 // If the PDF is encrypted, NewReaderEncrypted calls pw repeatedly to obtain passwords
 // to try. If pw returns the empty string, NewReaderEncrypted stops trying to decrypt
 // the file and returns an error.
+//
+// If the file's cross-reference table is missing or damaged,
+// NewReaderEncrypted rebuilds it by scanning the file for objects, and the
+// Reader's Warning method describes the problem.
 func NewReaderEncrypted(f io.ReaderAt, size int64, pw func() string) (*Reader, error) {
-	buf := make([]byte, 10)
-	f.ReadAt(buf, 0)
-	if !bytes.HasPrefix(buf, []byte("%PDF-1.")) || buf[7] < '0' || buf[7] > '7' || buf[8] != '\r' && buf[8] != '\n' && buf[8] != ' ' {
+	return newReader(f, size, func(r *Reader) error {
+		return r.unlock(pw)
+	})
+}
+
+// newReader opens a file for reading. If the file is encrypted, newReader
+// calls unlock to set up decryption.
+func newReader(f io.ReaderAt, size int64, unlock func(*Reader) error) (rd *Reader, err error) {
+	defer catch(&err)
+	start, version, ok := findHeader(f)
+	if !ok {
 		return nil, fmt.Errorf("not a PDF file: invalid header")
 	}
-	end := size
+	r := &Reader{
+		f:          f,
+		end:        size,
+		version:    version,
+		cache:      newLRU(DefaultCacheSize),
+		objStreams: newLRU(objStreamCacheSize),
+	}
+	if start > 0 {
+		// The header is preceded by junk, such as a mail header. The
+		// offsets in the file are counted from the header, so the
+		// junk is hidden from the rest of the Reader.
+		r.f = io.NewSectionReader(f, start, size-start)
+		r.end = size - start
+	}
+	var objStreams []objptr
+	var catalog objptr
+	err = r.readXrefFromEnd()
+	if err != nil && start > 0 {
+		// Some files were written with the junk already in place, so
+		// that the offsets are counted from the start of the file.
+		r.f, r.end = f, size
+		if r.readXrefFromEnd() != nil {
+			r.f = io.NewSectionReader(f, start, size-start)
+			r.end = size - start
+		} else {
+			err = nil
+		}
+	}
+	if err != nil {
+		// The cross-reference table is missing or damaged; try to
+		// reconstruct it from the objects in the file.
+		r.repaired = true
+		var rerr error
+		r.xref, r.trailer, objStreams, catalog, rerr = r.rebuildXref()
+		if rerr != nil {
+			return nil, &repairError{err, rerr}
+		}
+		r.trailerptr = objptr{}
+		r.warning = fmt.Errorf("%v; rebuilt cross-reference table", err)
+	}
+
+	if r.trailer["Encrypt"] != nil {
+		if err := unlock(r); err != nil {
+			return nil, err
+		}
+	}
+	// Object streams can only be read once decryption is set up, and the
+	// document catalog may be in one.
+	r.indexObjectStreams(objStreams)
+	if r.warning != nil {
+		if rerr := r.checkRoot(catalog); rerr != nil {
+			return nil, &repairError{err, rerr}
+		}
+	}
+	return r, nil
+}
+
+// headerSearchLimit is how far into the file newReader looks for the %PDF
+// header.
+const headerSearchLimit = 1024
+
+// findHeader looks for the %PDF-n.m header near the start of f, and returns
+// its position and the version number it contains.
+func findHeader(f io.ReaderAt) (start int64, version string, ok bool) {
+	buf := make([]byte, headerSearchLimit+10)
+	n, _ := f.ReadAt(buf, 0)
+	buf = buf[:n]
+	for off := 0; off <= headerSearchLimit; {
+		i := bytes.Index(buf[off:], []byte("%PDF-"))
+		if i < 0 || off+i > headerSearchLimit {
+			break
+		}
+		i += off
+		v := buf[i+5:]
+		if len(v) >= 3 && v[0] >= '1' && v[0] <= '2' && v[1] == '.' && v[2] >= '0' && v[2] <= '9' &&
+			(len(v) == 3 || v[3] == '\r' || v[3] == '\n' || v[3] == ' ' || v[3] == '\t' || v[3] == '%') {
+			return int64(i), string(v[:3]), true
+		}
+		off = i + 1
+	}
+	return 0, "", false
+}
+
+// Version returns the version of the PDF specification that the file
+// conforms to, such as "1.7" or "2.0". It is taken from the file's header,
+// unless the document catalog's Version entry specifies a later version.
+func (r *Reader) Version() string {
+	v := r.version
+	if cv := r.Trailer().Key("Root").Key("Version").Name(); len(cv) == 3 && cv[1] == '.' && cv > v {
+		v = cv
+	}
+	return v
+}
+
+// readXrefFromEnd reads the cross-reference table and trailer, starting from
+// the startxref line at the end of the file.
+func (r *Reader) readXrefFromEnd() (err error) {
+	defer catch(&err)
+	end := r.end
 	const endChunk = 100
-	buf = make([]byte, endChunk)
-	f.ReadAt(buf, end-endChunk)
-	for len(buf) > 0 && buf[len(buf)-1] == '\n' || buf[len(buf)-1] == '\r' {
+	buf := make([]byte, endChunk)
+	r.f.ReadAt(buf, end-endChunk)
+	for len(buf) > 0 && (buf[len(buf)-1] == '\n' || buf[len(buf)-1] == '\r') {
 		buf = buf[:len(buf)-1]
 	}
 	buf = bytes.TrimRight(buf, "\r\n\t ")
 	if !bytes.HasSuffix(buf, []byte("%%EOF")) {
-		return nil, fmt.Errorf("not a PDF file: missing %%%%EOF")
+		return fmt.Errorf("not a PDF file: missing %%%%EOF")
 	}
 	i := findLastLine(buf, "startxref")
 	if i < 0 {
-		return nil, fmt.Errorf("malformed PDF file: missing final startxref")
+		return fmt.Errorf("malformed PDF file: missing final startxref")
 	}
 
-	r := &Reader{
-		f:   f,
-		end: end,
-	}
 	pos := end - endChunk + int64(i)
-	b := newBuffer(io.NewSectionReader(f, pos, end-pos), pos)
+	b := newBuffer(io.NewSectionReader(r.f, pos, end-pos), pos)
 	if b.readToken() != keyword("startxref") {
-		return nil, fmt.Errorf("malformed PDF file: missing startxref")
+		return fmt.Errorf("malformed PDF file: missing startxref")
 	}
 	startxref, ok := b.readToken().(int64)
 	if !ok {
-		return nil, fmt.Errorf("malformed PDF file: startxref not followed by integer")
+		return fmt.Errorf("malformed PDF file: startxref not followed by integer")
 	}
-	b = newBuffer(io.NewSectionReader(r.f, startxref, r.end-startxref), startxref)
-	xref, trailerptr, trailer, err := readXref(r, b)
+	xref, trailerptr, trailer, sections, err := readXref(r, startxref)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if _, ok := trailer["Root"].(objptr); !ok {
+		return fmt.Errorf("malformed PDF file: trailer has no Root")
 	}
 	r.xref = xref
 	r.trailer = trailer
 	r.trailerptr = trailerptr
-	if trailer["Encrypt"] == nil {
-		return r, nil
-	}
-	err = r.initEncrypt("")
+	r.sections = sections
+	return nil
+}
+
+// unlock sets up decryption for an encrypted file, first with the empty
+// password, and then with the passwords returned by pw.
+func (r *Reader) unlock(pw func() string) error {
+	err := r.initEncrypt("")
 	if err == nil {
-		return r, nil
+		return nil
 	}
 	if pw == nil || err != ErrInvalidPassword {
-		return nil, err
+		return err
 	}
 	for {
 		next := pw()
@@ -182,36 +365,127 @@ func NewReaderEncrypted(f io.ReaderAt, size int64, pw func() string) (*Reader, e
 			break
 		}
 		if r.initEncrypt(next) == nil {
-			return r, nil
+			return nil
 		}
 	}
-	return nil, err
+	return err
 }
 
 // Trailer returns the file's Trailer value.
 func (r *Reader) Trailer() Value {
-	return Value{r, r.trailerptr, r.trailer}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return Value{r: r, ptr: r.trailerptr, data: r.trailer}
 }
 
-func readXref(r *Reader, b *buffer) ([]xref, objptr, dict, error) {
+// readXref reads the cross-reference section at offset, and the older
+// sections that it refers to with Prev (and, in hybrid-reference files,
+// XRefStm). The sections are merged, with entries in newer sections taking
+// precedence. It returns the merged table, the trailer of the newest section,
+// and the offsets of the sections in the Prev chain, newest first.
+func readXref(r *Reader, offset int64) (table []xref, trailerptr objptr, trailer dict, sections []int64, err error) {
+	seen := make(map[int64]bool)
+	for off := offset; ; {
+		if seen[off] {
+			return nil, objptr{}, nil, nil, fmt.Errorf("malformed PDF: cycle in xref Prev chain at offset %d", off)
+		}
+		seen[off] = true
+		sections = append(sections, off)
+
+		entries, ptr, hdr, err := readXrefSection(r, off)
+		if err != nil {
+			return nil, objptr{}, nil, nil, err
+		}
+		if trailer == nil {
+			trailer, trailerptr = hdr, ptr
+		}
+
+		if stmoff, ok := hdr["XRefStm"].(int64); ok && !seen[stmoff] {
+			// In a hybrid-reference file, the table lists the objects that
+			// are in object streams as free, and the stream gives their
+			// real locations.
+			seen[stmoff] = true
+			stm, _, _, err := readXrefSection(r, stmoff)
+			if err != nil {
+				return nil, objptr{}, nil, nil, fmt.Errorf("malformed PDF: reading XRefStm: %v", err)
+			}
+			for len(entries) < len(stm) {
+				entries = append(entries, xref{})
+			}
+			for i, x := range stm {
+				if x.ptr != (objptr{}) && (entries[i].ptr == (objptr{}) || entries[i].ptr == objptr{0, 65535}) {
+					entries[i] = x
+				}
+			}
+		}
+		table = mergeXref(table, entries)
+
+		prev, ok := hdr["Prev"]
+		if !ok {
+			break
+		}
+		if off, ok = prev.(int64); !ok {
+			return nil, objptr{}, nil, nil, fmt.Errorf("malformed PDF: xref Prev is not integer: %v", objfmt(prev))
+		}
+	}
+
+	size, ok := trailer["Size"].(int64)
+	if !ok {
+		return nil, objptr{}, nil, nil, fmt.Errorf("malformed PDF: trailer missing /Size entry")
+	}
+	if size < int64(len(table)) {
+		table = table[:size]
+	}
+	return table, trailerptr, trailer, sections, nil
+}
+
+// mergeXref adds the entries from an older cross-reference section to table,
+// without replacing the entries (including free ones) that are already
+// present.
+func mergeXref(table, older []xref) []xref {
+	for len(table) < len(older) {
+		table = append(table, xref{})
+	}
+	for i, x := range older {
+		if table[i].ptr == (objptr{}) {
+			table[i] = x
+		}
+	}
+	return table
+}
+
+// readXrefSection reads one cross-reference table (with its trailer) or
+// cross-reference stream. The entries are indexed by object number; free
+// objects have the pointer {0, 65535}, and objects not in the section have
+// the zero pointer.
+func readXrefSection(r *Reader, off int64) (entries []xref, trailerptr objptr, trailer dict, err error) {
+	defer catch(&err)
+	if off <= 0 || off >= r.end {
+		return nil, objptr{}, nil, fmt.Errorf("malformed PDF: xref offset %d out of range", off)
+	}
+	b := newBuffer(io.NewSectionReader(r.f, off, r.end-off), off)
 	tok := b.readToken()
 	if tok == keyword("xref") {
-		return readXrefTable(r, b)
+		entries, err = readXrefTableData(b)
+		if err != nil {
+			return nil, objptr{}, nil, fmt.Errorf("malformed PDF: %v", err)
+		}
+		trailer, ok := b.readObject().(dict)
+		if !ok {
+			return nil, objptr{}, nil, fmt.Errorf("malformed PDF: xref table not followed by trailer dictionary")
+		}
+		return entries, objptr{}, trailer, nil
 	}
-	if _, ok := tok.(int64); ok {
-		b.unreadToken(tok)
-		return readXrefStream(r, b)
+	if _, ok := tok.(int64); !ok {
+		return nil, objptr{}, nil, fmt.Errorf("malformed PDF: cross-reference table not found: %v", objfmt(tok))
 	}
-	return nil, objptr{}, nil, fmt.Errorf("malformed PDF: cross-reference table not found: %v", tok)
-}
 
-func readXrefStream(r *Reader, b *buffer) ([]xref, objptr, dict, error) {
+	b.unreadToken(tok)
 	obj1 := b.readObject()
 	obj, ok := obj1.(objdef)
 	if !ok {
 		return nil, objptr{}, nil, fmt.Errorf("malformed PDF: cross-reference table not found: %v", objfmt(obj1))
 	}
-	strmptr := obj.ptr
 	strm, ok := obj.obj.(stream)
 	if !ok {
 		return nil, objptr{}, nil, fmt.Errorf("malformed PDF: cross-reference table not found: %v", objfmt(obj))
@@ -223,49 +497,15 @@ func readXrefStream(r *Reader, b *buffer) ([]xref, objptr, dict, error) {
 	if !ok {
 		return nil, objptr{}, nil, fmt.Errorf("malformed PDF: xref stream missing Size")
 	}
-	table := make([]xref, size)
-
-	table, err := readXrefStreamData(r, strm, table, size)
+	entries, err = readXrefStreamData(r, strm, size)
 	if err != nil {
 		return nil, objptr{}, nil, fmt.Errorf("malformed PDF: %v", err)
 	}
-
-	for prevoff := strm.hdr["Prev"]; prevoff != nil; {
-		off, ok := prevoff.(int64)
-		if !ok {
-			return nil, objptr{}, nil, fmt.Errorf("malformed PDF: xref Prev is not integer: %v", prevoff)
-		}
-		b := newBuffer(io.NewSectionReader(r.f, off, r.end-off), off)
-		obj1 := b.readObject()
-		obj, ok := obj1.(objdef)
-		if !ok {
-			return nil, objptr{}, nil, fmt.Errorf("malformed PDF: xref prev stream not found: %v", objfmt(obj1))
-		}
-		prevstrm, ok := obj.obj.(stream)
-		if !ok {
-			return nil, objptr{}, nil, fmt.Errorf("malformed PDF: xref prev stream not found: %v", objfmt(obj))
-		}
-		prevoff = prevstrm.hdr["Prev"]
-		prev := Value{r, objptr{}, prevstrm}
-		if prev.Kind() != Stream {
-			return nil, objptr{}, nil, fmt.Errorf("malformed PDF: xref prev stream is not stream: %v", prev)
-		}
-		if prev.Key("Type").Name() != "XRef" {
-			return nil, objptr{}, nil, fmt.Errorf("malformed PDF: xref prev stream does not have type XRef")
-		}
-		psize := prev.Key("Size").Int64()
-		if psize > size {
-			return nil, objptr{}, nil, fmt.Errorf("malformed PDF: xref prev stream larger than last stream")
-		}
-		if table, err = readXrefStreamData(r, prev.data.(stream), table, psize); err != nil {
-			return nil, objptr{}, nil, fmt.Errorf("malformed PDF: reading xref prev stream: %v", err)
-		}
-	}
-
-	return table, strmptr, strm.hdr, nil
+	return entries, obj.ptr, strm.hdr, nil
 }
 
-func readXrefStreamData(r *Reader, strm stream, table []xref, size int64) ([]xref, error) {
+func readXrefStreamData(r *Reader, strm stream, size int64) ([]xref, error) {
+	table := make([]xref, size)
 	index, _ := strm.hdr["Index"].(array)
 	if index == nil {
 		index = array{int64(0), size}
@@ -290,7 +530,7 @@ func readXrefStreamData(r *Reader, strm stream, table []xref, size int64) ([]xre
 		return nil, fmt.Errorf("invalid W array %v", objfmt(ww))
 	}
 
-	v := Value{r, objptr{}, strm}
+	v := Value{r: r, data: strm}
 	wtotal := 0
 	for _, wid := range w {
 		wtotal += wid
@@ -316,11 +556,8 @@ func readXrefStreamData(r *Reader, strm stream, table []xref, size int64) ([]xre
 			v2 := decodeInt(buf[w[0] : w[0]+w[1]])
 			v3 := decodeInt(buf[w[0]+w[1] : w[0]+w[1]+w[2]])
 			x := int(start) + i
-			for cap(table) <= x {
-				table = append(table[:cap(table)], xref{})
-			}
-			if table[x].ptr != (objptr{}) {
-				continue
+			for len(table) <= x {
+				table = append(table, xref{})
 			}
 			switch v1 {
 			case 0:
@@ -345,54 +582,8 @@ func decodeInt(b []byte) int {
 	return x
 }
 
-func readXrefTable(r *Reader, b *buffer) ([]xref, objptr, dict, error) {
+func readXrefTableData(b *buffer) ([]xref, error) {
 	var table []xref
-
-	table, err := readXrefTableData(b, table)
-	if err != nil {
-		return nil, objptr{}, nil, fmt.Errorf("malformed PDF: %v", err)
-	}
-
-	trailer, ok := b.readObject().(dict)
-	if !ok {
-		return nil, objptr{}, nil, fmt.Errorf("malformed PDF: xref table not followed by trailer dictionary")
-	}
-
-	for prevoff := trailer["Prev"]; prevoff != nil; {
-		off, ok := prevoff.(int64)
-		if !ok {
-			return nil, objptr{}, nil, fmt.Errorf("malformed PDF: xref Prev is not integer: %v", prevoff)
-		}
-		b := newBuffer(io.NewSectionReader(r.f, off, r.end-off), off)
-		tok := b.readToken()
-		if tok != keyword("xref") {
-			return nil, objptr{}, nil, fmt.Errorf("malformed PDF: xref Prev does not point to xref")
-		}
-		table, err = readXrefTableData(b, table)
-		if err != nil {
-			return nil, objptr{}, nil, fmt.Errorf("malformed PDF: %v", err)
-		}
-
-		trailer, ok := b.readObject().(dict)
-		if !ok {
-			return nil, objptr{}, nil, fmt.Errorf("malformed PDF: xref Prev table not followed by trailer dictionary")
-		}
-		prevoff = trailer["Prev"]
-	}
-
-	size, ok := trailer[name("Size")].(int64)
-	if !ok {
-		return nil, objptr{}, nil, fmt.Errorf("malformed PDF: trailer missing /Size entry")
-	}
-
-	if size < int64(len(table)) {
-		table = table[:size]
-	}
-
-	return table, objptr{}, trailer, nil
-}
-
-func readXrefTableData(b *buffer, table []xref) ([]xref, error) {
 	for {
 		tok := b.readToken()
 		if tok == keyword("trailer") {
@@ -400,7 +591,7 @@ func readXrefTableData(b *buffer, table []xref) ([]xref, error) {
 		}
 		start, ok1 := tok.(int64)
 		n, ok2 := b.readToken().(int64)
-		if !ok1 || !ok2 {
+		if !ok1 || !ok2 || start < 0 || n < 0 || start+n > 1<<24 {
 			return nil, fmt.Errorf("malformed xref table")
 		}
 		for i := 0; i < int(n); i++ {
@@ -411,14 +602,13 @@ func readXrefTableData(b *buffer, table []xref) ([]xref, error) {
 				return nil, fmt.Errorf("malformed xref table")
 			}
 			x := int(start) + i
-			for cap(table) <= x {
-				table = append(table[:cap(table)], xref{})
-			}
-			if len(table) <= x {
-				table = table[:x+1]
+			for len(table) <= x {
+				table = append(table, xref{})
 			}
-			if alloc == "n" && table[x].offset == 0 {
+			if alloc == "n" {
 				table[x] = xref{ptr: objptr{uint32(x), uint16(gen)}, offset: int64(off)}
+			} else {
+				table[x] = xref{ptr: objptr{0, 65535}}
 			}
 		}
 	}
@@ -443,9 +633,18 @@ func findLastLine(buf []byte, s string) int {
 // A Value is a single PDF value, such as an integer, dictionary, or array.
 // The zero Value is a PDF null (Kind() == Null, IsNull() = true).
 type Value struct {
-	r    *Reader
-	ptr  objptr
-	data interface{}
+	r        *Reader
+	ptr      objptr
+	data     interface{}
+	err      error
+	indirect bool // whether v is the indirect object ptr, rather than part of it
+}
+
+// Err returns the error that occurred loading v, if any. A Value with an
+// error is a null, and the Values obtained from it with Key or Index carry
+// the same error, so it can be checked at the end of a chain of accessors.
+func (v Value) Err() error {
+	return v.err
 }
 
 // IsNull reports whether the value is a null. It is equivalent to Kind() == Null.
@@ -553,6 +752,12 @@ func objfmt(x interface{}) string {
 	case objptr:
 		return fmt.Sprintf("%d %d R", x.id, x.gen)
 
+	case wref:
+		return fmt.Sprintf("%d %d R", x.ptr.id, x.ptr.gen)
+
+	case Value:
+		return objfmt(x.data)
+
 	case objdef:
 		return fmt.Sprintf("{%d %d obj}%v", x.ptr.id, x.ptr.gen, objfmt(x.obj))
 	}
@@ -634,11 +839,14 @@ func (v Value) Text() string {
 	if !ok {
 		return ""
 	}
+	if isUTF8(x) {
+		return stripLanguageEscapes(x[3:])
+	}
 	if isPDFDocEncoded(x) {
 		return pdfDocDecode(x)
 	}
 	if isUTF16(x) {
-		return utf16Decode(x[2:])
+		return stripLanguageEscapes(utf16Decode(x[2:]))
 	}
 	return x
 }
@@ -683,7 +891,7 @@ func (v Value) Key(key string) Value {
 	if !ok {
 		strm, ok := v.data.(stream)
 		if !ok {
-			return Value{}
+			return Value{r: v.r, err: v.err}
 		}
 		x = strm.hdr
 	}
@@ -716,7 +924,7 @@ func (v Value) Keys() []string {
 func (v Value) Index(i int) Value {
 	x, ok := v.data.(array)
 	if !ok || i < 0 || i >= len(x) {
-		return Value{}
+		return Value{r: v.r, err: v.err}
 	}
 	return v.r.resolve(v.ptr, x[i])
 }
@@ -733,74 +941,128 @@ func (v Value) Len() int {
 
 func (r *Reader) resolve(parent objptr, x interface{}) Value {
 	if ptr, ok := x.(objptr); ok {
-		if ptr.id >= uint32(len(r.xref)) {
+		if r == nil {
 			return Value{}
 		}
-		xref := r.xref[ptr.id]
-		if xref.ptr != ptr || !xref.inStream && xref.offset == 0 {
+		obj, found, err := r.loadObject(parent, ptr)
+		if err == ErrClosed {
+			return r.fail(err)
+		}
+		if err != nil {
+			return r.fail(fmt.Errorf("loading %v: %v", ptr, err))
+		}
+		if !found {
 			return Value{}
 		}
-		var obj object
-		if xref.inStream {
-			strm := r.resolve(parent, xref.stream)
-		Search:
-			for {
-				if strm.Kind() != Stream {
-					panic("not a stream")
-				}
-				if strm.Key("Type").Name() != "ObjStm" {
-					panic("not an object stream")
-				}
-				n := int(strm.Key("N").Int64())
-				first := strm.Key("First").Int64()
-				if first == 0 {
-					panic("missing First")
-				}
-				b := newBuffer(strm.Reader(), 0)
-				b.allowEOF = true
-				for i := 0; i < n; i++ {
-					id, _ := b.readToken().(int64)
-					off, _ := b.readToken().(int64)
-					if uint32(id) == ptr.id {
-						b.seekForward(first + off)
-						x = b.readObject()
-						break Search
-					}
-				}
-				ext := strm.Key("Extends")
-				if ext.Kind() != Stream {
-					panic("cannot find object in stream")
-				}
-				strm = ext
-			}
-		} else {
-			b := newBuffer(io.NewSectionReader(r.f, xref.offset, r.end-xref.offset), xref.offset)
-			b.key = r.key
-			b.useAES = r.useAES
-			obj = b.readObject()
-			def, ok := obj.(objdef)
-			if !ok {
-				panic(fmt.Errorf("loading %v: found %T instead of objdef", ptr, obj))
-				//return Value{}
-			}
-			if def.ptr != ptr {
-				panic(fmt.Errorf("loading %v: found %v", ptr, def.ptr))
-			}
-			x = def.obj
+		switch obj.(type) {
+		case nil, bool, int64, float64, name, dict, array, stream, string:
+			return Value{r: r, ptr: ptr, data: obj, indirect: true}
 		}
+		x = obj
 		parent = ptr
 	}
 
 	switch x := x.(type) {
-	case nil, bool, int64, float64, name, dict, array, stream:
-		return Value{r, parent, x}
+	case Value:
+		// A Value from a Reader, stored in a built object (see build.go).
+		if ptr, ok := x.data.(objptr); ok {
+			return x.r.resolve(x.ptr, ptr)
+		}
+		return x
+	case nil, bool, int64, float64, name, dict, array, stream, wref:
+		return Value{r: r, ptr: parent, data: x}
 	case string:
-		return Value{r, parent, x}
+		return Value{r: r, ptr: parent, data: x}
 	default:
-		panic(fmt.Errorf("unexpected value type %T in resolve", x))
+		return r.fail(fmt.Errorf("unexpected value type %T in resolve", x))
 	}
 }
 
+// loadObject returns the object ptr, from the cache or from the file. If the
+// object is not in the cross-reference table, found is false.
+func (r *Reader) loadObject(parent, ptr objptr) (obj object, found bool, err error) {
+	for retried := false; ; retried = true {
+		r.mu.Lock()
+		if r.closed {
+			r.mu.Unlock()
+			return nil, true, ErrClosed
+		}
+		if obj, ok := r.cache.get(ptr); ok {
+			r.mu.Unlock()
+			return obj, true, nil
+		}
+		var xref xref
+		if ptr.id < uint32(len(r.xref)) {
+			xref = r.xref[ptr.id]
+		}
+		r.mu.Unlock()
+		if xref.ptr != ptr || !xref.inStream && xref.offset == 0 {
+			return nil, false, nil
+		}
+
+		if xref.inStream {
+			obj, err = r.readFromObjectStream(parent, ptr, xref.stream)
+		} else {
+			obj, err = r.readIndirectObject(ptr, xref.offset)
+			if err != nil && !retried && r.repair(fmt.Errorf("loading %v: %v", ptr, err)) {
+				continue
+			}
+		}
+		if err != nil {
+			return nil, true, err
+		}
+		r.mu.Lock()
+		r.cache.put(ptr, obj)
+		r.mu.Unlock()
+		return obj, true, nil
+	}
+}
+
+// readIndirectObject reads the definition of the object ptr, at offset.
+func (r *Reader) readIndirectObject(ptr objptr, offset int64) (object, error) {
+	b := newBuffer(io.NewSectionReader(r.f, offset, r.end-offset), offset)
+	b.crypt = r.crypt
+	obj, err := b.tryReadObject()
+	if err != nil {
+		return nil, err
+	}
+	def, ok := obj.(objdef)
+	if !ok {
+		return nil, fmt.Errorf("found %T instead of objdef", obj)
+	}
+	if def.ptr != ptr {
+		return nil, fmt.Errorf("found %v", def.ptr)
+	}
+	return def.obj, nil
+}
+
+// readFromObjectStream reads the object ptr from the object stream strmptr
+// (or from one of the streams it extends).
+func (r *Reader) readFromObjectStream(parent, ptr, strmptr objptr) (obj object, err error) {
+	defer catch(&err)
+	seen := make(map[objptr]bool)
+	for !seen[strmptr] {
+		seen[strmptr] = true
+		s, err := r.loadObjStream(parent, strmptr)
+		if err != nil {
+			return nil, err
+		}
+		if off, ok := s.offsets[ptr.id]; ok {
+			if off < 0 || off > int64(len(s.data)) {
+				return nil, fmt.Errorf("object %v is outside object stream %v", ptr, strmptr)
+			}
+			b := newBuffer(bytes.NewReader(s.data[off:]), off)
+			b.allowEOF = true
+			return b.readObject(), nil
+		}
+		if s.extends == (objptr{}) {
+			break
+		}
+		strmptr = s.extends
+	}
+	return nil, fmt.Errorf("cannot find object in stream")
+}
+
 type errorReadCloser struct {
 	err error
 }
@@ -819,51 +1081,71 @@ func (e *errorReadCloser) Close() error {
 func (v Value) Reader() io.ReadCloser {
 	x, ok := v.data.(stream)
 	if !ok {
+		if v.err != nil {
+			return &errorReadCloser{v.err}
+		}
 		return &errorReadCloser{fmt.Errorf("stream not present")}
 	}
-	var rd io.Reader
-	rd = io.NewSectionReader(v.r.f, x.offset, v.Key("Length").Int64())
-	if v.r.key != nil {
-		rd = decryptStream(v.r.key, v.r.useAES, x.ptr, rd)
+	if x.raw == nil && v.r.isClosed() {
+		// Check before the filters are set up, so that they don't wrap
+		// ErrClosed in errors of their own.
+		return &errorReadCloser{ErrClosed}
 	}
+	rd := v.rawReader(x)
 	filter := v.Key("Filter")
 	param := v.Key("DecodeParms")
+	var err error
 	switch filter.Kind() {
 	default:
-		panic(fmt.Errorf("unsupported filter %v", filter))
+		err = fmt.Errorf("unsupported filter %v", filter)
 	case Null:
 		// ok
 	case Name:
-		rd = applyFilter(rd, filter.Name(), param)
+		rd, err = applyFilter(rd, filter.Name(), param)
 	case Array:
-		for i := 0; i < filter.Len(); i++ {
-			rd = applyFilter(rd, filter.Index(i).Name(), param.Index(i))
+		for i := 0; i < filter.Len() && err == nil; i++ {
+			rd, err = applyFilter(rd, filter.Index(i).Name(), param.Index(i))
 		}
 	}
+	if err != nil {
+		v.r.fail(err)
+		return &errorReadCloser{err}
+	}
 
 	return ioutil.NopCloser(rd)
 }
 
-func applyFilter(rd io.Reader, name string, param Value) io.Reader {
+// rawReader returns the data of the stream v, decrypted but not decoded.
+func (v Value) rawReader(x stream) io.Reader {
+	if x.raw != nil {
+		return bytes.NewReader(x.raw)
+	}
+	if v.r.isClosed() {
+		return &errorReadCloser{ErrClosed}
+	}
+	rd := io.NewSectionReader(v.r.f, x.offset, v.Key("Length").Int64())
+	return v.decryptStream(x, rd)
+}
+
+func applyFilter(rd io.Reader, name string, param Value) (io.Reader, error) {
 	switch name {
 	default:
-		panic("unknown filter " + name)
+		return nil, fmt.Errorf("unknown filter %s", name)
 	case "FlateDecode":
 		zr, err := zlib.NewReader(rd)
 		if err != nil {
-			panic(err)
+			return nil, fmt.Errorf("FlateDecode: %w", err)
 		}
 		pred := param.Key("Predictor")
 		if pred.Kind() == Null {
-			return zr
+			return zr, nil
 		}
 		columns := param.Key("Columns").Int64()
 		switch pred.Int64() {
 		default:
-			fmt.Println("unknown predictor", pred)
-			panic("pred")
+			return nil, fmt.Errorf("unknown predictor %v", pred)
 		case 12:
-			return &pngUpReader{r: zr, hist: make([]byte, 1+columns), tmp: make([]byte, 1+columns)}
+			return &pngUpReader{r: zr, hist: make([]byte, 1+columns), tmp: make([]byte, 1+columns)}, nil
 		}
 
 	case "CCITTFaxDecode":
@@ -880,7 +1162,11 @@ func applyFilter(rd io.Reader, name string, param Value) io.Reader {
 			height = rows
 		}
 		invert := param.Key("BlackIs1").Bool()
-		return ccitt.NewReader(rd, ccitt.MSB, sf, width, height, &ccitt.Options{Invert: invert})
+		return ccitt.NewReader(rd, ccitt.MSB, sf, width, height, &ccitt.Options{Invert: invert}), nil
+
+	case "Crypt":
+		// Decryption is done by decryptStream, before the filters.
+		return rd, nil
 	}
 }
 
@@ -946,237 +1232,42 @@ func (v Value) HasFilter(filterName string) bool {
 func (v Value) EncodedReader(filterName string) io.Reader {
 	x, ok := v.data.(stream)
 	if !ok {
+		if v.err != nil {
+			return &errorReadCloser{v.err}
+		}
 		return &errorReadCloser{fmt.Errorf("stream not present")}
 	}
-	var rd io.Reader
-	rd = io.NewSectionReader(v.r.f, x.offset, v.Key("Length").Int64())
-	if v.r.key != nil {
-		rd = decryptStream(v.r.key, v.r.useAES, x.ptr, rd)
+	if x.raw == nil && v.r.isClosed() {
+		// Check before the filters are set up, so that they don't wrap
+		// ErrClosed in errors of their own.
+		return &errorReadCloser{ErrClosed}
 	}
+	rd := v.rawReader(x)
 	filter := v.Key("Filter")
 	param := v.Key("DecodeParms")
+	var err error
 	switch filter.Kind() {
 	default:
-		panic(fmt.Errorf("unsupported filter %v", filter))
+		err = fmt.Errorf("unsupported filter %v", filter)
 	case Null:
 		// ok
 	case Name:
 		if filter.Name() == filterName {
 			return rd
 		}
-		rd = applyFilter(rd, filter.Name(), param)
+		rd, err = applyFilter(rd, filter.Name(), param)
 	case Array:
-		for i := 0; i < filter.Len(); i++ {
+		for i := 0; i < filter.Len() && err == nil; i++ {
 			if filter.Index(i).Name() == filterName {
 				return rd
 			}
-			rd = applyFilter(rd, filter.Index(i).Name(), param.Index(i))
-		}
-	}
-
-	return rd
-}
-
-var passwordPad = []byte{
-	0x28, 0xBF, 0x4E, 0x5E, 0x4E, 0x75, 0x8A, 0x41, 0x64, 0x00, 0x4E, 0x56, 0xFF, 0xFA, 0x01, 0x08,
-	0x2E, 0x2E, 0x00, 0xB6, 0xD0, 0x68, 0x3E, 0x80, 0x2F, 0x0C, 0xA9, 0xFE, 0x64, 0x53, 0x69, 0x7A,
-}
-
-func (r *Reader) initEncrypt(password string) error {
-	// See PDF 32000-1:2008, §7.6.
-	encrypt, _ := r.resolve(objptr{}, r.trailer["Encrypt"]).data.(dict)
-	if encrypt["Filter"] != name("Standard") {
-		return fmt.Errorf("unsupported PDF: encryption filter %v", objfmt(encrypt["Filter"]))
-	}
-	n, _ := encrypt["Length"].(int64)
-	if n == 0 {
-		n = 40
-	}
-	if n%8 != 0 || n > 128 || n < 40 {
-		return fmt.Errorf("malformed PDF: %d-bit encryption key", n)
-	}
-	V, _ := encrypt["V"].(int64)
-	if V != 1 && V != 2 && (V != 4 || !okayV4(encrypt)) {
-		return fmt.Errorf("unsupported PDF: encryption version V=%d; %v", V, objfmt(encrypt))
-	}
-
-	ids, ok := r.trailer["ID"].(array)
-	if !ok || len(ids) < 1 {
-		return fmt.Errorf("malformed PDF: missing ID in trailer")
-	}
-	idstr, ok := ids[0].(string)
-	if !ok {
-		return fmt.Errorf("malformed PDF: missing ID in trailer")
-	}
-	ID := []byte(idstr)
-
-	R, _ := encrypt["R"].(int64)
-	if R < 2 {
-		return fmt.Errorf("malformed PDF: encryption revision R=%d", R)
-	}
-	if R > 4 {
-		return fmt.Errorf("unsupported PDF: encryption revision R=%d", R)
-	}
-	O, _ := encrypt["O"].(string)
-	U, _ := encrypt["U"].(string)
-	if len(O) != 32 || len(U) != 32 {
-		return fmt.Errorf("malformed PDF: missing O= or U= encryption parameters")
-	}
-	p, _ := encrypt["P"].(int64)
-	P := uint32(p)
-
-	// TODO: Password should be converted to Latin-1.
-	pw := []byte(password)
-	h := md5.New()
-	if len(pw) >= 32 {
-		h.Write(pw[:32])
-	} else {
-		h.Write(pw)
-		h.Write(passwordPad[:32-len(pw)])
-	}
-	h.Write([]byte(O))
-	h.Write([]byte{byte(P), byte(P >> 8), byte(P >> 16), byte(P >> 24)})
-	h.Write([]byte(ID))
-	key := h.Sum(nil)
-
-	if R >= 3 {
-		for i := 0; i < 50; i++ {
-			h.Reset()
-			h.Write(key[:n/8])
-			key = h.Sum(key[:0])
+			rd, err = applyFilter(rd, filter.Index(i).Name(), param.Index(i))
 		}
-		key = key[:n/8]
-	} else {
-		key = key[:40/8]
 	}
-
-	c, err := rc4.NewCipher(key)
 	if err != nil {
-		return fmt.Errorf("malformed PDF: invalid RC4 key: %v", err)
-	}
-
-	var u []byte
-	if R == 2 {
-		u = make([]byte, 32)
-		copy(u, passwordPad)
-		c.XORKeyStream(u, u)
-	} else {
-		h.Reset()
-		h.Write(passwordPad)
-		h.Write([]byte(ID))
-		u = h.Sum(nil)
-		c.XORKeyStream(u, u)
-
-		for i := 1; i <= 19; i++ {
-			key1 := make([]byte, len(key))
-			copy(key1, key)
-			for j := range key1 {
-				key1[j] ^= byte(i)
-			}
-			c, _ = rc4.NewCipher(key1)
-			c.XORKeyStream(u, u)
-		}
-	}
-
-	if !bytes.HasPrefix([]byte(U), u) {
-		return ErrInvalidPassword
-	}
-
-	r.key = key
-	r.useAES = V == 4
-
-	return nil
-}
-
-var ErrInvalidPassword = fmt.Errorf("encrypted PDF: invalid password")
-
-func okayV4(encrypt dict) bool {
-	cf, ok := encrypt["CF"].(dict)
-	if !ok {
-		return false
-	}
-	stmf, ok := encrypt["StmF"].(name)
-	if !ok {
-		return false
-	}
-	strf, ok := encrypt["StrF"].(name)
-	if !ok {
-		return false
-	}
-	if stmf != strf {
-		return false
-	}
-	cfparam, ok := cf[stmf].(dict)
-	if cfparam["AuthEvent"] != nil && cfparam["AuthEvent"] != name("DocOpen") {
-		return false
-	}
-	if cfparam["Length"] != nil && cfparam["Length"] != int64(16) {
-		return false
-	}
-	if cfparam["CFM"] != name("AESV2") {
-		return false
-	}
-	return true
-}
-
-func cryptKey(key []byte, useAES bool, ptr objptr) []byte {
-	h := md5.New()
-	h.Write(key)
-	h.Write([]byte{byte(ptr.id), byte(ptr.id >> 8), byte(ptr.id >> 16), byte(ptr.gen), byte(ptr.gen >> 8)})
-	if useAES {
-		h.Write([]byte("sAlT"))
+		v.r.fail(err)
+		return &errorReadCloser{err}
 	}
-	return h.Sum(nil)
-}
 
-func decryptString(key []byte, useAES bool, ptr objptr, x string) string {
-	key = cryptKey(key, useAES, ptr)
-	if useAES {
-		panic("AES not implemented")
-	} else {
-		c, _ := rc4.NewCipher(key)
-		data := []byte(x)
-		c.XORKeyStream(data, data)
-		x = string(data)
-	}
-	return x
-}
-
-func decryptStream(key []byte, useAES bool, ptr objptr, rd io.Reader) io.Reader {
-	key = cryptKey(key, useAES, ptr)
-	if useAES {
-		cb, err := aes.NewCipher(key)
-		if err != nil {
-			panic("AES: " + err.Error())
-		}
-		iv := make([]byte, 16)
-		io.ReadFull(rd, iv)
-		cbc := cipher.NewCBCDecrypter(cb, iv)
-		rd = &cbcReader{cbc: cbc, rd: rd, buf: make([]byte, 16)}
-	} else {
-		c, _ := rc4.NewCipher(key)
-		rd = &cipher.StreamReader{S: c, R: rd}
-	}
 	return rd
 }
-
-type cbcReader struct {
-	cbc  cipher.BlockMode
-	rd   io.Reader
-	buf  []byte
-	pend []byte
-}
-
-func (r *cbcReader) Read(b []byte) (n int, err error) {
-	if len(r.pend) == 0 {
-		_, err = io.ReadFull(r.rd, r.buf)
-		if err != nil {
-			return 0, err
-		}
-		r.cbc.CryptBlocks(r.buf, r.buf)
-		r.pend = r.buf
-	}
-	n = copy(b, r.pend)
-	r.pend = r.pend[n:]
-	return n, nil
-}
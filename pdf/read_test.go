@@ -0,0 +1,131 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReadAfterClose(t *testing.T) {
+	r, _ := newTestReader(t, &WriterOptions{Compress: true}, func(w *Writer) Value {
+		return newPages(w, map[string]Value{
+			"Contents": w.Add(NewStream(NewDict(nil), bytes.Repeat([]byte("0 0 m 72 72 l S\n"), 100))),
+		})
+	})
+	strm := r.Page(1).V.Key("Contents")
+	if !strm.HasFilter("FlateDecode") {
+		t.Fatal("content stream isn't compressed")
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	_, err := io.ReadAll(strm.Reader())
+	if !errors.Is(err, ErrClosed) {
+		t.Errorf("got %v, want ErrClosed", err)
+	}
+}
+
+// handWrittenPDF returns a one-page file with the given header, preceded by
+// junk. The offsets in the cross-reference table are shifted by shift.
+func handWrittenPDF(junk, header string, shift int) []byte {
+	var b bytes.Buffer
+	b.WriteString(header + "\n")
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] >>",
+	}
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", off+shift)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref+shift)
+	return append([]byte(junk), b.Bytes()...)
+}
+
+func TestHeader(t *testing.T) {
+	junk := "From: someone@example.com\r\nSubject: a PDF file\r\n\r\n"
+	tests := []struct {
+		name    string
+		data    []byte
+		version string
+		repair  bool // whether the cross-reference table must be rebuilt
+		fail    bool
+	}{
+		{name: "plain", data: handWrittenPDF("", "%PDF-1.4", 0), version: "1.4"},
+		{name: "PDF 2.0", data: handWrittenPDF("", "%PDF-2.0", 0), version: "2.0"},
+		{name: "header comment", data: handWrittenPDF("", "%PDF-1.7%\xe2\xe3\xcf\xd3", 0), version: "1.7"},
+		{
+			// The offsets are counted from the header.
+			name:    "leading junk",
+			data:    handWrittenPDF(junk, "%PDF-1.5", 0),
+			version: "1.5",
+		},
+		{
+			// The offsets are counted from the start of the file.
+			name:    "leading junk included in offsets",
+			data:    handWrittenPDF(junk, "%PDF-1.5", len(junk)),
+			version: "1.5",
+		},
+		{
+			name:    "junk with a bogus header",
+			data:    handWrittenPDF("%PDF-x.y %PDF-1.\n", "%PDF-1.6", 0),
+			version: "1.6",
+		},
+		{
+			name:    "header at 1 KB",
+			data:    handWrittenPDF(strings.Repeat("x", 1023)+"\n", "%PDF-1.3", 0),
+			version: "1.3",
+		},
+		{
+			name: "header beyond 1 KB",
+			data: handWrittenPDF(strings.Repeat("x", 1100)+"\n", "%PDF-1.3", 0),
+			fail: true,
+		},
+		{name: "PDF 3.0", data: handWrittenPDF("", "%PDF-3.0", 0), fail: true},
+		{name: "no header", data: handWrittenPDF("", "%!PS-Adobe-3.0", 0), fail: true},
+		{
+			// Offsets that point at the wrong places are repaired.
+			name:    "shifted offsets",
+			data:    handWrittenPDF("", "%PDF-1.4", 7),
+			version: "1.4",
+			repair:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, err := NewReader(bytes.NewReader(test.data), int64(len(test.data)))
+			if test.fail {
+				if err == nil {
+					t.Fatal("opened the file, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v := r.Version(); v != test.version {
+				t.Errorf("got version %q, want %q", v, test.version)
+			}
+			if w := r.Warning(); (w != nil) != test.repair {
+				t.Errorf("got warning %v, want repair = %v", w, test.repair)
+			}
+			if n := r.NumPage(); n != 1 {
+				t.Errorf("got %d pages, want 1", n)
+			}
+			if box := r.Page(1).VisibleBox(); box.Max.X != 612 {
+				t.Errorf("got page size %v", box)
+			}
+		})
+	}
+}
@@ -0,0 +1,298 @@
+// Recovering from damaged cross-reference tables.
+
+package pdf
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+)
+
+// objHeader matches the start of an indirect object definition ("12 0 obj").
+// The leading byte ensures that the object number is not the tail of some
+// longer number.
+var objHeader = regexp.MustCompile(`(?:^|[^0-9])([0-9]{1,10})[\x00\t\n\f\r ]+([0-9]{1,5})[\x00\t\n\f\r ]+obj\b`)
+
+var trailerKeyword = regexp.MustCompile(`trailer[\x00\t\n\f\r ]*<<`)
+
+// scanFile calls f with the offset of the first submatch of each match of re
+// in the file.
+func (r *Reader) scanFile(re *regexp.Regexp, f func(match [][]byte, offset int64)) {
+	// The file is scanned in chunks, which overlap so that matches that cross
+	// a chunk boundary are found. Each chunk also includes the byte before
+	// it, so that it can be checked for a token boundary.
+	const chunkSize = 1 << 20
+	const overlap = 64
+	for pos := int64(0); pos < r.end; pos += chunkSize {
+		start := pos
+		if start > 0 {
+			start--
+		}
+		end := pos + chunkSize + overlap
+		if end > r.end {
+			end = r.end
+		}
+		buf := make([]byte, end-start)
+		n, _ := r.f.ReadAt(buf, start)
+		buf = buf[:n]
+		for _, m := range re.FindAllSubmatchIndex(buf, -1) {
+			first := m[0]
+			if len(m) > 2 {
+				first = m[2]
+			}
+			off := start + int64(first)
+			if off < pos || off >= pos+chunkSize {
+				continue
+			}
+			match := make([][]byte, len(m)/2)
+			for i := range match {
+				if m[2*i] >= 0 {
+					match[i] = buf[m[2*i]:m[2*i+1]]
+				}
+			}
+			f(match, off)
+		}
+	}
+}
+
+// rebuildXref reconstructs the cross-reference table by scanning the whole
+// file for object definitions, and the trailer by merging all the trailer
+// dictionaries (and cross-reference stream dictionaries) in the file. It
+// returns the object streams that it found, whose contents need to be added
+// to the table with indexObjectStreams once decryption is set up, and the
+// last document catalog that isn't in an object stream, if there is one.
+// The trailer's Root entry is checked later, by checkRoot, since it may refer
+// to an object in an object stream.
+func (r *Reader) rebuildXref() (table []xref, trailer dict, objStreams []objptr, catalog objptr, err error) {
+	r.scanFile(objHeader, func(match [][]byte, offset int64) {
+		id, gen := decodeDecimal(match[1]), decodeDecimal(match[2])
+		if id <= 0 || id > 1<<24 || gen > 65535 {
+			return
+		}
+		for len(table) <= int(id) {
+			table = append(table, xref{})
+		}
+		// Later definitions replace earlier ones, as in an incremental
+		// update.
+		table[id] = xref{ptr: objptr{uint32(id), uint16(gen)}, offset: offset}
+	})
+	if len(table) == 0 {
+		return nil, nil, nil, objptr{}, fmt.Errorf("malformed PDF: no objects found")
+	}
+
+	type trailerDict struct {
+		offset int64
+		d      dict
+	}
+	var trailers []trailerDict
+	r.scanFile(trailerKeyword, func(match [][]byte, offset int64) {
+		offset += int64(len("trailer"))
+		b := newBuffer(io.NewSectionReader(r.f, offset, r.end-offset), offset)
+		b.allowEOF = true
+		obj, err := b.tryReadObject()
+		if d, ok := obj.(dict); ok && err == nil {
+			trailers = append(trailers, trailerDict{offset, d})
+		}
+	})
+
+	for _, x := range table {
+		if x.offset == 0 {
+			continue
+		}
+		b := newBuffer(io.NewSectionReader(r.f, x.offset, r.end-x.offset), x.offset)
+		b.allowEOF = true
+		obj, err := b.tryReadObject()
+		def, ok := obj.(objdef)
+		if err != nil || !ok || def.ptr != x.ptr {
+			continue
+		}
+		var hdr dict
+		switch o := def.obj.(type) {
+		case dict:
+			hdr = o
+		case stream:
+			hdr = o.hdr
+		}
+		switch hdr["Type"] {
+		case name("Catalog"):
+			catalog = x.ptr
+		case name("ObjStm"):
+			objStreams = append(objStreams, x.ptr)
+		case name("XRef"):
+			trailers = append(trailers, trailerDict{x.offset, hdr})
+		}
+	}
+
+	sort.SliceStable(trailers, func(i, j int) bool {
+		return trailers[i].offset < trailers[j].offset
+	})
+	trailer = make(dict)
+	for _, t := range trailers {
+		for _, k := range []name{"Root", "Info", "Encrypt", "ID"} {
+			if v, ok := t.d[k]; ok {
+				trailer[k] = v
+			}
+		}
+	}
+	trailer["Size"] = int64(len(table))
+
+	return table, trailer, objStreams, catalog, nil
+}
+
+// checkRoot makes sure that the trailer's Root entry refers to an object in
+// the rebuilt cross-reference table. If it doesn't, Root is set to catalog,
+// or, if that is missing, to a document catalog in one of the object
+// streams. It must be called after indexObjectStreams.
+func (r *Reader) checkRoot(catalog objptr) error {
+	r.mu.Lock()
+	root, ok := r.trailer["Root"].(objptr)
+	ok = ok && int(root.id) < len(r.xref) && r.xref[root.id].ptr == root
+	var compressed []objptr
+	if !ok && catalog == (objptr{}) {
+		for _, x := range r.xref {
+			if x.inStream {
+				compressed = append(compressed, x.ptr)
+			}
+		}
+	}
+	r.mu.Unlock()
+	if ok {
+		return nil
+	}
+
+	// Later objects are more likely to come from an incremental update,
+	// so the last catalog is used.
+	for _, ptr := range compressed {
+		if r.resolve(objptr{}, ptr).Key("Type").Name() == "Catalog" {
+			catalog = ptr
+		}
+	}
+	if catalog == (objptr{}) {
+		return fmt.Errorf("malformed PDF: document catalog not found")
+	}
+
+	r.mu.Lock()
+	t := make(dict, len(r.trailer))
+	for k, v := range r.trailer {
+		t[k] = v
+	}
+	t["Root"] = catalog
+	r.trailer = t
+	r.mu.Unlock()
+	return nil
+}
+
+// A repairError is the error returned when a file's cross-reference table
+// is damaged and can't be rebuilt. It matches both errors with errors.Is and
+// errors.As.
+type repairError struct {
+	err        error // the error in the cross-reference table
+	rebuildErr error // the error from rebuilding it
+}
+
+func (e *repairError) Error() string {
+	return fmt.Sprintf("%v; rebuilding cross-reference table: %v", e.err, e.rebuildErr)
+}
+
+func (e *repairError) Unwrap() error { return e.err }
+
+func (e *repairError) Is(target error) bool {
+	return errors.Is(e.err, target) || errors.Is(e.rebuildErr, target)
+}
+
+func (e *repairError) As(target interface{}) bool {
+	return errors.As(e.err, target) || errors.As(e.rebuildErr, target)
+}
+
+// indexObjectStreams adds the objects contained in object streams to the
+// cross-reference table, unless they are also defined directly in the file.
+func (r *Reader) indexObjectStreams(objStreams []objptr) {
+	for _, ptr := range objStreams {
+		strm := r.resolve(objptr{}, ptr)
+		n := int(strm.Key("N").Int64())
+		b := newBuffer(strm.Reader(), 0)
+		b.allowEOF = true
+		func() {
+			var err error
+			defer catch(&err)
+			for i := 0; i < n; i++ {
+				id, ok1 := b.readToken().(int64)
+				_, ok2 := b.readToken().(int64)
+				if !ok1 || !ok2 || id <= 0 || id > 1<<24 {
+					return
+				}
+				r.mu.Lock()
+				for len(r.xref) <= int(id) {
+					r.xref = append(r.xref, xref{})
+				}
+				if r.xref[id].offset == 0 {
+					r.xref[id] = xref{ptr: objptr{uint32(id), 0}, inStream: true, stream: ptr}
+				}
+				r.mu.Unlock()
+			}
+		}()
+	}
+}
+
+// repair rebuilds the cross-reference table after cause shows that it is
+// damaged (for example, because an offset doesn't point to the expected
+// object). It reports whether a rebuilt table is available; the rebuilding
+// is only attempted once.
+func (r *Reader) repair(cause error) bool {
+	r.mu.Lock()
+	if r.repaired {
+		ok := r.warning != nil
+		r.mu.Unlock()
+		return ok
+	}
+	r.repaired = true
+	r.mu.Unlock()
+
+	table, trailer, objStreams, catalog, err := r.rebuildXref()
+	if err != nil {
+		r.reportError(&repairError{cause, err})
+		return false
+	}
+	warning := fmt.Errorf("%v; rebuilt cross-reference table", cause)
+	r.mu.Lock()
+	// Until the object streams are indexed, keep using the old table's
+	// entries for compressed objects.
+	for id, x := range r.xref {
+		if x.inStream && id < len(table) && table[id].offset == 0 {
+			table[id] = x
+		}
+	}
+	r.xref = table
+	if _, ok := r.trailer["Root"].(objptr); !ok {
+		r.trailer = trailer
+	}
+	r.warning = warning
+	r.mu.Unlock()
+
+	r.indexObjectStreams(objStreams)
+	if err := r.checkRoot(catalog); err != nil {
+		r.reportError(&repairError{cause, err})
+	}
+	r.reportError(warning)
+	return true
+}
+
+// Warning returns a description of damage to the file that the Reader has
+// worked around, such as a missing or invalid cross-reference table that had
+// to be rebuilt by scanning the file. It returns nil if no damage has been
+// found.
+func (r *Reader) Warning() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.warning
+}
+
+func decodeDecimal(b []byte) int64 {
+	var x int64
+	for _, c := range b {
+		x = x*10 + int64(c-'0')
+	}
+	return x
+}
@@ -0,0 +1,94 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+var startxrefPattern = regexp.MustCompile(`startxref\s+(\d+)\s+%%EOF\s*$`)
+
+// startxref returns the offset in the startxref line at the end of data, and
+// the location of the number.
+func startxref(t *testing.T, data []byte) (offset int64, loc []int) {
+	t.Helper()
+	m := startxrefPattern.FindSubmatchIndex(data)
+	if m == nil {
+		t.Fatal("no startxref")
+	}
+	offset, _ = strconv.ParseInt(string(data[m[2]:m[3]]), 10, 64)
+	return offset, m[2:4]
+}
+
+func TestRepair(t *testing.T) {
+	for _, layout := range []struct {
+		name string
+		opts *WriterOptions
+	}{
+		{"classic", nil},
+		{"object streams", &WriterOptions{ObjectStreams: true, Compress: true}},
+	} {
+		_, data := newTestReader(t, layout.opts, func(w *Writer) Value {
+			return newPageTree(w, NewDict(map[string]Value{
+				"Font": NewDict(map[string]Value{
+					"F1": w.Add(NewDict(map[string]Value{
+						"Type":     NewName("Font"),
+						"Subtype":  NewName("Type1"),
+						"BaseFont": NewName("Helvetica"),
+					})),
+				}),
+			}))
+		})
+		xrefOffset, loc := startxref(t, data)
+
+		// The cross-reference section and trailer are cut off.
+		truncated := data[:xrefOffset]
+
+		// The startxref offset points to the wrong place.
+		badOffset := append([]byte(nil), data[:loc[0]]...)
+		badOffset = append(badOffset, strconv.FormatInt(xrefOffset/2, 10)...)
+		badOffset = append(badOffset, data[loc[1]:]...)
+
+		for _, c := range []struct {
+			name string
+			data []byte
+		}{
+			{"truncated", truncated},
+			{"bad startxref", badOffset},
+		} {
+			r, err := NewReader(bytes.NewReader(c.data), int64(len(c.data)))
+			if err != nil {
+				t.Errorf("%s, %s: %v", layout.name, c.name, err)
+				continue
+			}
+			if r.Warning() == nil {
+				t.Errorf("%s, %s: no warning", layout.name, c.name)
+			}
+			if typ := r.Trailer().Key("Root").Key("Type").Name(); typ != "Catalog" {
+				t.Errorf("%s, %s: Root has type %q", layout.name, c.name, typ)
+			}
+			if n := r.NumPage(); n != 1 {
+				t.Errorf("%s, %s: %d pages", layout.name, c.name, n)
+				continue
+			}
+			if f := r.Page(1).Font("F1").BaseFont(); f != "Helvetica" {
+				t.Errorf("%s, %s: got font %q", layout.name, c.name, f)
+			}
+		}
+	}
+}
+
+func TestRepairFailure(t *testing.T) {
+	// There are objects, but no document catalog.
+	data := []byte("%PDF-1.7\n1 0 obj\n<< /Type /Pages /Kids [] /Count 0 >>\nendobj\nstartxref\n999\n%%EOF\n")
+	_, err := NewReader(bytes.NewReader(data), int64(len(data)))
+	if err == nil {
+		t.Fatal("no error")
+	}
+	var rerr *repairError
+	if !errors.As(err, &rerr) || rerr.err == nil || rerr.rebuildErr == nil {
+		t.Errorf("got %v, want an error from both reading and rebuilding the cross-reference table", err)
+	}
+}
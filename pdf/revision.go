@@ -0,0 +1,121 @@
+// Reading earlier revisions of incrementally updated files.
+
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// A Revision is one version of a document that has been updated
+// incrementally: either the original document, or the document as it was
+// after one of the updates.
+type Revision struct {
+	// XrefOffset is the offset of the revision's cross-reference section.
+	XrefOffset int64
+
+	// End is the offset just past the end-of-file marker (and its end-of-line)
+	// that ends the revision, or the size of the file if the marker is
+	// missing. The bytes before End are the file as it was when the revision
+	// was written.
+	End int64
+}
+
+// Revisions returns the revisions of the document, oldest first. The last one
+// is the current version, which is the one that r reads. A file that has not
+// been updated has only one revision.
+//
+// If the cross-reference table had to be rebuilt (see Warning), the
+// revision history is not available, and Revisions returns nil.
+func (r *Reader) Revisions() []Revision {
+	r.mu.Lock()
+	repaired := r.repaired
+	r.mu.Unlock()
+	if repaired {
+		return nil
+	}
+	var revs []Revision
+	for i := 0; i < len(r.sections); i++ {
+		rev := Revision{XrefOffset: r.sections[i]}
+		last := r.sections[i]
+		// In a linearized file, the newest section is the first-page
+		// cross-reference table near the start of the file, and its Prev
+		// points to the main table at the end. Both belong to the same
+		// revision.
+		for i+1 < len(r.sections) && r.sections[i+1] > r.sections[i] {
+			i++
+			last = r.sections[i]
+		}
+		rev.End = r.findEOFMarker(last)
+		revs = append(revs, rev)
+	}
+	for i, j := 0, len(revs)-1; i < j; i, j = i+1, j-1 {
+		revs[i], revs[j] = revs[j], revs[i]
+	}
+	return revs
+}
+
+// findEOFMarker returns the offset just past the first %%EOF marker (and its
+// end-of-line) after offset, or the end of the file if there is none.
+func (r *Reader) findEOFMarker(offset int64) int64 {
+	const chunkSize = 4096
+	marker := []byte("%%EOF")
+	for pos := offset; pos < r.end; pos += chunkSize - int64(len(marker)) - 2 {
+		buf := make([]byte, chunkSize)
+		n, _ := r.f.ReadAt(buf, pos)
+		buf = buf[:n]
+		i := bytes.Index(buf, marker)
+		if i < 0 || i+len(marker)+2 > n && pos+int64(n) < r.end {
+			if n < chunkSize {
+				break
+			}
+			continue
+		}
+		end := i + len(marker)
+		if end < n && buf[end] == '\r' {
+			end++
+		}
+		if end < n && buf[end] == '\n' {
+			end++
+		}
+		return pos + int64(end)
+	}
+	return r.end
+}
+
+// OpenRevision returns a Reader for an earlier revision of the document, as
+// returned by Revisions. The new Reader shares r's underlying file, so it
+// can't be used after r is closed, and closing it does not close the file.
+func (r *Reader) OpenRevision(rev Revision) (*Reader, error) {
+	known := false
+	for _, off := range r.sections {
+		if off == rev.XrefOffset {
+			known = true
+		}
+	}
+	if !known {
+		return nil, fmt.Errorf("pdf: no revision with xref at offset %d", rev.XrefOffset)
+	}
+
+	nr := &Reader{
+		f:            r.f,
+		end:          r.end,
+		version:      r.version,
+		errorHandler: r.errorHandler,
+		cache:        newLRU(DefaultCacheSize),
+		objStreams:   newLRU(objStreamCacheSize),
+	}
+	var err error
+	nr.xref, nr.trailerptr, nr.trailer, nr.sections, err = readXref(nr, rev.XrefOffset)
+	if err != nil {
+		return nil, err
+	}
+	if nr.trailer["Encrypt"] != nil {
+		// The encryption dictionary can't change in an incremental update,
+		// so the key is the same.
+		nr.crypt = r.crypt
+		nr.perms = r.perms
+		nr.owner = r.owner
+	}
+	return nr, nil
+}
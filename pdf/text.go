@@ -5,6 +5,7 @@
 package pdf
 
 import (
+	"strings"
 	"unicode"
 	"unicode/utf16"
 )
@@ -39,10 +40,66 @@ Decode:
 	return string(r)
 }
 
+// pdfDocEncode encodes s in PDFDocEncoding. It reports false if s contains
+// characters that can't be encoded.
+func pdfDocEncode(s string) (string, bool) {
+	b := make([]byte, 0, len(s))
+	ok := true
+Runes:
+	for _, r := range s {
+		if r < 0x80 && pdfDocEncoding[r] == r {
+			b = append(b, byte(r))
+			continue
+		}
+		for i, x := range pdfDocEncoding {
+			if x == r && x != noRune {
+				b = append(b, byte(i))
+				continue Runes
+			}
+		}
+		ok = false
+	}
+	return string(b), ok
+}
+
+// utf16Encode encodes s in UTF-16BE, with a byte order mark.
+func utf16Encode(s string) string {
+	u := utf16.Encode([]rune(s))
+	b := make([]byte, 2, 2+2*len(u))
+	b[0], b[1] = 0xfe, 0xff
+	for _, c := range u {
+		b = append(b, byte(c>>8), byte(c))
+	}
+	return string(b)
+}
+
 func isUTF16(s string) bool {
 	return len(s) >= 2 && s[0] == 0xfe && s[1] == 0xff && len(s)%2 == 0
 }
 
+// isUTF8 reports whether s is a UTF-8 text string, which is allowed in PDF
+// 2.0. Such strings start with a byte order mark.
+func isUTF8(s string) bool {
+	return strings.HasPrefix(s, "\xef\xbb\xbf")
+}
+
+// stripLanguageEscapes removes the escape sequences that mark the language
+// of a Unicode text string. Each one is a language code between a pair of
+// U+001B characters.
+func stripLanguageEscapes(s string) string {
+	for {
+		i := strings.IndexByte(s, 0x1b)
+		if i < 0 {
+			return s
+		}
+		j := strings.IndexByte(s[i+1:], 0x1b)
+		if j < 0 {
+			return s
+		}
+		s = s[:i] + s[i+1+j+1:]
+	}
+}
+
 func utf16Decode(s string) string {
 	var u []uint16
 	for i := 0; i < len(s); i += 2 {
@@ -0,0 +1,159 @@
+// Name trees and number trees.
+
+package pdf
+
+import (
+	"sort"
+	"strings"
+)
+
+// maxTreeDepth limits how deep a name tree or number tree is followed.
+const maxTreeDepth = 64
+
+// A NameTree is a map from strings to values, stored as a balanced tree
+// (PDF 32000-1:2008, section 7.9.6). Name trees hold the document's named
+// destinations, embedded files, and JavaScript, among other things.
+// The methods interpret the root node of the tree, V.
+//
+// The keys are byte strings, compared byte by byte; they are not
+// converted with Text.
+type NameTree struct {
+	V Value
+}
+
+// Lookup returns the value for key, or a null Value if the tree doesn't
+// contain key.
+func (t NameTree) Lookup(key string) Value {
+	v, _ := treeLookup(t.V, "Names", func(k Value) int {
+		return strings.Compare(key, k.RawString())
+	}, make(map[objptr]bool), 0)
+	return v
+}
+
+// Walk calls fn for each entry of the tree, in order, until fn returns
+// false.
+func (t NameTree) Walk(fn func(key string, v Value) bool) {
+	treeWalk(t.V, "Names", func(k, v Value) bool {
+		return fn(k.RawString(), v)
+	}, make(map[objptr]bool), 0)
+}
+
+// A NumberTree is a map from integers to values, stored as a balanced tree
+// (PDF 32000-1:2008, section 7.9.7). Number trees hold page labels and the
+// parent tree of the structure tree, among other things.
+// The methods interpret the root node of the tree, V.
+type NumberTree struct {
+	V Value
+}
+
+// Lookup returns the value for key, or a null Value if the tree doesn't
+// contain key.
+func (t NumberTree) Lookup(key int64) Value {
+	v, _ := treeLookup(t.V, "Nums", func(k Value) int {
+		return compareInt(key, k.Int64())
+	}, make(map[objptr]bool), 0)
+	return v
+}
+
+// Walk calls fn for each entry of the tree, in order, until fn returns
+// false.
+func (t NumberTree) Walk(fn func(key int64, v Value) bool) {
+	treeWalk(t.V, "Nums", func(k, v Value) bool {
+		return fn(k.Int64(), v)
+	}, make(map[objptr]bool), 0)
+}
+
+func compareInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// visit reports whether node should be visited, and marks it as visited.
+// It guards against cycles and excessive depth in malformed trees.
+func visit(node Value, seen map[objptr]bool, depth int) bool {
+	if depth > maxTreeDepth || node.Kind() != Dict {
+		return false
+	}
+	if node.indirect {
+		if seen[node.ptr] {
+			return false
+		}
+		seen[node.ptr] = true
+	}
+	return true
+}
+
+// treeLookup finds a key in the name or number tree rooted at node. The
+// entries of the leaf nodes are in the array named entries, and cmp
+// compares the key being looked up with a key in the tree.
+func treeLookup(node Value, entries string, cmp func(k Value) int, seen map[objptr]bool, depth int) (Value, bool) {
+	if !visit(node, seen, depth) {
+		return Value{}, false
+	}
+
+	list := node.Key(entries)
+	n := list.Len() / 2
+	i := sort.Search(n, func(i int) bool { return cmp(list.Index(2*i)) <= 0 })
+	if i < n && cmp(list.Index(2*i)) == 0 {
+		return list.Index(2*i + 1), true
+	}
+
+	// The kids are in order, and each one's Limits entry gives its
+	// smallest and largest keys, so a binary search finds the only kid
+	// that can contain the key.
+	kids := node.Key("Kids")
+	badLimits := false
+	k := sort.Search(kids.Len(), func(i int) bool {
+		limits := kids.Index(i).Key("Limits")
+		if limits.Len() != 2 {
+			badLimits = true
+			return false
+		}
+		return cmp(limits.Index(1)) <= 0
+	})
+	if k < kids.Len() {
+		kid := kids.Index(k)
+		if limits := kid.Key("Limits"); limits.Len() == 2 && cmp(limits.Index(0)) >= 0 {
+			if v, ok := treeLookup(kid, entries, cmp, seen, depth+1); ok {
+				return v, true
+			}
+		}
+	}
+	if !badLimits {
+		return Value{}, false
+	}
+
+	// Some kids are missing their limits, so search them all.
+	for i := 0; i < kids.Len(); i++ {
+		if v, ok := treeLookup(kids.Index(i), entries, cmp, seen, depth+1); ok {
+			return v, true
+		}
+	}
+	return Value{}, false
+}
+
+// treeWalk calls fn for each entry in the tree rooted at node, in order.
+// It returns false if fn returned false.
+func treeWalk(node Value, entries string, fn func(k, v Value) bool, seen map[objptr]bool, depth int) bool {
+	if !visit(node, seen, depth) {
+		return true
+	}
+	list := node.Key(entries)
+	for i := 0; i+1 < list.Len(); i += 2 {
+		if !fn(list.Index(i), list.Index(i+1)) {
+			return false
+		}
+	}
+	kids := node.Key("Kids")
+	for i := 0; i < kids.Len(); i++ {
+		if !treeWalk(kids.Index(i), entries, fn, seen, depth+1) {
+			return false
+		}
+	}
+	return true
+}
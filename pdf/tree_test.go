@@ -0,0 +1,108 @@
+package pdf
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNameTree(t *testing.T) {
+	r, _ := newTestReader(t, nil, func(w *Writer) Value {
+		// The second kid also lists itself, and the tree's root, as kids.
+		root, second := w.Alloc(), w.Alloc()
+		first := w.Add(NewDict(map[string]Value{
+			"Limits": NewArray(NewString("a"), NewString("c")),
+			"Names":  NewArray(NewString("a"), NewInt(1), NewString("b"), NewInt(2), NewString("c"), NewInt(3)),
+		}))
+		w.Set(second, NewDict(map[string]Value{
+			"Limits": NewArray(NewString("d"), NewString("f")),
+			"Names":  NewArray(NewString("d"), NewInt(4), NewString("f"), NewInt(6)),
+			"Kids":   NewArray(second, root),
+		}))
+		w.Set(root, NewDict(map[string]Value{"Kids": NewArray(first, second)}))
+
+		// Kids without Limits.
+		noLimits := NewDict(map[string]Value{
+			"Kids": NewArray(
+				w.Add(NewDict(map[string]Value{"Names": NewArray(NewString("x"), NewInt(24))})),
+				w.Add(NewDict(map[string]Value{"Names": NewArray(NewString("y"), NewInt(25))})),
+			),
+		})
+
+		// A chain of kids too deep to follow.
+		deep := NewDict(map[string]Value{"Names": NewArray(NewString("deep"), NewInt(1))})
+		for i := 0; i < maxTreeDepth+5; i++ {
+			deep = w.Add(NewDict(map[string]Value{"Kids": NewArray(deep)}))
+		}
+
+		return newCatalog(w, map[string]Value{"Test": NewArray(root, noLimits, deep)})
+	})
+	tests := r.Trailer().Key("Root").Key("Test")
+	tree, noLimits, deep := NameTree{tests.Index(0)}, NameTree{tests.Index(1)}, NameTree{tests.Index(2)}
+
+	for _, c := range []struct {
+		tree NameTree
+		key  string
+		want int64
+	}{
+		{tree, "a", 1},
+		{tree, "c", 3},
+		{tree, "d", 4},
+		{tree, "f", 6},
+		{tree, "e", 0},
+		{tree, "g", 0},
+		{tree, "", 0},
+		{noLimits, "x", 24},
+		{noLimits, "y", 25},
+		{noLimits, "z", 0},
+		{deep, "deep", 0},
+	} {
+		v := c.tree.Lookup(c.key)
+		if c.want == 0 && !v.IsNull() || c.want != 0 && v.Int64() != c.want {
+			t.Errorf("Lookup(%q) = %v, want %d", c.key, v, c.want)
+		}
+	}
+
+	var keys []string
+	tree.Walk(func(key string, v Value) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if want := []string{"a", "b", "c", "d", "f"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("Walk: got keys %q, want %q", keys, want)
+	}
+}
+
+func TestNumberTree(t *testing.T) {
+	r, _ := newTestReader(t, nil, func(w *Writer) Value {
+		kid := func(nums ...int64) Value {
+			var entries []Value
+			for _, n := range nums {
+				entries = append(entries, NewInt(n), NewString(string(rune('a'+n))))
+			}
+			return w.Add(NewDict(map[string]Value{
+				"Limits": NewArray(NewInt(nums[0]), NewInt(nums[len(nums)-1])),
+				"Nums":   NewArray(entries...),
+			}))
+		}
+		tree := NewDict(map[string]Value{"Kids": NewArray(kid(0, 2), kid(3, 5, 7), kid(10))})
+		return newCatalog(w, map[string]Value{"Test": tree})
+	})
+	tree := NumberTree{r.Trailer().Key("Root").Key("Test")}
+
+	if v := tree.Lookup(5); v.RawString() != "f" {
+		t.Errorf("Lookup(5) = %v", v)
+	}
+	if v := tree.Lookup(4); !v.IsNull() {
+		t.Errorf("Lookup(4) = %v", v)
+	}
+
+	// Walk stops when the function returns false.
+	var keys []int64
+	tree.Walk(func(key int64, v Value) bool {
+		keys = append(keys, key)
+		return key < 5
+	})
+	if want := []int64{0, 2, 3, 5}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("Walk: got keys %v, want %v", keys, want)
+	}
+}
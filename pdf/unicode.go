@@ -0,0 +1,336 @@
+// Mapping character codes to Unicode when a font has no ToUnicode CMap.
+
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	cidmap "github.com/andybalholm/giopdf/cmap"
+	"github.com/benoitkugler/textlayout/fonts"
+	"github.com/benoitkugler/textlayout/fonts/truetype"
+)
+
+// encodingTable returns the table for a named simple-font encoding,
+// or nil if the name is not recognized.
+func encodingTable(name string) *[256]rune {
+	switch name {
+	case "WinAnsiEncoding":
+		return &WinAnsiEncoding
+	case "MacRomanEncoding":
+		return &MacRomanEncoding
+	case "PDFDocEncoding":
+		return &pdfDocEncoding
+	}
+	return nil
+}
+
+// differencesTable returns the table for an encoding dictionary, with the
+// glyph names from the Differences array applied to the base encoding.
+func differencesTable(enc Value) *[256]rune {
+	table := pdfDocEncoding
+	if base := encodingTable(enc.Key("BaseEncoding").Name()); base != nil {
+		table = *base
+	}
+	diff := enc.Key("Differences")
+	code := 0
+	for i := 0; i < diff.Len(); i++ {
+		item := diff.Index(i)
+		switch item.Kind() {
+		case Integer:
+			code = item.Int()
+		case Name:
+			if code >= 0 && code < 256 {
+				table[code] = glyphRune(item.Name())
+			}
+			code++
+		}
+	}
+	return &table
+}
+
+// glyphRune returns the Unicode character for a glyph name, using the Adobe
+// Glyph List and the uniXXXX and uXXXXX naming conventions.
+func glyphRune(name string) rune {
+	if r, ok := nameToRune[name]; ok {
+		return r
+	}
+	// Suffixes like .sc or .alt mark variants of the base glyph.
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		return glyphRune(name[:i])
+	}
+	if strings.HasPrefix(name, "uni") && len(name) >= 7 {
+		if x, err := strconv.ParseUint(name[3:7], 16, 32); err == nil {
+			return rune(x)
+		}
+	}
+	if strings.HasPrefix(name, "u") && len(name) >= 5 && len(name) <= 7 {
+		if x, err := strconv.ParseUint(name[1:], 16, 32); err == nil {
+			return rune(x)
+		}
+	}
+	return noRune
+}
+
+// CMap returns the CMap that maps the character codes of a composite (Type 0)
+// font to CIDs: either a predefined CMap or one embedded in the file.
+func (f Font) CMap() (*cidmap.CMap, error) {
+	return loadCIDMap(f.V.Key("Encoding"), make(map[objptr]bool))
+}
+
+// loadCIDMap loads the CMap enc. seen holds the CMap streams that are
+// already being loaded, to detect UseCMap cycles.
+func loadCIDMap(enc Value, seen map[objptr]bool) (*cidmap.CMap, error) {
+	switch enc.Kind() {
+	case Name:
+		return cidmap.Predefined(enc.Name())
+
+	case Stream:
+		if seen[enc.ptr] {
+			return nil, errors.New("UseCMap cycle")
+		}
+		seen[enc.ptr] = true
+		data, err := io.ReadAll(enc.Reader())
+		if err != nil {
+			return nil, err
+		}
+		m, err := cidmap.Parse(data)
+		if err != nil {
+			return nil, err
+		}
+		if parent := enc.Key("UseCMap"); !parent.IsNull() {
+			m.UseCMap, err = loadCIDMap(parent, seen)
+			if err != nil {
+				return nil, err
+			}
+		}
+		// The stream dictionary's WMode takes precedence over the one in
+		// the CMap program.
+		if wmode := enc.Key("WMode"); !wmode.IsNull() {
+			m.WMode = wmode.Int()
+		}
+		return m, nil
+
+	default:
+		return nil, fmt.Errorf("invalid CMap: %v", enc)
+	}
+}
+
+// A cidEncoder is the encoding for a composite font. The string is split into
+// character codes according to the font's CMap, and the codes are converted
+// to text with the ToUnicode CMap if there is one, or with fallback otherwise.
+type cidEncoder struct {
+	cmap      *cidmap.CMap
+	toUnicode *cmap
+	fallback  func(code string, cid int) string
+}
+
+func (e *cidEncoder) Decode(raw string) (text string) {
+	return joinText(e.decodeChars(raw))
+}
+
+func (e *cidEncoder) decodeChars(raw string) []charCode {
+	var chars []charCode
+	for len(raw) > 0 {
+		code, n, cid := e.cmap.Decode(raw)
+		if n > len(raw) {
+			n = len(raw)
+		}
+		c := charCode{code: code, n: n, cid: cid}
+		if s, ok := e.toUnicode.lookup(raw[:n]); ok {
+			c.text = s
+		} else if e.fallback != nil {
+			c.text = e.fallback(raw[:n], cid)
+		} else {
+			c.text = string(noRune)
+		}
+		chars = append(chars, c)
+		raw = raw[n:]
+	}
+	return chars
+}
+
+func (f Font) cidEncoder(toUnicode *cmap) TextEncoding {
+	m, err := f.CMap()
+	if err != nil {
+		f.V.r.reportError(fmt.Errorf("loading CMap for font %s: %v", f.BaseFont(), err))
+		m, _ = cidmap.Predefined("Identity-H")
+	}
+	e := &cidEncoder{cmap: m, toUnicode: toUnicode}
+
+	switch {
+	case strings.HasPrefix(m.Name, "Uni"):
+		// The Unicode-based predefined CMaps use Unicode values (in the
+		// encoding form named in the CMap name) as the character codes.
+		switch {
+		case strings.Contains(m.Name, "UCS2"), strings.Contains(m.Name, "UTF16"):
+			e.fallback = func(code string, cid int) string { return utf16Decode(code) }
+		case strings.Contains(m.Name, "UTF8"):
+			e.fallback = func(code string, cid int) string { return code }
+		case strings.Contains(m.Name, "UTF32"):
+			e.fallback = func(code string, cid int) string { return string(rune(codeValue(code))) }
+		}
+
+	case toUnicode == nil:
+		e.fallback = f.collectionFallback()
+		if e.fallback == nil {
+			e.fallback = f.sfntFallback()
+		}
+	}
+	return e
+}
+
+// collectionFallback returns a function that maps CIDs to text, if the font
+// uses one of the Adobe character collections that have a predefined
+// CID-to-Unicode CMap. Otherwise it returns nil.
+func (f Font) collectionFallback() func(code string, cid int) string {
+	info := f.V.Key("DescendantFonts").Index(0).Key("CIDSystemInfo")
+	if info.Key("Registry").RawString() != "Adobe" {
+		return nil
+	}
+	name := "Adobe-" + info.Key("Ordering").RawString() + "-UCS2"
+	if _, ok := uniCMaps[name]; !ok {
+		return nil
+	}
+	m, err := predefinedToUnicode(name)
+	if err != nil {
+		f.V.r.reportError(err)
+		return nil
+	}
+	return func(code string, cid int) string {
+		if s, ok := m.table[uint32(cid)]; ok {
+			return s
+		}
+		return string(noRune)
+	}
+}
+
+// uniCMaps are the predefined Unicode (UTF-16) CMaps for the Adobe character
+// collections, indexed by the names of the collections' CID-to-Unicode CMaps.
+var uniCMaps = map[string]string{
+	"Adobe-GB1-UCS2":    "UniGB-UTF16-H",
+	"Adobe-CNS1-UCS2":   "UniCNS-UTF16-H",
+	"Adobe-Japan1-UCS2": "UniJIS-UTF16-H",
+	"Adobe-Korea1-UCS2": "UniKS-UTF16-H",
+}
+
+var (
+	predefinedToUnicodeMu   sync.Mutex
+	predefinedToUnicodeMaps = make(map[string]*cmap)
+)
+
+// predefinedToUnicode returns one of the CMaps, such as Adobe-Japan1-UCS2,
+// that map the CIDs of a character collection to Unicode. ToUnicode CMaps
+// may refer to them with usecmap. Rather than shipping them separately, they
+// are derived by inverting the collection's Unicode CMap.
+func predefinedToUnicode(name string) (*cmap, error) {
+	predefinedToUnicodeMu.Lock()
+	defer predefinedToUnicodeMu.Unlock()
+	if m, ok := predefinedToUnicodeMaps[name]; ok {
+		return m, nil
+	}
+
+	uni, ok := uniCMaps[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown predefined CMap %q", name)
+	}
+	cm, err := cidmap.Predefined(uni)
+	if err != nil {
+		return nil, err
+	}
+	m := &cmap{table: make(map[uint32]string)}
+	m.space[1] = [][2]string{{"\x00\x00", "\xff\xff"}}
+	for cid, codes := range cm.Codes() {
+		m.table[uint32(cid)] = preferredText(codes)
+	}
+	predefinedToUnicodeMaps[name] = m
+	return m, nil
+}
+
+// preferredText chooses the text for a CID from the UTF-16 codes that map to
+// it: the lowest one that isn't a compatibility character (such as a Kangxi
+// radical, which has the same glyph as a unified ideograph), a vertical
+// presentation form, or a private use character.
+func preferredText(codes []string) string {
+	for _, code := range codes {
+		s := utf16Decode(code)
+		if r, _ := utf8.DecodeRuneInString(s); !isCompatibilityRune(r) {
+			return s
+		}
+	}
+	return utf16Decode(codes[0])
+}
+
+func isCompatibilityRune(r rune) bool {
+	switch {
+	case 0x2e80 <= r && r <= 0x2fdf: // CJK and Kangxi radicals
+	case 0xe000 <= r && r <= 0xf8ff: // private use
+	case 0xf900 <= r && r <= 0xfaff: // CJK compatibility ideographs
+	case 0xfe10 <= r && r <= 0xfe1f: // vertical forms
+	case 0xfe30 <= r && r <= 0xfe4f: // CJK compatibility forms
+	case 0x2f800 <= r && r <= 0x2fa1f: // CJK compatibility ideographs supplement
+	case r >= 0xf0000: // supplementary private use
+	default:
+		return false
+	}
+	return true
+}
+
+// sfntFallback returns a function that maps CIDs to text using the Unicode
+// character map of the font's embedded TrueType font. It returns nil if
+// the font doesn't have one.
+func (f Font) sfntFallback() func(code string, cid int) string {
+	descendant := f.V.Key("DescendantFonts").Index(0)
+	if descendant.Key("Subtype").Name() != "CIDFontType2" {
+		return nil
+	}
+	file := descendant.Key("FontDescriptor").Key("FontFile2")
+	if file.Kind() != Stream {
+		return nil
+	}
+	data, err := io.ReadAll(file.Reader())
+	if err != nil {
+		return nil
+	}
+	font, err := truetype.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+	cm, enc := font.Cmap()
+	if cm == nil || enc != fonts.EncUnicode {
+		return nil
+	}
+	gidToRune := make(map[fonts.GID]rune)
+	iter := cm.Iter()
+	for iter.Next() {
+		r, gid := iter.Char()
+		if old, ok := gidToRune[gid]; !ok || r < old {
+			gidToRune[gid] = r
+		}
+	}
+
+	var cidToGID []byte
+	if m := descendant.Key("CIDToGIDMap"); m.Kind() == Stream {
+		cidToGID, _ = io.ReadAll(m.Reader())
+	}
+
+	return func(code string, cid int) string {
+		gid := fonts.GID(cid)
+		if cidToGID != nil {
+			if 2*cid+1 >= len(cidToGID) {
+				return string(noRune)
+			}
+			gid = fonts.GID(cidToGID[2*cid])<<8 | fonts.GID(cidToGID[2*cid+1])
+		}
+		if r, ok := gidToRune[gid]; ok {
+			return string(r)
+		}
+		return string(noRune)
+	}
+}
@@ -0,0 +1,133 @@
+package pdf
+
+import (
+	"strings"
+	"testing"
+)
+
+func cidFont(encoding, toUnicode Value) Value {
+	return NewDict(map[string]Value{
+		"Type":     NewName("Font"),
+		"Subtype":  NewName("Type0"),
+		"BaseFont": NewName("KozMinPr6N-Regular"),
+		"Encoding": encoding,
+		"DescendantFonts": NewArray(NewDict(map[string]Value{
+			"Type":     NewName("Font"),
+			"Subtype":  NewName("CIDFontType0"),
+			"BaseFont": NewName("KozMinPr6N-Regular"),
+			"CIDSystemInfo": NewDict(map[string]Value{
+				"Registry":   NewString("Adobe"),
+				"Ordering":   NewString("Japan1"),
+				"Supplement": NewInt(6),
+			}),
+		})),
+		"ToUnicode": toUnicode,
+	})
+}
+
+const testToUnicode = `/CIDInit /ProcSet findresource begin
+12 dict begin
+begincmap
+/Adobe-Japan1-UCS2 usecmap
+/CMapName /Test-UCS2 def
+1 beginbfchar
+<0001> <0041>
+endbfchar
+endcmap
+CMapName currentdict /CMap defineresource pop
+end
+end
+`
+
+func TestCIDFontText(t *testing.T) {
+	r, _ := newTestReader(t, nil, func(w *Writer) Value {
+		return newPageTree(w, NewDict(map[string]Value{
+			"Font": NewDict(map[string]Value{
+				// No ToUnicode; the codes are Unicode.
+				"F1": cidFont(NewName("UniJIS-UCS2-H"), Value{}),
+				// No ToUnicode; the CIDs are mapped with
+				// Adobe-Japan1-UCS2.
+				"F2": cidFont(NewName("90ms-RKSJ-H"), Value{}),
+				// A ToUnicode CMap based on Adobe-Japan1-UCS2.
+				"F3": cidFont(NewName("Identity-H"), NewStream(NewDict(nil), []byte(testToUnicode))),
+				// An unknown CMap.
+				"F4": cidFont(NewName("No-Such-CMap"), NewStream(NewDict(nil), []byte(testToUnicode))),
+			}),
+		}))
+	})
+	var errs []string
+	r.SetErrorHandler(func(err error) { errs = append(errs, err.Error()) })
+
+	p := r.Page(1)
+	for _, c := range []struct {
+		font, code, want string
+	}{
+		{"F1", "\x65\xe5\x67\x2c", "日本"},
+		{"F2", "\x93\xfa\x96\x7b", "日本"},
+		{"F3", "\x04\xb0\x00\x01", "一A"},
+		{"F4", "\x04\xb0\x00\x01", "一A"},
+	} {
+		if got := p.Font(c.font).Encoder().Decode(c.code); got != c.want {
+			t.Errorf("%s: got %q, want %q", c.font, got, c.want)
+		}
+	}
+	if len(errs) != 1 || !strings.Contains(errs[0], "No-Such-CMap") {
+		t.Errorf("got errors %q, want one about No-Such-CMap", errs)
+	}
+}
+
+const testCIDCMap = `/CIDInit /ProcSet findresource begin
+12 dict begin
+begincmap
+/CMapName /Test-H def
+1 begincodespacerange
+<0000> <FFFF>
+endcodespacerange
+1 begincidrange
+<0000> <FFFF> 0
+endcidrange
+endcmap
+CMapName currentdict /CMap defineresource pop
+end
+end
+`
+
+func TestMalformedCMaps(t *testing.T) {
+	hugeCount := strings.Replace(testToUnicode, "1 beginbfchar", "99999999999 beginbfchar", 1)
+	hugeRange := strings.Replace(strings.Replace(testToUnicode, "1 beginbfchar", "99999999999 beginbfrange", 1), "endbfchar", "endbfrange", 1)
+	r, _ := newTestReader(t, nil, func(w *Writer) Value {
+		// CMap streams whose UseCMap entries point back to themselves.
+		selfToUnicode := w.Alloc()
+		w.Set(selfToUnicode, NewStream(NewDict(map[string]Value{"UseCMap": selfToUnicode}), []byte(testToUnicode)))
+		selfEncoding := w.Alloc()
+		w.Set(selfEncoding, NewStream(NewDict(map[string]Value{"UseCMap": selfEncoding}), []byte(testCIDCMap)))
+		// A pair of ToUnicode CMaps that use each other.
+		a, b := w.Alloc(), w.Alloc()
+		w.Set(a, NewStream(NewDict(map[string]Value{"UseCMap": b}), []byte(testToUnicode)))
+		w.Set(b, NewStream(NewDict(map[string]Value{"UseCMap": a}), []byte(testToUnicode)))
+
+		return newPageTree(w, NewDict(map[string]Value{
+			"Font": NewDict(map[string]Value{
+				"F1": cidFont(NewName("Identity-H"), NewStream(NewDict(nil), []byte(hugeCount))),
+				"F2": cidFont(NewName("Identity-H"), NewStream(NewDict(nil), []byte(hugeRange))),
+				"F3": cidFont(NewName("Identity-H"), selfToUnicode),
+				"F4": cidFont(selfEncoding, Value{}),
+				"F5": cidFont(NewName("Identity-H"), a),
+			}),
+		}))
+	})
+
+	p := r.Page(1)
+	for _, font := range []string{"F1", "F2", "F3", "F4", "F5"} {
+		var errs []string
+		r.SetErrorHandler(func(err error) { errs = append(errs, err.Error()) })
+		// The text comes from the fallback for Adobe-Japan1, or from
+		// Adobe-Japan1-UCS2 by way of usecmap.
+		if got := p.Font(font).Encoder().Decode("\x04\xb0"); got != "一" {
+			t.Errorf("%s: got %q, want %q", font, got, "一")
+		}
+		if len(errs) != 1 {
+			t.Errorf("%s: got errors %q, want one", font, errs)
+		}
+	}
+}
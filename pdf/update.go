@@ -0,0 +1,180 @@
+// Incremental updates of PDF files.
+
+package pdf
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// An Updater records changes to a PDF file, and writes them as an
+// incremental update: the new and changed objects, followed by a
+// cross-reference section and a trailer whose Prev entry points to the
+// original one, appended to the unchanged bytes of the original file.
+// Because the original bytes are kept, an update is quick to write, and it
+// does not invalidate digital signatures of the earlier revision.
+//
+// If the original file is encrypted, the update is encrypted with the same
+// key, and keeps the same encryption dictionary.
+type Updater struct {
+	r       *Reader
+	size    uint32 // the next unused object number
+	objects map[objptr]Value
+	order   []objptr // the keys of objects, in the order they were set
+	trailer map[string]Value
+}
+
+// NewUpdater returns an Updater for changes to the file read by r.
+// It returns an error if r's cross-reference table had to be rebuilt
+// (see Reader.Warning), since an update can't refer to a damaged table.
+func NewUpdater(r *Reader) (*Updater, error) {
+	r.mu.Lock()
+	repaired, size := r.repaired, len(r.xref)
+	if s, ok := r.trailer["Size"].(int64); ok && s > int64(size) {
+		size = int(s)
+	}
+	r.mu.Unlock()
+	if repaired || len(r.sections) == 0 {
+		return nil, errors.New("pdf: cannot update a file with a damaged cross-reference table")
+	}
+	if size < 1 {
+		size = 1
+	}
+	return &Updater{
+		r:       r,
+		size:    uint32(size),
+		objects: make(map[objptr]Value),
+		trailer: make(map[string]Value),
+	}, nil
+}
+
+// Alloc reserves a new object number, and returns a reference to it, which
+// can be stored in other objects. The object should be given a value with
+// Set; if it isn't, references to it are null.
+func (u *Updater) Alloc() Value {
+	ptr := objptr{u.size, 0}
+	u.size++
+	return Value{r: u.r, data: ptr}
+}
+
+// Set records v as the new value of obj. Obj must be an indirect object of
+// the file being updated (such as a page, or any other Value obtained
+// through a reference), or a reference returned by Alloc or Add.
+func (u *Updater) Set(obj, v Value) error {
+	if obj.r != u.r {
+		return fmt.Errorf("pdf: Set called with an object from a different file")
+	}
+	var ptr objptr
+	if obj.indirect {
+		ptr = obj.ptr
+	} else if p, ok := obj.data.(objptr); ok {
+		ptr = p
+	} else {
+		return fmt.Errorf("pdf: Set called with %v, which is not an indirect object", obj)
+	}
+	if _, ok := u.objects[ptr]; !ok {
+		u.order = append(u.order, ptr)
+	}
+	u.objects[ptr] = v
+	return nil
+}
+
+// Add records v as a new object, and returns a reference to it.
+func (u *Updater) Add(v Value) Value {
+	ref := u.Alloc()
+	u.Set(ref, v)
+	return ref
+}
+
+// SetTrailer sets the entry key in the trailer of the update, such as Info
+// for a new document information dictionary. A null v removes the entry.
+// The Size, Prev and ID entries are filled in automatically, and the Encrypt
+// entry is always kept.
+func (u *Updater) SetTrailer(key string, v Value) {
+	u.trailer[key] = v
+}
+
+// WriteTo writes the original file, followed by the update, to w.
+func (u *Updater) WriteTo(w io.Writer) (int64, error) {
+	if u.r.isClosed() {
+		return 0, ErrClosed
+	}
+	n, err := io.Copy(w, io.NewSectionReader(u.r.f, 0, u.r.end))
+	if err != nil {
+		return n, err
+	}
+	m, err := u.writeUpdate(w)
+	return n + m, err
+}
+
+// Append writes just the update to w, which should be positioned at the end
+// of the original file (for example, a file opened with os.O_APPEND).
+func (u *Updater) Append(w io.Writer) error {
+	if u.r.isClosed() {
+		return ErrClosed
+	}
+	_, err := u.writeUpdate(w)
+	return err
+}
+
+func (u *Updater) writeUpdate(w io.Writer) (int64, error) {
+	r := u.r
+	wr := &Writer{
+		w:       w,
+		offset:  r.end,
+		objects: make([]wobj, u.size),
+		copies:  make(map[copyKey]objptr),
+		crypt:   r.crypt,
+		base:    r,
+		prev:    r.sections[0],
+		// A file that uses cross-reference streams gets one in the
+		// update too.
+		xrefStream: r.trailerptr != objptr{},
+	}
+
+	// The update must start on a new line.
+	last := make([]byte, 1)
+	if _, err := r.f.ReadAt(last, r.end-1); err == nil && last[0] != '\n' && last[0] != '\r' {
+		wr.write([]byte("\n"))
+	}
+
+	for _, ptr := range u.order {
+		wr.writeObject(ptr, u.objects[ptr])
+		wr.drain()
+	}
+
+	trailer := r.Trailer()
+	old, _ := trailer.data.(dict)
+	t := make(dict)
+	for _, k := range []name{"Root", "Info", "Encrypt", "ID"} {
+		if x, ok := old[k]; ok {
+			t[k] = trailer.wrap(x)
+		}
+	}
+	for k, v := range u.trailer {
+		switch k {
+		case "Size", "Prev", "ID", "Encrypt":
+			continue
+		}
+		if v.IsNull() {
+			delete(t, name(k))
+		} else {
+			t[name(k)] = v.object()
+		}
+	}
+	// The first part of the ID identifies the file, and the second part
+	// changes with each revision. With encryption, the first part is part
+	// of the key, so it must not change.
+	id := wr.newID()
+	first := id
+	if ids, ok := trailer.Key("ID").data.(array); ok && len(ids) == 2 {
+		if s, ok := ids[0].(string); ok {
+			first = s
+		}
+	}
+	t["ID"] = array{first, id}
+
+	err := wr.finish(t)
+	return wr.offset - r.end, err
+}
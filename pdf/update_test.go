@@ -0,0 +1,91 @@
+package pdf
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestUpdateRevisions(t *testing.T) {
+	for _, opts := range []*WriterOptions{nil, {ObjectStreams: true}} {
+		name := "xref table"
+		if opts != nil {
+			name = "xref stream"
+		}
+
+		var buf bytes.Buffer
+		w := NewWriter(&buf, opts)
+		root := newPageTree(w, NewDict(nil))
+		info := w.Add(NewDict(map[string]Value{"Title": NewTextString("First")}))
+		if err := w.Finish(NewDict(map[string]Value{"Root": root, "Info": info})); err != nil {
+			t.Fatal(err)
+		}
+		original := buf.Bytes()
+		r, err := NewReader(bytes.NewReader(original), int64(len(original)))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		// Rotate the page and replace the document information.
+		u, err := NewUpdater(r)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		page := r.Page(1).V
+		if err := u.Set(page, page.With("Rotate", NewInt(90))); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		u.SetTrailer("Info", u.Add(NewDict(map[string]Value{"Title": NewTextString("Second")})))
+		var out bytes.Buffer
+		if _, err := u.WriteTo(&out); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		updated := out.Bytes()
+		if !bytes.HasPrefix(updated, original) {
+			t.Fatalf("%s: update doesn't start with the original file", name)
+		}
+
+		r2, err := NewReader(bytes.NewReader(updated), int64(len(updated)))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if r2.Warning() != nil {
+			t.Errorf("%s: %v", name, r2.Warning())
+		}
+		if title := r2.Info().Title; title != "Second" {
+			t.Errorf("%s: got title %q", name, title)
+		}
+		if rot := r2.Page(1).V.Key("Rotate").Int(); rot != 90 {
+			t.Errorf("%s: got rotation %d", name, rot)
+		}
+
+		revs := r2.Revisions()
+		if len(revs) != 2 {
+			t.Fatalf("%s: got %d revisions, want 2", name, len(revs))
+		}
+		if revs[0].End != int64(len(original)) || revs[1].End != int64(len(updated)) {
+			t.Errorf("%s: revisions end at %d and %d, want %d and %d", name, revs[0].End, revs[1].End, len(original), len(updated))
+		}
+
+		old, err := r2.OpenRevision(revs[0])
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if title := old.Info().Title; title != "First" {
+			t.Errorf("%s: got title %q in first revision", name, title)
+		}
+		if rot := old.Page(1).V.Key("Rotate"); !rot.IsNull() {
+			t.Errorf("%s: got rotation %v in first revision", name, rot)
+		}
+		cur, err := r2.OpenRevision(revs[1])
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if title := cur.Info().Title; title != "Second" {
+			t.Errorf("%s: got title %q in second revision", name, title)
+		}
+
+		if _, err := r2.OpenRevision(Revision{XrefOffset: 1}); err == nil {
+			t.Errorf("%s: opened a revision that doesn't exist", name)
+		}
+	}
+}
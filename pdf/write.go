@@ -0,0 +1,659 @@
+// Writing of PDF files.
+
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WriterOptions are the settings for a Writer.
+type WriterOptions struct {
+	// Version is the PDF version written in the file header, such as
+	// "1.7" (the default).
+	Version string
+
+	// Compress causes streams that have no filters to be compressed with
+	// FlateDecode.
+	Compress bool
+
+	// ObjectStreams causes objects other than streams to be stored in
+	// compressed object streams, with a cross-reference stream instead
+	// of a cross-reference table. This needs PDF 1.5, so it raises the
+	// version to 1.5 if necessary.
+	ObjectStreams bool
+}
+
+// A Writer writes a new PDF file.
+//
+// Objects are added to the file with Add (or Alloc and Set, for objects that
+// need to refer to each other), and the file is completed with Finish. The
+// Values written may be built with NewDict and the other New functions, or
+// come from a Reader; objects that a Reader's Values refer to are copied to
+// the new file as well, and renumbered. Each object from a Reader is copied
+// only once, no matter how many times it is referred to.
+//
+// Methods that add objects return a reference to the new object, a Value
+// that can be stored in other objects (its Kind is Null). Errors are sticky:
+// after an error, the Writer writes nothing more, and the error is returned
+// by Set and Finish.
+type Writer struct {
+	w      io.Writer
+	offset int64
+	opts   WriterOptions
+	done   bool
+	err    error
+
+	objects []wobj // indexed by object number
+	copies  map[copyKey]objptr
+	pending []copyKey        // objects to copy, in copies but not yet written
+	omit    map[copyKey]bool // objects to write as null instead of copying
+	batch   objBatch         // objects waiting to be put in an object stream
+
+	xrefStream bool       // whether to write a cross-reference stream
+	crypt      *decrypter // for encrypting strings and streams, or nil
+	cur        objptr     // the object being written, for encryption
+
+	// For an incremental update (see Updater), the Reader being updated,
+	// whose objects keep their numbers, and the offset of its
+	// cross-reference section.
+	base *Reader
+	prev int64
+}
+
+// A wobj records where an object has been written.
+type wobj struct {
+	written  bool
+	reserved bool // returned by Alloc, so it must be written by Set
+	gen      uint16
+	offset   int64  // for an object written directly
+	stream   uint32 // for an object in an object stream, the stream's number
+	index    int    // and the object's position in it
+}
+
+// A wref is a reference to an object in a Writer.
+type wref struct {
+	w   *Writer
+	ptr objptr
+}
+
+type copyKey struct {
+	r   *Reader
+	ptr objptr
+}
+
+// An objBatch is a group of objects that will be written together in an
+// object stream.
+type objBatch struct {
+	ids     []uint32
+	offsets []int
+	buf     bytes.Buffer
+}
+
+// objStreamMax is the number of objects in each object stream.
+const objStreamMax = 100
+
+// NewWriter returns a Writer that writes a PDF file to w. If opts is nil,
+// the defaults are used.
+func NewWriter(w io.Writer, opts *WriterOptions) *Writer {
+	wr := &Writer{
+		w:       w,
+		objects: make([]wobj, 1),
+		copies:  make(map[copyKey]objptr),
+	}
+	if opts != nil {
+		wr.opts = *opts
+	}
+	if wr.opts.Version == "" {
+		wr.opts.Version = "1.7"
+	}
+	if wr.opts.ObjectStreams && wr.opts.Version < "1.5" {
+		wr.opts.Version = "1.5"
+	}
+	wr.xrefStream = wr.opts.ObjectStreams
+	// The comment with binary characters tells programs that the file is
+	// not text.
+	wr.write([]byte("%PDF-" + wr.opts.Version + "\n%\xe2\xe3\xcf\xd3\n"))
+	return wr
+}
+
+func (w *Writer) fail(err error) {
+	if w.err == nil {
+		w.err = err
+	}
+}
+
+func (w *Writer) write(b []byte) {
+	if w.err != nil {
+		return
+	}
+	n, err := w.w.Write(b)
+	w.offset += int64(n)
+	if err != nil {
+		w.fail(err)
+	}
+}
+
+func (w *Writer) alloc() objptr {
+	w.objects = append(w.objects, wobj{})
+	return objptr{uint32(len(w.objects) - 1), 0}
+}
+
+// entry returns the record for the object ptr, or nil if ptr was not
+// allocated by w.
+func (w *Writer) entry(ptr objptr) *wobj {
+	if ptr.id == 0 || ptr.id >= uint32(len(w.objects)) {
+		return nil
+	}
+	return &w.objects[ptr.id]
+}
+
+// Alloc reserves an object number, and returns a reference to it. The
+// object must be written later with Set; Finish returns an error if it
+// isn't.
+func (w *Writer) Alloc() Value {
+	ptr := w.alloc()
+	w.objects[ptr.id].reserved = true
+	return Value{data: wref{w, ptr}}
+}
+
+// Set writes v as the object ref, which must have been returned by Alloc.
+func (w *Writer) Set(ref, v Value) error {
+	r, ok := ref.data.(wref)
+	if !ok || r.w != w {
+		return fmt.Errorf("pdf: Set called with %v, which is not a reference from Alloc", ref)
+	}
+	if e := w.entry(r.ptr); e == nil || e.written {
+		return fmt.Errorf("pdf: object %v written twice", r.ptr)
+	}
+	w.writeObject(r.ptr, v)
+	w.drain()
+	return w.err
+}
+
+// Add writes v as a new object, and returns a reference to it.
+func (w *Writer) Add(v Value) Value {
+	ref := w.Alloc()
+	w.Set(ref, v)
+	return ref
+}
+
+// Copy copies v to the file, and returns a reference to the copy. If v is
+// an indirect object from a Reader (such as a page, a font, or anything else
+// obtained through a reference), it is copied only once; later calls return
+// the same reference. Otherwise Copy is the same as Add.
+func (w *Writer) Copy(v Value) Value {
+	if v.r == nil || !v.indirect {
+		return w.Add(v)
+	}
+	ptr := w.copyRef(v.r, v.ptr)
+	w.drain()
+	return Value{data: wref{w, ptr}}
+}
+
+// copyRef returns the number of the copy of the object ptr from r,
+// scheduling it to be copied if necessary.
+func (w *Writer) copyRef(r *Reader, ptr objptr) objptr {
+	if r == w.base {
+		return ptr
+	}
+	key := copyKey{r, ptr}
+	if p, ok := w.copies[key]; ok {
+		return p
+	}
+	p := w.alloc()
+	w.copies[key] = p
+	w.pending = append(w.pending, key)
+	return p
+}
+
+// drain writes the objects scheduled to be copied.
+func (w *Writer) drain() {
+	for len(w.pending) > 0 && w.err == nil {
+		key := w.pending[0]
+		w.pending = w.pending[1:]
+		// A missing or unreadable object is written as null, which
+		// is what a reference to a missing object means.
+		var v Value
+		if !w.omit[key] {
+			v = key.r.resolve(objptr{}, key.ptr)
+		}
+		w.writeObject(w.copies[key], v)
+	}
+}
+
+// writeObject writes v as the object ptr.
+func (w *Writer) writeObject(ptr objptr, v Value) {
+	if w.err != nil {
+		return
+	}
+	if w.done {
+		w.fail(errors.New("pdf: write after Finish"))
+		return
+	}
+	if strm, ok := v.data.(stream); ok {
+		w.writeStream(ptr, strm, v.r)
+		return
+	}
+	inStream := w.opts.ObjectStreams && ptr.gen == 0
+	if !inStream {
+		// The strings in an object stream are not encrypted
+		// separately, since the whole stream is.
+		w.cur = ptr
+	}
+	body := w.appendObject(nil, v.data, v.r)
+	w.cur = objptr{}
+	if inStream {
+		w.batch.ids = append(w.batch.ids, ptr.id)
+		w.batch.offsets = append(w.batch.offsets, w.batch.buf.Len())
+		w.batch.buf.Write(body)
+		w.batch.buf.WriteByte('\n')
+		if len(w.batch.ids) >= objStreamMax {
+			w.flushBatch()
+		}
+		return
+	}
+	w.markWritten(ptr, wobj{written: true, gen: ptr.gen, offset: w.offset})
+	w.write([]byte(fmt.Sprintf("%d %d obj\n", ptr.id, ptr.gen)))
+	w.write(body)
+	w.write([]byte("\nendobj\n"))
+}
+
+func (w *Writer) markWritten(ptr objptr, e wobj) {
+	*w.entry(ptr) = e
+}
+
+// writeStream writes the stream strm, from r (which is nil for a stream
+// built in memory), as the object ptr.
+func (w *Writer) writeStream(ptr objptr, strm stream, r *Reader) {
+	data := strm.raw
+	if data == nil {
+		var err error
+		data, err = ioutil.ReadAll(Value{r: r, ptr: strm.ptr, data: strm}.rawReader(strm))
+		if err != nil {
+			w.fail(fmt.Errorf("pdf: copying stream %v: %v", strm.ptr, err))
+			return
+		}
+	}
+	hdr := make(dict, len(strm.hdr)+1)
+	for k, v := range strm.hdr {
+		hdr[k] = v
+	}
+	if w.opts.Compress && hdr["Filter"] == nil {
+		data = flateEncode(data)
+		hdr["Filter"] = name("FlateDecode")
+		delete(hdr, "DecodeParms")
+	}
+	if w.crypt != nil {
+		data = w.crypt.encryptStream(ptr, hdr, data)
+	}
+	hdr["Length"] = int64(len(data))
+
+	b := []byte(fmt.Sprintf("%d %d obj\n", ptr.id, ptr.gen))
+	saved := w.cur
+	w.cur = ptr
+	b = w.appendObject(b, hdr, r)
+	w.cur = saved
+	b = append(b, "\nstream\n"...)
+	w.markWritten(ptr, wobj{written: true, gen: ptr.gen, offset: w.offset})
+	w.write(b)
+	w.write(data)
+	w.write([]byte("\nendstream\nendobj\n"))
+}
+
+// flushBatch writes the objects in w.batch as an object stream.
+func (w *Writer) flushBatch() {
+	if len(w.batch.ids) == 0 {
+		return
+	}
+	sptr := w.alloc()
+	var head bytes.Buffer
+	for i, id := range w.batch.ids {
+		fmt.Fprintf(&head, "%d %d ", id, w.batch.offsets[i])
+	}
+	head.WriteByte('\n')
+	first := head.Len()
+	head.Write(w.batch.buf.Bytes())
+	hdr := dict{
+		"Type":   name("ObjStm"),
+		"N":      int64(len(w.batch.ids)),
+		"First":  int64(first),
+		"Filter": name("FlateDecode"),
+	}
+	for i, id := range w.batch.ids {
+		w.markWritten(objptr{id, 0}, wobj{written: true, stream: sptr.id, index: i})
+	}
+	w.batch = objBatch{}
+	w.writeStream(sptr, stream{hdr: hdr, raw: flateEncode(head.Bytes())}, nil)
+}
+
+func flateEncode(data []byte) []byte {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write(data)
+	zw.Close()
+	return buf.Bytes()
+}
+
+// appendObject appends the PDF syntax for x to b. References in x are
+// interpreted relative to r.
+func (w *Writer) appendObject(b []byte, x object, r *Reader) []byte {
+	switch x := x.(type) {
+	case nil:
+		return append(b, "null"...)
+	case bool:
+		return strconv.AppendBool(b, x)
+	case int64:
+		return strconv.AppendInt(b, x, 10)
+	case float64:
+		return appendReal(b, x)
+	case string:
+		if w.crypt != nil && w.cur.id != 0 {
+			x = w.crypt.encryptString(w.cur, x)
+		}
+		return appendString(b, x)
+	case name:
+		return appendName(b, x)
+	case dict:
+		b = append(b, "<<"...)
+		for _, k := range sortedKeys(x) {
+			if x[k] == nil {
+				continue
+			}
+			b = appendName(b, k)
+			b = append(b, ' ')
+			b = w.appendObject(b, x[k], r)
+		}
+		return append(b, ">>"...)
+	case array:
+		b = append(b, '[')
+		for i, e := range x {
+			if i > 0 {
+				b = append(b, ' ')
+			}
+			b = w.appendObject(b, e, r)
+		}
+		return append(b, ']')
+	case objptr:
+		if r == nil {
+			w.fail(fmt.Errorf("pdf: reference %v is not from a Reader", x))
+			return append(b, "null"...)
+		}
+		return appendRef(b, w.copyRef(r, x))
+	case wref:
+		if x.w != w {
+			w.fail(fmt.Errorf("pdf: reference %v is from a different Writer", x.ptr))
+			return append(b, "null"...)
+		}
+		return appendRef(b, x.ptr)
+	case Value:
+		if x.r != nil && x.indirect {
+			return appendRef(b, w.copyRef(x.r, x.ptr))
+		}
+		return w.appendObject(b, x.data, x.r)
+	case stream:
+		// A stream can only be an indirect object.
+		ptr := w.alloc()
+		w.writeStream(ptr, x, r)
+		return appendRef(b, ptr)
+	default:
+		w.fail(fmt.Errorf("pdf: cannot write value of type %T", x))
+		return append(b, "null"...)
+	}
+}
+
+func appendRef(b []byte, ptr objptr) []byte {
+	return append(b, fmt.Sprintf("%d %d R", ptr.id, ptr.gen)...)
+}
+
+func appendReal(b []byte, f float64) []byte {
+	// PDF does not allow exponents.
+	return strconv.AppendFloat(b, f, 'f', -1, 64)
+}
+
+// appendName appends the name n, with a leading slash. Characters that are
+// not regular characters are written as #xx escapes.
+func appendName(b []byte, n name) []byte {
+	b = append(b, '/')
+	for i := 0; i < len(n); i++ {
+		c := n[i]
+		if c < '!' || c > '~' || c == '#' || isDelim(c) {
+			b = append(b, fmt.Sprintf("#%02X", c)...)
+			continue
+		}
+		b = append(b, c)
+	}
+	return b
+}
+
+// appendString appends the string s as a literal string, or as a hex
+// string if it is mostly binary data.
+func appendString(b []byte, s string) []byte {
+	binary := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] < ' ' && s[i] != '\n' && s[i] != '\r' && s[i] != '\t' || s[i] > '~' {
+			binary++
+		}
+	}
+	if binary > len(s)/4 {
+		b = append(b, '<')
+		for i := 0; i < len(s); i++ {
+			b = append(b, "0123456789ABCDEF"[s[i]>>4], "0123456789ABCDEF"[s[i]&15])
+		}
+		return append(b, '>')
+	}
+
+	b = append(b, '(')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '(', ')', '\\':
+			b = append(b, '\\', c)
+		case '\n':
+			b = append(b, `\n`...)
+		case '\r':
+			b = append(b, `\r`...)
+		case '\t':
+			b = append(b, `\t`...)
+		default:
+			if c < ' ' || c > '~' {
+				b = append(b, fmt.Sprintf(`\%03o`, c)...)
+			} else {
+				b = append(b, c)
+			}
+		}
+	}
+	return append(b, ')')
+}
+
+// Finish completes the file by writing any pending objects, the
+// cross-reference table, and the trailer. The trailer should contain the
+// Root entry, and optionally Info and ID; an ID is generated if it is
+// missing. The Size entry is filled in, and Prev, XRefStm and Encrypt entries
+// are ignored.
+func (w *Writer) Finish(trailer Value) error {
+	t := make(dict)
+	if x, ok := trailer.dict(); ok {
+		for k, v := range x {
+			switch k {
+			case "Size", "Prev", "XRefStm", "Encrypt", "Type", "W", "Index", "Filter", "DecodeParms", "Length":
+				continue
+			}
+			t[k] = trailer.wrap(v)
+		}
+	}
+	if t["ID"] == nil {
+		id := w.newID()
+		t["ID"] = array{id, id}
+	}
+	return w.finish(t)
+}
+
+// newID returns a new file identifier.
+func (w *Writer) newID() string {
+	h := md5.New()
+	fmt.Fprintf(h, "%v %d %d", time.Now().UnixNano(), w.offset, len(w.objects))
+	return string(h.Sum(nil))
+}
+
+// finish writes the pending objects, and the cross-reference section with
+// the trailer t.
+func (w *Writer) finish(t dict) error {
+	if w.done {
+		return errors.New("pdf: Finish called twice")
+	}
+	if _, ok := t["Root"]; !ok {
+		w.fail(errors.New("pdf: trailer has no Root"))
+	}
+	// Write the trailer entries to a scratch buffer first, so that the
+	// objects they refer to are copied.
+	w.appendObject(nil, t, nil)
+	w.drain()
+	w.flushBatch()
+	var unset []string
+	for i, e := range w.objects {
+		if e.reserved && !e.written {
+			unset = append(unset, strconv.Itoa(i))
+		}
+	}
+	if len(unset) > 0 {
+		w.fail(fmt.Errorf("pdf: objects allocated but never set: %s", strings.Join(unset, ", ")))
+	}
+	if w.err != nil {
+		return w.err
+	}
+	w.done = true
+	if w.base != nil {
+		t["Prev"] = w.prev
+	}
+
+	if w.xrefStream {
+		w.writeXrefStream(t)
+	} else {
+		w.writeXrefTable(t)
+	}
+	return w.err
+}
+
+// xrefRuns returns the ranges of object numbers to list in the
+// cross-reference section, as pairs of first number and count. A new file
+// lists all of its objects; an update lists only the objects it writes.
+func (w *Writer) xrefRuns() [][2]int {
+	if w.base == nil {
+		return [][2]int{{0, len(w.objects)}}
+	}
+	var runs [][2]int
+	for i, e := range w.objects {
+		if !e.written {
+			continue
+		}
+		if n := len(runs); n > 0 && runs[n-1][0]+runs[n-1][1] == i {
+			runs[n-1][1]++
+		} else {
+			runs = append(runs, [2]int{i, 1})
+		}
+	}
+	return runs
+}
+
+// writeXrefTable writes a classic cross-reference table and trailer.
+func (w *Writer) writeXrefTable(t dict) {
+	entries := w.objects
+	start := w.offset
+	b := []byte("xref\n")
+	// The free entries form a linked list, starting at object 0.
+	next := func(i int) int {
+		for j := i + 1; j < len(entries); j++ {
+			if !entries[j].written {
+				return j
+			}
+		}
+		return 0
+	}
+	for _, run := range w.xrefRuns() {
+		b = append(b, fmt.Sprintf("%d %d\n", run[0], run[1])...)
+		for i := run[0]; i < run[0]+run[1]; i++ {
+			switch e := entries[i]; {
+			case i == 0:
+				b = append(b, fmt.Sprintf("%010d 65535 f \n", next(0))...)
+			case e.written:
+				b = append(b, fmt.Sprintf("%010d %05d n \n", e.offset, e.gen)...)
+			default:
+				b = append(b, fmt.Sprintf("%010d 00001 f \n", next(i))...)
+			}
+		}
+	}
+	t["Size"] = int64(len(entries))
+	b = append(b, "trailer\n"...)
+	b = w.appendObject(b, t, nil)
+	b = append(b, fmt.Sprintf("\nstartxref\n%d\n%%%%EOF\n", start)...)
+	w.write(b)
+}
+
+// writeXrefStream writes a cross-reference stream, which also serves as the
+// trailer.
+func (w *Writer) writeXrefStream(t dict) {
+	ptr := w.alloc()
+	entries := w.objects
+	start := w.offset
+	entries[len(entries)-1] = wobj{written: true, offset: start}
+
+	width := 4
+	if start >= 1<<32 {
+		width = 8
+	}
+	var data []byte
+	field := func(x int64, n int) {
+		for i := n - 1; i >= 0; i-- {
+			data = append(data, byte(x>>(8*uint(i))))
+		}
+	}
+	var index array
+	for _, run := range w.xrefRuns() {
+		index = append(index, int64(run[0]), int64(run[1]))
+		for i := run[0]; i < run[0]+run[1]; i++ {
+			switch e := entries[i]; {
+			case i == 0:
+				field(0, 1)
+				field(0, width)
+				field(65535, 2)
+			case !e.written:
+				field(0, 1)
+				field(0, width)
+				field(1, 2)
+			case e.stream != 0:
+				field(2, 1)
+				field(int64(e.stream), width)
+				field(int64(e.index), 2)
+			default:
+				field(1, 1)
+				field(e.offset, width)
+				field(int64(e.gen), 2)
+			}
+		}
+	}
+	t["Type"] = name("XRef")
+	t["Size"] = int64(len(entries))
+	t["W"] = array{int64(1), int64(width), int64(2)}
+	if w.base != nil {
+		t["Index"] = index
+	}
+	t["Filter"] = name("FlateDecode")
+	data = flateEncode(data)
+	t["Length"] = int64(len(data))
+
+	// The cross-reference stream is not encrypted.
+	b := []byte(fmt.Sprintf("%d 0 obj\n", ptr.id))
+	b = w.appendObject(b, t, nil)
+	b = append(b, "\nstream\n"...)
+	w.write(b)
+	w.write(data)
+	w.write([]byte(fmt.Sprintf("\nendstream\nendobj\nstartxref\n%d\n%%%%EOF\n", start)))
+}
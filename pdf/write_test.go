@@ -0,0 +1,149 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestWriteEncryptedObjectStreams(t *testing.T) {
+	d := &decrypter{key: []byte("0123456789abcdef"), strMethod: cryptAESV2, stmMethod: cryptAESV2}
+	var buf bytes.Buffer
+	w := NewWriter(&buf, &WriterOptions{ObjectStreams: true})
+	w.crypt = d
+	info := w.Add(NewDict(map[string]Value{"Title": NewTextString("Secret")}))
+	root := newPageTree(w, NewDict(nil))
+	if err := w.Finish(NewDict(map[string]Value{"Root": root, "Info": info})); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(buf.Bytes(), []byte("Secret")) {
+		t.Error("string written without encryption")
+	}
+
+	r, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The Writer doesn't write an encryption dictionary, so set up
+	// decryption by hand.
+	r.crypt = d
+	if title := r.Info().Title; title != "Secret" {
+		t.Errorf("got title %q, want %q", title, "Secret")
+	}
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	content := []byte("BT /F1 12 Tf 72 720 Td (Hello, world) Tj ET\n")
+	for _, opts := range []*WriterOptions{
+		nil,
+		{Compress: true},
+		{ObjectStreams: true},
+		{Compress: true, ObjectStreams: true},
+	} {
+		name := "default"
+		if opts != nil {
+			name = fmt.Sprintf("%+v", *opts)
+		}
+		var buf bytes.Buffer
+		w := NewWriter(&buf, opts)
+		pages := w.Alloc()
+		page := w.Add(NewDict(map[string]Value{
+			"Type":     NewName("Page"),
+			"Parent":   pages,
+			"MediaBox": NewArray(NewInt(0), NewInt(0), NewReal(612.5), NewInt(792)),
+			"Contents": w.Add(NewStream(NewDict(nil), content)),
+			"Resources": NewDict(map[string]Value{
+				"Font": NewDict(map[string]Value{
+					"F1": w.Add(NewDict(map[string]Value{
+						"Type":     NewName("Font"),
+						"Subtype":  NewName("Type1"),
+						"BaseFont": NewName("Helvetica Bold#2"),
+					})),
+				}),
+			}),
+		}))
+		w.Set(pages, NewDict(map[string]Value{
+			"Type":  NewName("Pages"),
+			"Kids":  NewArray(page),
+			"Count": NewInt(1),
+		}))
+		root := w.Add(NewDict(map[string]Value{
+			"Type":     NewName("Catalog"),
+			"Pages":    pages,
+			"Bytes":    NewString("(\\)\r\n\x00\xff"),
+			"NeedsPDF": NewBool(true),
+		}))
+		info := w.Add(NewDict(map[string]Value{
+			"Title":  NewTextString("Grüße, 世界"),
+			"Author": NewTextString("A. Writer"),
+		}))
+		if err := w.Finish(NewDict(map[string]Value{"Root": root, "Info": info})); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		check := func(data []byte, stage string) *Reader {
+			r, err := NewReader(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				t.Fatalf("%s, %s: %v", name, stage, err)
+			}
+			if r.Warning() != nil {
+				t.Errorf("%s, %s: %v", name, stage, r.Warning())
+			}
+			if info := r.Info(); info.Title != "Grüße, 世界" || info.Author != "A. Writer" {
+				t.Errorf("%s, %s: got info %+v", name, stage, info)
+			}
+			cat := r.Trailer().Key("Root")
+			if s := cat.Key("Bytes").RawString(); s != "(\\)\r\n\x00\xff" {
+				t.Errorf("%s, %s: got string %q", name, stage, s)
+			}
+			if !cat.Key("NeedsPDF").Bool() {
+				t.Errorf("%s, %s: lost boolean", name, stage)
+			}
+			if r.NumPage() != 1 {
+				t.Fatalf("%s, %s: %d pages", name, stage, r.NumPage())
+			}
+			p := r.Page(1)
+			if x := p.MediaBox().Index(2).Float64(); x != 612.5 {
+				t.Errorf("%s, %s: got MediaBox width %v", name, stage, x)
+			}
+			if f := p.Font("F1").BaseFont(); f != "Helvetica Bold#2" {
+				t.Errorf("%s, %s: got font %q", name, stage, f)
+			}
+			rd := p.ContentReader()
+			got, err := ioutil.ReadAll(rd)
+			rd.Close()
+			if err != nil || !bytes.Equal(got, content) {
+				t.Errorf("%s, %s: got content %q, %v", name, stage, got, err)
+			}
+			return r
+		}
+		r := check(buf.Bytes(), "written")
+
+		// Copy the document to a new file.
+		var buf2 bytes.Buffer
+		w2 := NewWriter(&buf2, opts)
+		trailer := r.Trailer()
+		if err := w2.Finish(NewDict(map[string]Value{
+			"Root": w2.Copy(trailer.Key("Root")),
+			"Info": w2.Copy(trailer.Key("Info")),
+		})); err != nil {
+			t.Fatalf("%s, copying: %v", name, err)
+		}
+		check(buf2.Bytes(), "copied")
+	}
+}
+
+func TestWriteUnsetObject(t *testing.T) {
+	for _, opts := range []*WriterOptions{nil, {ObjectStreams: true}} {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, opts)
+		unset := w.Alloc()
+		root := newPageTree(w, NewDict(map[string]Value{"Missing": unset}))
+		err := w.Finish(NewDict(map[string]Value{"Root": root}))
+		if err == nil || !strings.Contains(err.Error(), "never set") {
+			t.Errorf("%+v: got %v, want an error about the unset object", opts, err)
+		}
+	}
+}
@@ -2,29 +2,189 @@ package giopdf
 
 import (
 	"fmt"
+	"io"
 
+	"gioui.org/f32"
 	"gioui.org/op"
 	"github.com/andybalholm/giopdf/pdf"
 )
 
-// RenderPage draws the contents of a PDF page to ops.
-// The caller should do the appropriate transformation and scaling to ensure
-// that the content is not rendered upside down. (The PDF coordinate system
-// starts in the lower left, not in the upper left like Gio's.)
+// RenderPage draws the contents of a PDF page to ops, in the page's own
+// coordinate system. The caller should do the appropriate transformation and
+// scaling to ensure that the content is not rendered upside down. (The PDF
+// coordinate system starts in the lower left, not in the upper left like
+// Gio's.) RenderPageWithOptions does this automatically.
+//
+// If the page is malformed, RenderPage returns an error, but the content
+// before the error is still drawn. An annotation that can't be drawn is
+// skipped, and reported in the error.
 func RenderPage(ops *op.Ops, page pdf.Page) error {
+	return renderPage(NewCanvas(ops), page, ScreenAnnotations)
+}
+
+// RenderPageOptions controls how RenderPageWithOptions places a page.
+type RenderPageOptions struct {
+	// DPI is the resolution: the number of Gio pixels per inch.
+	// If it is zero, 72 is used, so that one pixel is one point.
+	DPI float32
+
+	// Width and Height, if they are not zero, are the size of the area to
+	// draw the page in. The page is scaled to fit in the area, keeping
+	// its aspect ratio, and DPI is ignored. If only one of them is set,
+	// the page is scaled to that width or height.
+	Width, Height float32
+
+	// Annotations selects which of the page's annotations are drawn.
+	Annotations AnnotationMode
+}
+
+// RenderPageWithOptions draws page to ops, with its upper left corner at the
+// origin, the right way up. It shows the page's visible area (its CropBox),
+// rotated as specified by its Rotate entry, and scaled according to opts and
+// the page's UserUnit. Nothing is drawn outside the visible area. A nil
+// opts is the same as the zero RenderPageOptions.
+func RenderPageWithOptions(ops *op.Ops, page pdf.Page, opts *RenderPageOptions) error {
+	if opts == nil {
+		opts = new(RenderPageOptions)
+	}
 	c := NewCanvas(ops)
+	m, _ := PageTransform(page, opts)
+	sx, hx, ox, hy, sy, oy := m.Elems()
+	c.Transform(sx, hy, hx, sy, ox, oy)
 
-	stream := page.V.Key("Contents")
-	cs := pdf.NewContentStream(stream.Reader())
+	box := page.VisibleBox()
+	c.Rectangle(float32(box.Min.X), float32(box.Min.Y), float32(box.Max.X-box.Min.X), float32(box.Max.Y-box.Min.Y))
+	c.Clip()
+	c.NoOpPaint()
+
+	return renderPage(c, page, opts.Annotations)
+}
+
+// PageTransform returns the transformation that RenderPageWithOptions
+// applies to page, from the page's default user space to Gio coordinates,
+// and the size of the rendered page.
+func PageTransform(page pdf.Page, opts *RenderPageOptions) (m f32.Affine2D, size f32.Point) {
+	if opts == nil {
+		opts = new(RenderPageOptions)
+	}
+	box := page.VisibleBox()
+	w := float32(box.Max.X-box.Min.X) * float32(page.UserUnit())
+	h := float32(box.Max.Y-box.Min.Y) * float32(page.UserUnit())
+	rotate := page.Rotate()
+	if rotate == 90 || rotate == 270 {
+		w, h = h, w
+	}
+
+	// The scale from points (1/72 inch, after applying UserUnit) to
+	// pixels.
+	var scale float32
+	switch {
+	case opts.Width > 0 && opts.Height > 0:
+		scale = opts.Width / w
+		if s := opts.Height / h; s < scale {
+			scale = s
+		}
+	case opts.Width > 0:
+		scale = opts.Width / w
+	case opts.Height > 0:
+		scale = opts.Height / h
+	case opts.DPI > 0:
+		scale = opts.DPI / 72
+	default:
+		scale = 1
+	}
+	size = f32.Pt(w*scale, h*scale)
+
+	// Move the lower left corner of the visible box to the origin, scale,
+	// and flip the y axis, so that the page's top edge is at y = 0.
+	s := scale * float32(page.UserUnit())
+	m = f32.Affine2D{}.
+		Offset(f32.Pt(-float32(box.Min.X), -float32(box.Min.Y))).
+		Scale(f32.Point{}, f32.Pt(s, -s))
+	// Then rotate the page clockwise, and move it back into view. The
+	// rotations are written out so that they are exact.
+	switch rotate {
+	case 90:
+		m = f32.NewAffine2D(0, -1, 0, 1, 0, 0).Mul(m)
+	case 180:
+		m = f32.NewAffine2D(-1, 0, size.X, 0, -1, 0).Mul(m)
+	case 270:
+		m = f32.NewAffine2D(0, 1, size.X, -1, 0, size.Y).Mul(m)
+	default:
+		m = m.Offset(f32.Pt(0, size.Y))
+	}
+	return m, size
+}
+
+// operandCounts is the number of operands required by each operator that
+// takes operands (PDF 32000-1:2008, table 51). For the color operators that
+// take a variable number of operands (SC, sc, SCN and scn), it is the
+// minimum. Instructions with too few operands are skipped.
+var operandCounts = map[string]int{
+	"'": 1, "\"": 3, "BDC": 2, "BMC": 1, "c": 6, "cm": 6, "CS": 1, "cs": 1,
+	"d": 2, "d0": 2, "d1": 6, "Do": 1, "DP": 2, "G": 1, "g": 1, "gs": 1,
+	"i": 1, "J": 1, "j": 1, "K": 4, "k": 4, "l": 2, "M": 1, "m": 2, "MP": 1,
+	"re": 4, "RG": 3, "rg": 3, "ri": 1, "SC": 1, "sc": 1, "SCN": 1, "scn": 1,
+	"sh": 1, "Tc": 1, "Td": 2, "TD": 2, "Tf": 2, "TJ": 1, "Tj": 1, "TL": 1,
+	"Tm": 6, "Tr": 1, "Ts": 1, "Tw": 1, "Tz": 1, "v": 4, "w": 1, "y": 4,
+}
+
+// maxFormDepth limits how deeply form XObjects can be nested, which guards
+// against forms that (directly or indirectly) draw themselves.
+const maxFormDepth = 32
+
+// renderPage interprets the content stream of page, calling the
+// corresponding methods of c, and then draws the page's annotations that
+// are selected by annots.
+func renderPage(c *Canvas, page pdf.Page, annots AnnotationMode) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("error rendering page: %v", e)
+		}
+		c.restoreAll()
+	}()
+
+	contents := page.ContentReader()
+	defer contents.Close()
+	// The annotations are drawn in the page's initial graphics state,
+	// even if the content stream leaves unbalanced q operators.
+	c.Save()
+	err = renderContent(c, contents, page.Resources(), 0)
+	c.restoreTo(0)
+
+	if annots != NoAnnotations {
+		if aerr := renderAnnotations(c, page, annots); err == nil {
+			err = aerr
+		}
+	}
+	return err
+}
+
+// renderContent interprets a content stream, using the named resources in
+// resources. Depth is the number of form XObjects that are being drawn.
+func renderContent(c *Canvas, content io.Reader, resources pdf.Value, depth int) error {
+	cs := pdf.NewContentStream(content)
 
 	for {
 		args, op := cs.ReadInstruction()
+		if len(args) < operandCounts[op] {
+			fmt.Printf("Too few operands for %s: %v\n", op, args)
+			continue
+		}
 		switch op {
 		case "":
-			return nil
+			return cs.Err()
 		default:
 			fmt.Println(args, op)
 
+		case "'":
+			c.NextLine()
+			c.ShowText(args[0].RawString())
+		case "\"":
+			c.SetWordSpacing(args[0].Float32())
+			c.SetCharSpacing(args[1].Float32())
+			c.NextLine()
+			c.ShowText(args[2].RawString())
 		case "B", "B*":
 			c.FillAndStroke()
 		case "BT":
@@ -42,19 +202,30 @@ func RenderPage(ops *op.Ops, page pdf.Page) error {
 			}
 			c.SetDash(dashes, phase)
 		case "Do":
-			x := page.Resources().Key("XObject").Key(args[0].Name())
+			x := resources.Key("XObject").Key(args[0].Name())
 			if x.IsNull() {
 				fmt.Printf("XObject resource missing: %v", args[0])
 				continue
 			}
 			switch x.Key("Subtype").Name() {
 			case "Image":
+				if c.ops == nil {
+					continue
+				}
 				img, err := decodeImage(x)
 				if err != nil {
 					fmt.Println(err)
 					continue
 				}
 				c.Image(img)
+			case "Form":
+				if depth >= maxFormDepth {
+					fmt.Printf("Form XObjects nested too deeply: %v\n", args[0])
+					continue
+				}
+				if err := drawForm(c, x, resources, depth+1); err != nil {
+					fmt.Printf("Error drawing form XObject %v: %v\n", args[0], err)
+				}
 			default:
 				fmt.Printf("Unsupported XObject: %v\n", x)
 			}
@@ -67,7 +238,7 @@ func RenderPage(ops *op.Ops, page pdf.Page) error {
 		case "g":
 			c.SetFillGray(args[0].Float32())
 		case "gs":
-			gs := page.Resources().Key("ExtGState").Key(args[0].Name())
+			gs := resources.Key("ExtGState").Key(args[0].Name())
 			if gs.IsNull() {
 				fmt.Printf("ExtGState resource missing: %v", args[0])
 				continue
@@ -133,10 +304,17 @@ func RenderPage(ops *op.Ops, page pdf.Page) error {
 			c.SetRGBFillColor(args[0].Float32(), args[1].Float32(), args[2].Float32())
 		case "S":
 			c.Stroke()
+		case "T*":
+			c.NextLine()
+		case "Tc":
+			c.SetCharSpacing(args[0].Float32())
 		case "Td":
 			c.TextMove(args[0].Float32(), args[1].Float32())
+		case "TD":
+			c.SetLeading(-args[1].Float32())
+			c.TextMove(args[0].Float32(), args[1].Float32())
 		case "Tf":
-			fd := page.Font(args[0].Name())
+			fd := pdf.Font{V: resources.Key("Font").Key(args[0].Name())}
 			if fd.V.IsNull() {
 				fmt.Printf("Font resource missing: %v\n", args[0])
 				continue
@@ -144,14 +322,10 @@ func RenderPage(ops *op.Ops, page pdf.Page) error {
 			f, err := importPDFFont(fd)
 			if err != nil {
 				fmt.Println("Error importing font:", err)
-				continue
+				f = fallbackFont(fd)
 			}
 			c.SetFont(f, args[1].Float32())
 		case "TJ":
-			if c.font == nil {
-				// TODO: remove
-				continue
-			}
 			a := args[0]
 			for i := 0; i < a.Len(); i++ {
 				v := a.Index(i)
@@ -164,10 +338,16 @@ func RenderPage(ops *op.Ops, page pdf.Page) error {
 			}
 		case "Tj":
 			c.ShowText(args[0].RawString())
+		case "TL":
+			c.SetLeading(args[0].Float32())
 		case "Tm":
 			c.SetTextMatrix(args[0].Float32(), args[1].Float32(), args[2].Float32(), args[3].Float32(), args[4].Float32(), args[5].Float32())
 		case "Tr":
 			c.SetTextRendering(args[0].Int())
+		case "Ts":
+			c.SetTextRise(args[0].Float32())
+		case "Tw":
+			c.SetWordSpacing(args[0].Float32())
 		case "Tz":
 			c.SetHScale(args[0].Float32())
 		case "v":
@@ -178,6 +358,41 @@ func RenderPage(ops *op.Ops, page pdf.Page) error {
 			c.SetLineWidth(args[0].Float32())
 		}
 	}
+}
+
+// drawForm draws the form XObject form. If the form doesn't have its own
+// resources, it uses those of its parent (which is allowed in old files).
+func drawForm(c *Canvas, form, parentResources pdf.Value, depth int) error {
+	level := len(c.stateStack)
+	c.Save()
+	defer c.restoreTo(level)
+
+	if m := form.Key("Matrix"); m.Len() == 6 {
+		c.Transform(m.Index(0).Float32(), m.Index(1).Float32(), m.Index(2).Float32(), m.Index(3).Float32(), m.Index(4).Float32(), m.Index(5).Float32())
+	}
+	if bbox, ok := rectangle(form.Key("BBox")); ok {
+		c.Rectangle(bbox.Min.X, bbox.Min.Y, bbox.Dx(), bbox.Dy())
+		c.Clip()
+		c.NoOpPaint()
+	}
+
+	resources := form.Key("Resources")
+	if resources.IsNull() {
+		resources = parentResources
+	}
+	rd := form.Reader()
+	defer rd.Close()
+	return renderContent(c, rd, resources, depth)
+}
 
-	return nil
+// rectangle converts a PDF rectangle to an f32.Rectangle, with its corners
+// in order. It reports whether v was a valid rectangle.
+func rectangle(v pdf.Value) (r f32.Rectangle, ok bool) {
+	if v.Kind() != pdf.Array || v.Len() != 4 {
+		return f32.Rectangle{}, false
+	}
+	return f32.Rectangle{
+		Min: f32.Pt(v.Index(0).Float32(), v.Index(1).Float32()),
+		Max: f32.Pt(v.Index(2).Float32(), v.Index(3).Float32()),
+	}.Canon(), true
 }
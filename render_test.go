@@ -0,0 +1,160 @@
+package giopdf
+
+import (
+	"testing"
+
+	"gioui.org/f32"
+	"github.com/andybalholm/giopdf/pdf"
+)
+
+func TestPageTransform(t *testing.T) {
+	// The visible area is 300 by 400 points, from (100, 200) to (400, 600).
+	// The corners are given as where they end up, in Gio coordinates.
+	type corners struct{ topLeft, topRight, bottomLeft f32.Point }
+	tests := []struct {
+		name    string
+		entries map[string]pdf.Value
+		opts    *RenderPageOptions
+		size    f32.Point
+		corners corners
+	}{
+		{
+			name:    "upright",
+			size:    f32.Pt(300, 400),
+			corners: corners{f32.Pt(0, 0), f32.Pt(300, 0), f32.Pt(0, 400)},
+		},
+		{
+			name:    "rotate 90",
+			entries: map[string]pdf.Value{"Rotate": pdf.NewInt(90)},
+			size:    f32.Pt(400, 300),
+			corners: corners{f32.Pt(400, 0), f32.Pt(400, 300), f32.Pt(0, 0)},
+		},
+		{
+			name:    "rotate 180",
+			entries: map[string]pdf.Value{"Rotate": pdf.NewInt(180)},
+			size:    f32.Pt(300, 400),
+			corners: corners{f32.Pt(300, 400), f32.Pt(0, 400), f32.Pt(300, 0)},
+		},
+		{
+			name:    "rotate 270",
+			entries: map[string]pdf.Value{"Rotate": pdf.NewInt(270)},
+			size:    f32.Pt(400, 300),
+			corners: corners{f32.Pt(0, 300), f32.Pt(0, 0), f32.Pt(400, 300)},
+		},
+		{
+			name:    "rotate -90",
+			entries: map[string]pdf.Value{"Rotate": pdf.NewInt(-90)},
+			size:    f32.Pt(400, 300),
+			corners: corners{f32.Pt(0, 300), f32.Pt(0, 0), f32.Pt(400, 300)},
+		},
+		{
+			name:    "rotate 450",
+			entries: map[string]pdf.Value{"Rotate": pdf.NewInt(450)},
+			size:    f32.Pt(400, 300),
+			corners: corners{f32.Pt(400, 0), f32.Pt(400, 300), f32.Pt(0, 0)},
+		},
+		{
+			// Rotations that aren't multiples of 90 are rounded.
+			name:    "rotate 100",
+			entries: map[string]pdf.Value{"Rotate": pdf.NewInt(100)},
+			size:    f32.Pt(400, 300),
+			corners: corners{f32.Pt(400, 0), f32.Pt(400, 300), f32.Pt(0, 0)},
+		},
+		{
+			name:    "rotate 150",
+			entries: map[string]pdf.Value{"Rotate": pdf.NewInt(150)},
+			size:    f32.Pt(300, 400),
+			corners: corners{f32.Pt(300, 400), f32.Pt(0, 400), f32.Pt(300, 0)},
+		},
+		{
+			name:    "rotate 30",
+			entries: map[string]pdf.Value{"Rotate": pdf.NewInt(30)},
+			size:    f32.Pt(300, 400),
+			corners: corners{f32.Pt(0, 0), f32.Pt(300, 0), f32.Pt(0, 400)},
+		},
+		{
+			name:    "UserUnit",
+			entries: map[string]pdf.Value{"UserUnit": pdf.NewReal(2)},
+			size:    f32.Pt(600, 800),
+			corners: corners{f32.Pt(0, 0), f32.Pt(600, 0), f32.Pt(0, 800)},
+		},
+		{
+			name:    "UserUnit and rotate 90",
+			entries: map[string]pdf.Value{"UserUnit": pdf.NewReal(2), "Rotate": pdf.NewInt(90)},
+			size:    f32.Pt(800, 600),
+			corners: corners{f32.Pt(800, 0), f32.Pt(800, 600), f32.Pt(0, 0)},
+		},
+		{
+			name:    "DPI",
+			opts:    &RenderPageOptions{DPI: 144},
+			size:    f32.Pt(600, 800),
+			corners: corners{f32.Pt(0, 0), f32.Pt(600, 0), f32.Pt(0, 800)},
+		},
+		{
+			name:    "UserUnit and DPI",
+			entries: map[string]pdf.Value{"UserUnit": pdf.NewReal(2)},
+			opts:    &RenderPageOptions{DPI: 36},
+			size:    f32.Pt(300, 400),
+			corners: corners{f32.Pt(0, 0), f32.Pt(300, 0), f32.Pt(0, 400)},
+		},
+		{
+			// The height limits the scale.
+			name:    "fit",
+			opts:    &RenderPageOptions{Width: 1000, Height: 200},
+			size:    f32.Pt(150, 200),
+			corners: corners{f32.Pt(0, 0), f32.Pt(150, 0), f32.Pt(0, 200)},
+		},
+		{
+			name:    "fit width and rotate 270",
+			entries: map[string]pdf.Value{"Rotate": pdf.NewInt(270)},
+			opts:    &RenderPageOptions{Width: 200},
+			size:    f32.Pt(200, 150),
+			corners: corners{f32.Pt(0, 150), f32.Pt(0, 0), f32.Pt(200, 150)},
+		},
+		{
+			// A CropBox outside the MediaBox is ignored.
+			name:    "bad CropBox",
+			entries: map[string]pdf.Value{"CropBox": pdf.NewArray(ints(700, 700, 800, 800)...)},
+			size:    f32.Pt(600, 800),
+			corners: corners{f32.Pt(0, 0), f32.Pt(600, 0), f32.Pt(0, 800)},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entries := map[string]pdf.Value{
+				"Type":     pdf.NewName("Page"),
+				"MediaBox": pdf.NewArray(ints(0, 0, 600, 800)...),
+				"CropBox":  pdf.NewArray(ints(100, 200, 400, 600)...),
+			}
+			for k, v := range test.entries {
+				entries[k] = v
+			}
+			page := pdf.Page{V: pdf.NewDict(entries)}
+			box := page.VisibleBox()
+
+			m, size := PageTransform(page, test.opts)
+			if !near(size, test.size) {
+				t.Errorf("got size %v, want %v", size, test.size)
+			}
+			for _, c := range []struct {
+				name string
+				x, y float64
+				want f32.Point
+			}{
+				{"top left", box.Min.X, box.Max.Y, test.corners.topLeft},
+				{"top right", box.Max.X, box.Max.Y, test.corners.topRight},
+				{"bottom left", box.Min.X, box.Min.Y, test.corners.bottomLeft},
+			} {
+				if got := m.Transform(f32.Pt(float32(c.x), float32(c.y))); !near(got, c.want) {
+					t.Errorf("%s corner goes to %v, want %v", c.name, got, c.want)
+				}
+			}
+		})
+	}
+}
+
+func near(a, b f32.Point) bool {
+	d := a.Sub(b)
+	return d.X > -0.01 && d.X < 0.01 && d.Y > -0.01 && d.Y < 0.01
+}
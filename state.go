@@ -23,10 +23,18 @@ type graphicsState struct {
 	font              Font
 	fontSize          float32
 	hScale            float32
+	charSpacing       float32
+	wordSpacing       float32
+	leading           float32
+	rise              float32
 	textMatrix        f32.Affine2D
 	lineMatrix        f32.Affine2D
 	textRenderingMode int
 
+	// ctm is the current transformation matrix, mapping user space to the
+	// default coordinate space of the page.
+	ctm f32.Affine2D
+
 	transforms    []op.TransformStack
 	clippingPaths []clip.Stack
 }
@@ -127,10 +135,38 @@ func (s *graphicsState) SetTextMatrix(a, b, c, d, e, f float32) {
 // TextMove starts a new line of text offset by x and y from the start of the
 // current line.
 func (s *graphicsState) TextMove(x, y float32) {
-	s.lineMatrix = f32.NewAffine2D(1, 0, x, 0, 1, y).Mul(s.lineMatrix)
+	s.lineMatrix = s.lineMatrix.Mul(f32.NewAffine2D(1, 0, x, 0, 1, y))
 	s.textMatrix = s.lineMatrix
 }
 
+// NextLine starts a new line of text, using the current leading.
+func (s *graphicsState) NextLine() {
+	s.TextMove(0, -s.leading)
+}
+
+// SetCharSpacing sets the extra space to add after each character of text,
+// in unscaled text space units.
+func (s *graphicsState) SetCharSpacing(spacing float32) {
+	s.charSpacing = spacing
+}
+
+// SetWordSpacing sets the extra space to add after each space character
+// (the single-byte character code 32), in unscaled text space units.
+func (s *graphicsState) SetWordSpacing(spacing float32) {
+	s.wordSpacing = spacing
+}
+
+// SetLeading sets the distance between lines of text, used by NextLine.
+func (s *graphicsState) SetLeading(leading float32) {
+	s.leading = leading
+}
+
+// SetTextRise sets the distance to move the baseline up (or down, if
+// negative), for superscripts and subscripts.
+func (s *graphicsState) SetTextRise(rise float32) {
+	s.rise = rise
+}
+
 // SetHScale sets the horizontal scaling percent for text.
 func (s *graphicsState) SetHScale(scale float32) {
 	s.hScale = scale
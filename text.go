@@ -17,12 +17,24 @@ func (c *Canvas) EndText() {
 
 // ShowText displays a string of text.
 func (c *Canvas) ShowText(s string) {
+	if c.font == nil {
+		return
+	}
 	glyphs := c.font.ToGlyphs(s)
+	vertical := c.font.Vertical()
 	vSize := c.fontSize
 	hSize := c.fontSize * c.hScale / 100
-	sizeMatrix := f32.NewAffine2D(hSize, 0, 0, 0, vSize, 0)
+	sizeMatrix := f32.NewAffine2D(hSize, 0, 0, 0, vSize, c.rise)
 	for _, g := range glyphs {
 		glyphSpace := c.textMatrix.Mul(sizeMatrix)
+		if vertical {
+			// The glyph's position vector gives the offset from its
+			// horizontal origin to the current point.
+			glyphSpace = glyphSpace.Mul(f32.NewAffine2D(1, 0, -g.Position.X, 0, 1, -g.Position.Y))
+		}
+		if c.textHandler != nil {
+			c.textHandler(g, c.ctm.Mul(glyphSpace), vertical)
+		}
 		c.Path = append(c.Path, transformPath(g.Outlines, glyphSpace)...)
 		// TODO: clipping
 		switch c.textRenderingMode {
@@ -35,13 +47,34 @@ func (c *Canvas) ShowText(s string) {
 		case 3, 7:
 			// Invisible
 		}
-		c.textMatrix = c.textMatrix.Offset(f32.Pt(g.Width*hSize, 0))
+
+		spacing := c.charSpacing
+		if g.WordSpace {
+			spacing += c.wordSpacing
+		}
+		if vertical {
+			// Horizontal scaling does not apply to vertical displacement.
+			c.moveText(0, g.VerticalAdvance*vSize+spacing)
+		} else {
+			c.moveText((g.Width*c.fontSize+spacing)*c.hScale/100, 0)
+		}
 	}
 }
 
 // Kern moves the next text character to the left the specified amount.
+// (In vertical writing mode, it moves the next character down instead.)
 // The distance is in units of 1/1000 of an em.
 func (c *Canvas) Kern(amount float32) {
+	if c.font != nil && c.font.Vertical() {
+		c.moveText(0, -c.fontSize*amount/1000)
+		return
+	}
 	distance := c.fontSize * c.hScale / 100 * amount / 1000
-	c.textMatrix = c.textMatrix.Offset(f32.Pt(-distance, 0))
+	c.moveText(-distance, 0)
+}
+
+// moveText moves the text position by (tx, ty) in text space, without
+// changing the text line matrix.
+func (c *Canvas) moveText(tx, ty float32) {
+	c.textMatrix = c.textMatrix.Mul(f32.NewAffine2D(1, 0, tx, 0, 1, ty))
 }